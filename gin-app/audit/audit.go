@@ -0,0 +1,104 @@
+// Package audit builds the history entries recorded for changes to todos,
+// and carries the account that makes them in their context.
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"time"
+
+	"gin-app/models"
+)
+
+// ignored holds the fields that change with every write or are derived from
+// other todos, and so say nothing about the change itself
+var ignored = map[string]bool{"version": true, "updated_at": true, "blocked": true}
+
+// null is the value of every field of a todo that does not exist
+var null = json.RawMessage("null")
+
+type actorKey struct{}
+
+// WithActor returns a context whose changes to todos are recorded as made
+// by actorID
+func WithActor(ctx context.Context, actorID int) context.Context {
+	return context.WithValue(ctx, actorKey{}, actorID)
+}
+
+// Actor returns the account the changes made with ctx are recorded as made
+// by, and false when they are made for no one and go unrecorded
+func Actor(ctx context.Context) (int, bool) {
+	actorID, ok := ctx.Value(actorKey{}).(int)
+	return actorID, ok
+}
+
+// Entry returns the history entry for a change made by actorID. before is
+// nil for a todo that was just created and after is nil for one that was
+// purged.
+func Entry(actorID int, operation string, before, after *models.Todo) (models.HistoryEntry, error) {
+	snapshot := before
+	if after != nil {
+		snapshot = after
+	}
+	changes, err := Diff(before, after)
+	if err != nil {
+		return models.HistoryEntry{}, err
+	}
+
+	return models.HistoryEntry{
+		TodoID:    snapshot.ID,
+		UserID:    snapshot.UserID,
+		ActorID:   actorID,
+		Operation: operation,
+		Version:   snapshot.Version,
+		Changes:   changes,
+		Snapshot:  *snapshot,
+		CreatedAt: time.Now(),
+	}, nil
+}
+
+// Diff returns the fields whose JSON values differ between before and after,
+// either of which may be nil
+func Diff(before, after *models.Todo) (map[string]models.FieldChange, error) {
+	b, err := fields(before)
+	if err != nil {
+		return nil, err
+	}
+	a, err := fields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := map[string]models.FieldChange{}
+	for _, values := range []map[string]json.RawMessage{b, a} {
+		for name := range values {
+			if _, seen := changes[name]; seen || ignored[name] {
+				continue
+			}
+			if from, to := value(b, name), value(a, name); !bytes.Equal(from, to) {
+				changes[name] = models.FieldChange{Before: from, After: to}
+			}
+		}
+	}
+	return changes, nil
+}
+
+func fields(todo *models.Todo) (map[string]json.RawMessage, error) {
+	values := map[string]json.RawMessage{}
+	if todo == nil {
+		return values, nil
+	}
+	body, err := json.Marshal(todo)
+	if err != nil {
+		return nil, err
+	}
+	return values, json.Unmarshal(body, &values)
+}
+
+func value(values map[string]json.RawMessage, name string) json.RawMessage {
+	if v, ok := values[name]; ok {
+		return v
+	}
+	return null
+}
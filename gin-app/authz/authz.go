@@ -0,0 +1,79 @@
+// Package authz decides what each account role may do. Roles grant
+// permissions, and a policy names the permission each route requires.
+package authz
+
+import "gin-app/models"
+
+// Permission is something a route requires of the caller's role
+type Permission string
+
+const (
+	// Public routes need no token at all
+	Public Permission = "public"
+
+	ReadAccount  Permission = "account:read"
+	WriteAccount Permission = "account:write"
+	ReadTodos    Permission = "todos:read"
+	WriteTodos   Permission = "todos:write"
+	ReadLists    Permission = "lists:read"
+	WriteLists   Permission = "lists:write"
+	ReadTags     Permission = "tags:read"
+	WriteTags    Permission = "tags:write"
+	ReadWebhooks Permission = "webhooks:read"
+	// WriteWebhooks also covers redelivering, which sends requests out
+	WriteWebhooks Permission = "webhooks:write"
+
+	// ManageUsers lists accounts and changes their roles
+	ManageUsers Permission = "users:manage"
+	// ReadAllTodos reads the todos of every account
+	ReadAllTodos Permission = "todos:read_all"
+
+	// ManageTenants provisions, suspends and resumes tenants
+	ManageTenants Permission = "tenants:manage"
+)
+
+// RoleOperator is the role of the operator token, which manages tenants
+// and nothing inside them
+const RoleOperator = "operator"
+
+// reads are granted to every role. Read-only accounts can still change
+// their own profile, which touches nothing shared.
+var reads = []Permission{ReadAccount, WriteAccount, ReadTodos, ReadLists, ReadTags, ReadWebhooks}
+
+// writes are granted to members and admins
+var writes = []Permission{WriteTodos, WriteLists, WriteTags, WriteWebhooks}
+
+// grants holds the permissions of each account role
+var grants = map[string]map[Permission]bool{
+	models.AccountReadOnly: set(reads),
+	models.AccountMember:   set(reads, writes),
+	models.AccountAdmin:    set(reads, writes, []Permission{ManageUsers, ReadAllTodos}),
+	RoleOperator:           set([]Permission{ManageTenants}),
+}
+
+func set(groups ...[]Permission) map[Permission]bool {
+	permissions := map[Permission]bool{}
+	for _, group := range groups {
+		for _, p := range group {
+			permissions[p] = true
+		}
+	}
+	return permissions
+}
+
+// Allows reports whether role grants permission. Unknown roles are granted
+// nothing but public routes.
+func Allows(role string, permission Permission) bool {
+	return permission == Public || grants[role][permission]
+}
+
+// Policy maps routes, written "METHOD /path/:param" as gin names them, to
+// the permission they require
+type Policy map[string]Permission
+
+// Required returns the permission of a route, and false when the policy
+// does not cover it
+func (p Policy) Required(method, route string) (Permission, bool) {
+	permission, ok := p[method+" "+route]
+	return permission, ok
+}
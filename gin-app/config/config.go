@@ -0,0 +1,374 @@
+package config
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"time"
+
+	"gin-app/ratelimit"
+)
+
+// Config is the complete runtime configuration of the API. Each leaf field
+// names its environment variable and command-line flag in struct tags; see
+// Load for the order in which the layers are applied.
+type Config struct {
+	Server    ServerConfig    `yaml:"server" toml:"server"`
+	Database  DatabaseConfig  `yaml:"database" toml:"database"`
+	Auth      AuthConfig      `yaml:"auth" toml:"auth"`
+	Scheduler SchedulerConfig `yaml:"scheduler" toml:"scheduler"`
+	Webhooks  WebhookConfig   `yaml:"webhooks" toml:"webhooks"`
+	Stream    StreamConfig    `yaml:"stream" toml:"stream"`
+	Trash     TrashConfig     `yaml:"trash" toml:"trash"`
+	RateLimit RateLimitConfig `yaml:"rate_limit" toml:"rate_limit"`
+	Log       LogConfig       `yaml:"log" toml:"log"`
+	Tracing   TracingConfig   `yaml:"tracing" toml:"tracing"`
+}
+
+// ServerConfig controls the HTTP listener
+type ServerConfig struct {
+	Addr           string        `yaml:"addr" toml:"addr" env:"TODO_ADDR" flag:"addr" usage:"HTTP listen address"`
+	CursorSecret   string        `yaml:"cursor_secret" toml:"cursor_secret" env:"TODO_CURSOR_SECRET" flag:"cursor-secret" secret:"true" usage:"key that encrypts pagination cursors (derived from the JWT secret when empty)"`
+	RequireIfMatch bool          `yaml:"require_if_match" toml:"require_if_match" env:"TODO_REQUIRE_IF_MATCH" flag:"require-if-match" usage:"reject todo updates and deletes without an If-Match header"`
+	TrustedProxies string        `yaml:"trusted_proxies" toml:"trusted_proxies" env:"TODO_TRUSTED_PROXIES" flag:"trusted-proxies" usage:"comma-separated proxy IPs or CIDRs whose X-Forwarded-For gives the client IP"`
+	DrainTimeout   time.Duration `yaml:"drain_timeout" toml:"drain_timeout" env:"TODO_DRAIN_TIMEOUT" flag:"drain-timeout" usage:"how long shutdown waits for in-flight requests and background workers"`
+	IdempotencyTTL time.Duration `yaml:"idempotency_ttl" toml:"idempotency_ttl" env:"TODO_IDEMPOTENCY_TTL" flag:"idempotency-ttl" usage:"how long the response to a request with an Idempotency-Key is replayed to retries"`
+	RequestTimeout time.Duration `yaml:"request_timeout" toml:"request_timeout" env:"TODO_REQUEST_TIMEOUT" flag:"request-timeout" usage:"how long a request with an Idempotency-Key may run before its key is free for a retry"`
+}
+
+// DatabaseConfig selects the storage engine and how to reach it
+type DatabaseConfig struct {
+	Driver         string `yaml:"driver" toml:"driver" env:"TODO_STORE" flag:"store" usage:"storage engine: postgres, sqlite or memory"`
+	URL            string `yaml:"url" toml:"url" env:"TODO_DATABASE_URL" flag:"database-url" secret:"true" usage:"Postgres connection string; overrides the db-* settings"`
+	Host           string `yaml:"host" toml:"host" env:"TODO_DB_HOST" flag:"db-host" usage:"Postgres host"`
+	Port           int    `yaml:"port" toml:"port" env:"TODO_DB_PORT" flag:"db-port" usage:"Postgres port"`
+	User           string `yaml:"user" toml:"user" env:"TODO_DB_USER" flag:"db-user" usage:"Postgres user"`
+	Password       string `yaml:"password" toml:"password" env:"TODO_DB_PASSWORD" flag:"db-password" secret:"true" usage:"Postgres password"`
+	Name           string `yaml:"name" toml:"name" env:"TODO_DB_NAME" flag:"db-name" usage:"Postgres database name"`
+	SSLMode        string `yaml:"sslmode" toml:"sslmode" env:"TODO_DB_SSLMODE" flag:"db-sslmode" usage:"Postgres sslmode"`
+	WorkerURL      string `yaml:"worker_url" toml:"worker_url" env:"TODO_DATABASE_WORKER_URL" flag:"database-worker-url" secret:"true" usage:"Postgres connection string of the worker role; overrides db-worker-user and db-worker-password"`
+	WorkerUser     string `yaml:"worker_user" toml:"worker_user" env:"TODO_DB_WORKER_USER" flag:"db-worker-user" usage:"Postgres role with BYPASSRLS that migrations and background workers connect as"`
+	WorkerPassword string `yaml:"worker_password" toml:"worker_password" env:"TODO_DB_WORKER_PASSWORD" flag:"db-worker-password" secret:"true" usage:"Postgres password of the worker role"`
+	SQLitePath     string `yaml:"sqlite_path" toml:"sqlite_path" env:"TODO_SQLITE_PATH" flag:"sqlite-path" usage:"SQLite database file"`
+	AutoMigrate    bool   `yaml:"auto_migrate" toml:"auto_migrate" env:"TODO_AUTO_MIGRATE" flag:"auto-migrate" usage:"apply pending migrations on startup"`
+}
+
+// AuthConfig controls JWT issuance and validation
+type AuthConfig struct {
+	JWTSecret     string        `yaml:"jwt_secret" toml:"jwt_secret" env:"TODO_JWT_SECRET" flag:"jwt-secret" secret:"true" usage:"HMAC key used to sign tokens (at least 32 bytes)"`
+	TokenTTL      time.Duration `yaml:"token_ttl" toml:"token_ttl" env:"TODO_TOKEN_TTL" flag:"token-ttl" usage:"lifetime of issued tokens"`
+	Admins        string        `yaml:"admins" toml:"admins" env:"TODO_ADMINS" flag:"admins" usage:"comma-separated emails whose accounts in the default tenant are made admins when they register or log in"`
+	OperatorToken string        `yaml:"operator_token" toml:"operator_token" env:"TODO_OPERATOR_TOKEN" flag:"operator-token" secret:"true" usage:"bearer token of the operators who provision and suspend tenants (at least 32 bytes; the tenant API is disabled when empty)"`
+}
+
+// SchedulerConfig controls the background job that materializes recurring todos
+type SchedulerConfig struct {
+	Interval time.Duration `yaml:"interval" toml:"interval" env:"TODO_SCHEDULER_INTERVAL" flag:"scheduler-interval" usage:"how often recurring todos are materialized"`
+	Horizon  time.Duration `yaml:"horizon" toml:"horizon" env:"TODO_SCHEDULER_HORIZON" flag:"scheduler-horizon" usage:"how far ahead occurrences of recurring todos are created"`
+}
+
+// WebhookConfig controls how webhook deliveries are sent and retried
+type WebhookConfig struct {
+	Timeout        time.Duration `yaml:"timeout" toml:"timeout" env:"TODO_WEBHOOK_TIMEOUT" flag:"webhook-timeout" usage:"timeout of one webhook delivery attempt"`
+	MaxAttempts    int           `yaml:"max_attempts" toml:"max_attempts" env:"TODO_WEBHOOK_MAX_ATTEMPTS" flag:"webhook-max-attempts" usage:"attempts before a webhook delivery becomes a dead letter"`
+	InitialBackoff time.Duration `yaml:"initial_backoff" toml:"initial_backoff" env:"TODO_WEBHOOK_INITIAL_BACKOFF" flag:"webhook-initial-backoff" usage:"delay before the first webhook retry; doubled for each further retry"`
+	MaxBackoff     time.Duration `yaml:"max_backoff" toml:"max_backoff" env:"TODO_WEBHOOK_MAX_BACKOFF" flag:"webhook-max-backoff" usage:"longest delay between webhook retries"`
+	PollInterval   time.Duration `yaml:"poll_interval" toml:"poll_interval" env:"TODO_WEBHOOK_POLL_INTERVAL" flag:"webhook-poll-interval" usage:"how often due webhook deliveries are looked for"`
+	AllowPrivate   bool          `yaml:"allow_private" toml:"allow_private" env:"TODO_WEBHOOK_ALLOW_PRIVATE" flag:"webhook-allow-private" usage:"let webhooks reach loopback, private and link-local addresses; for tests only"`
+}
+
+// StreamConfig controls the live todo change stream
+type StreamConfig struct {
+	ReplaySize   int           `yaml:"replay_size" toml:"replay_size" env:"TODO_STREAM_REPLAY_SIZE" flag:"stream-replay-size" usage:"events kept per user for clients resuming with Last-Event-ID"`
+	ReplayWindow time.Duration `yaml:"replay_window" toml:"replay_window" env:"TODO_STREAM_REPLAY_WINDOW" flag:"stream-replay-window" usage:"how long the events of a user without open streams are kept for resuming"`
+	Heartbeat    time.Duration `yaml:"heartbeat" toml:"heartbeat" env:"TODO_STREAM_HEARTBEAT" flag:"stream-heartbeat" usage:"interval between keep-alive pings on idle streams"`
+}
+
+// TrashConfig controls how long deleted todos are kept
+type TrashConfig struct {
+	Retention     time.Duration `yaml:"retention" toml:"retention" env:"TODO_TRASH_RETENTION" flag:"trash-retention" usage:"how long deleted todos stay in the trash; 0 keeps them until purged"`
+	PurgeInterval time.Duration `yaml:"purge_interval" toml:"purge_interval" env:"TODO_TRASH_PURGE_INTERVAL" flag:"trash-purge-interval" usage:"how often expired todos are purged from the trash"`
+}
+
+// RateLimitConfig controls the token buckets that limit request rates. Limits
+// are requests per period, such as 100/1m, per user or, without a valid
+// token, per client IP; empty disables a limit.
+type RateLimitConfig struct {
+	Store   string          `yaml:"store" toml:"store" env:"TODO_RATE_LIMIT_STORE" flag:"rate-limit-store" usage:"where rate limit buckets are kept: memory, or postgres to share them between instances"`
+	Auth    ratelimit.Limit `yaml:"auth" toml:"auth" env:"TODO_RATE_LIMIT_AUTH" flag:"rate-limit-auth" usage:"rate limit of registering and logging in"`
+	Todos   ratelimit.Limit `yaml:"todos" toml:"todos" env:"TODO_RATE_LIMIT_TODOS" flag:"rate-limit-todos" usage:"rate limit of the todo and trash routes"`
+	Default ratelimit.Limit `yaml:"default" toml:"default" env:"TODO_RATE_LIMIT_DEFAULT" flag:"rate-limit-default" usage:"rate limit of the other API routes"`
+}
+
+// LogConfig controls the structured log written to stderr
+type LogConfig struct {
+	Level  slog.Level `yaml:"level" toml:"level" env:"TODO_LOG_LEVEL" flag:"log-level" usage:"least severe level logged: debug, info, warn or error; debug also logs every SQL statement"`
+	Format string     `yaml:"format" toml:"format" env:"TODO_LOG_FORMAT" flag:"log-format" usage:"log format: json or text"`
+}
+
+// TracingConfig controls OpenTelemetry tracing. Sampling follows the
+// standard OTEL_TRACES_SAMPLER variables.
+type TracingConfig struct {
+	Exporter    string `yaml:"exporter" toml:"exporter" env:"TODO_TRACING_EXPORTER" flag:"tracing-exporter" usage:"where spans are sent: otlp, stdout or none"`
+	Endpoint    string `yaml:"endpoint" toml:"endpoint" env:"TODO_TRACING_ENDPOINT" flag:"tracing-endpoint" usage:"OTLP/HTTP endpoint URL; defaults to OTEL_EXPORTER_OTLP_ENDPOINT or http://localhost:4318"`
+	ServiceName string `yaml:"service_name" toml:"service_name" env:"TODO_TRACING_SERVICE_NAME" flag:"tracing-service-name" usage:"service name reported with spans"`
+}
+
+// LongestPeriod returns the longest period of the limits, after which any
+// bucket is full again
+func (r RateLimitConfig) LongestPeriod() time.Duration {
+	return max(r.Auth.Period, r.Todos.Period, r.Default.Period)
+}
+
+// Default returns the configuration used before any layer is applied
+func Default() Config {
+	return Config{
+		Server: ServerConfig{
+			Addr:           ":8080",
+			DrainTimeout:   15 * time.Second,
+			IdempotencyTTL: 24 * time.Hour,
+			RequestTimeout: time.Minute,
+		},
+		Database: DatabaseConfig{
+			Driver:     "postgres",
+			Host:       "localhost",
+			Port:       5432,
+			User:       "todo",
+			WorkerUser: "todo_worker",
+			Name:       "todo_db",
+			SSLMode:    "disable",
+			SQLitePath: "todo.db",
+		},
+		Auth: AuthConfig{
+			TokenTTL: 24 * time.Hour,
+		},
+		Scheduler: SchedulerConfig{
+			Interval: time.Minute,
+			Horizon:  24 * time.Hour,
+		},
+		Webhooks: WebhookConfig{
+			Timeout:        10 * time.Second,
+			MaxAttempts:    10,
+			InitialBackoff: 30 * time.Second,
+			MaxBackoff:     time.Hour,
+			PollInterval:   5 * time.Second,
+		},
+		Stream: StreamConfig{
+			ReplaySize:   256,
+			ReplayWindow: 15 * time.Minute,
+			Heartbeat:    15 * time.Second,
+		},
+		Trash: TrashConfig{
+			Retention:     30 * 24 * time.Hour,
+			PurgeInterval: time.Hour,
+		},
+		RateLimit: RateLimitConfig{
+			Store:   "memory",
+			Auth:    ratelimit.Limit{Requests: 20, Period: time.Minute},
+			Todos:   ratelimit.Limit{Requests: 300, Period: time.Minute},
+			Default: ratelimit.Limit{Requests: 120, Period: time.Minute},
+		},
+		Log: LogConfig{
+			Level:  slog.LevelInfo,
+			Format: "json",
+		},
+		Tracing: TracingConfig{
+			Exporter:    "none",
+			ServiceName: "gin-app",
+		},
+	}
+}
+
+// Validate reports every invalid setting at once
+func (c Config) Validate() error {
+	var errs []error
+
+	if c.Server.Addr == "" {
+		errs = append(errs, errors.New("server.addr is required"))
+	}
+	if c.Server.DrainTimeout <= 0 {
+		errs = append(errs, errors.New("server.drain_timeout must be positive"))
+	}
+	if c.Server.IdempotencyTTL <= 0 {
+		errs = append(errs, errors.New("server.idempotency_ttl must be positive"))
+	}
+	if c.Server.RequestTimeout <= 0 {
+		errs = append(errs, errors.New("server.request_timeout must be positive"))
+	}
+
+	for _, proxy := range c.Server.Proxies() {
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			errs = append(errs, fmt.Errorf("server.trusted_proxies: %q is not an IP or CIDR", proxy))
+		}
+	}
+
+	switch c.Database.Driver {
+	case "postgres":
+		if c.Database.URL == "" && c.Database.Host == "" {
+			errs = append(errs, errors.New("database.url or database.host is required for postgres"))
+		}
+		if c.Database.URL != "" && c.Database.WorkerURL == "" {
+			errs = append(errs, errors.New("database.worker_url is required with database.url"))
+		}
+		if c.Database.WorkerURL == "" && c.Database.WorkerUser == "" {
+			errs = append(errs, errors.New("database.worker_url or database.worker_user is required for postgres"))
+		}
+		if c.Database.Port <= 0 || c.Database.Port > 65535 {
+			errs = append(errs, fmt.Errorf("database.port %d is out of range", c.Database.Port))
+		}
+	case "sqlite":
+		if c.Database.SQLitePath == "" {
+			errs = append(errs, errors.New("database.sqlite_path is required for sqlite"))
+		}
+	case "memory":
+	default:
+		errs = append(errs, fmt.Errorf("database.driver %q is not one of postgres, sqlite, memory", c.Database.Driver))
+	}
+
+	if len(c.Auth.JWTSecret) < 32 {
+		errs = append(errs, errors.New("auth.jwt_secret must be at least 32 bytes"))
+	}
+	if c.Auth.TokenTTL <= 0 {
+		errs = append(errs, errors.New("auth.token_ttl must be positive"))
+	}
+	if c.Auth.OperatorToken != "" && len(c.Auth.OperatorToken) < 32 {
+		errs = append(errs, errors.New("auth.operator_token must be at least 32 bytes"))
+	}
+
+	if c.Scheduler.Interval <= 0 {
+		errs = append(errs, errors.New("scheduler.interval must be positive"))
+	}
+	if c.Scheduler.Horizon < 0 {
+		errs = append(errs, errors.New("scheduler.horizon must not be negative"))
+	}
+
+	if c.Webhooks.Timeout <= 0 || c.Webhooks.InitialBackoff <= 0 || c.Webhooks.PollInterval <= 0 {
+		errs = append(errs, errors.New("webhooks.timeout, webhooks.initial_backoff and webhooks.poll_interval must be positive"))
+	}
+	if c.Webhooks.MaxBackoff < c.Webhooks.InitialBackoff {
+		errs = append(errs, errors.New("webhooks.max_backoff must not be less than webhooks.initial_backoff"))
+	}
+	if c.Webhooks.MaxAttempts < 1 {
+		errs = append(errs, errors.New("webhooks.max_attempts must be at least 1"))
+	}
+
+	if c.Stream.ReplaySize < 0 {
+		errs = append(errs, errors.New("stream.replay_size must not be negative"))
+	}
+	if c.Stream.ReplayWindow <= 0 {
+		errs = append(errs, errors.New("stream.replay_window must be positive"))
+	}
+	if c.Stream.Heartbeat <= 0 {
+		errs = append(errs, errors.New("stream.heartbeat must be positive"))
+	}
+
+	if c.Trash.Retention < 0 {
+		errs = append(errs, errors.New("trash.retention must not be negative"))
+	}
+	if c.Trash.PurgeInterval <= 0 {
+		errs = append(errs, errors.New("trash.purge_interval must be positive"))
+	}
+
+	switch c.RateLimit.Store {
+	case "memory":
+	case "postgres":
+		if c.Database.Driver != "postgres" {
+			errs = append(errs, errors.New("rate_limit.store postgres requires database.driver postgres"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("rate_limit.store %q is not one of memory, postgres", c.RateLimit.Store))
+	}
+
+	if c.Log.Format != "json" && c.Log.Format != "text" {
+		errs = append(errs, fmt.Errorf("log.format %q is not one of json, text", c.Log.Format))
+	}
+
+	switch c.Tracing.Exporter {
+	case "none":
+	case "otlp", "stdout":
+		if c.Tracing.ServiceName == "" {
+			errs = append(errs, errors.New("tracing.service_name is required to export spans"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("tracing.exporter %q is not one of otlp, stdout, none", c.Tracing.Exporter))
+	}
+
+	return errors.Join(errs...)
+}
+
+// CursorKey returns the key that encrypts pagination cursors. Without an
+// explicit secret one is derived from the JWT secret, so the two never share
+// a key.
+func (c Config) CursorKey() []byte {
+	if c.Server.CursorSecret != "" {
+		return []byte(c.Server.CursorSecret)
+	}
+	mac := hmac.New(sha256.New, []byte(c.Auth.JWTSecret))
+	mac.Write([]byte("gin-app pagination cursor"))
+	return mac.Sum(nil)
+}
+
+// Proxies lists the trusted proxies, or nil to trust none
+func (s ServerConfig) Proxies() []string {
+	var proxies []string
+	for _, proxy := range strings.Split(s.TrustedProxies, ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
+}
+
+// IsAdmin reports whether email is one of the configured admins
+func (a AuthConfig) IsAdmin(email string) bool {
+	for _, admin := range strings.Split(a.Admins, ",") {
+		if admin = strings.TrimSpace(admin); admin != "" && strings.EqualFold(admin, email) {
+			return true
+		}
+	}
+	return false
+}
+
+// PostgresDSN returns the lib/pq connection string for the configured
+// database, as the role that serves requests
+func (d DatabaseConfig) PostgresDSN() string {
+	if d.URL != "" {
+		return d.URL
+	}
+	return d.dsn(d.User, d.Password)
+}
+
+// WorkerDSN returns the lib/pq connection string of the role that runs
+// migrations and the background workers that act for every tenant
+func (d DatabaseConfig) WorkerDSN() string {
+	if d.WorkerURL != "" {
+		return d.WorkerURL
+	}
+	return d.dsn(d.WorkerUser, d.WorkerPassword)
+}
+
+func (d DatabaseConfig) dsn(user, password string) string {
+	parts := []string{
+		"host=" + quoteDSN(d.Host),
+		fmt.Sprintf("port=%d", d.Port),
+		"user=" + quoteDSN(user),
+		"dbname=" + quoteDSN(d.Name),
+		"sslmode=" + quoteDSN(d.SSLMode),
+	}
+	if password != "" {
+		parts = append(parts, "password="+quoteDSN(password))
+	}
+	return strings.Join(parts, " ")
+}
+
+// quoteDSN quotes a key/value connection string value as lib/pq expects
+func quoteDSN(v string) string {
+	if v != "" && !strings.ContainsAny(v, ` '\`) {
+		return v
+	}
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(v) + "'"
+}
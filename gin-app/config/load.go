@@ -0,0 +1,240 @@
+package config
+
+import (
+	"encoding"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigFileEnv names the environment variable that points at a config file
+const ConfigFileEnv = "TODO_CONFIG"
+
+const redacted = "[REDACTED]"
+
+// field is one settable leaf of Config together with its struct tags
+type field struct {
+	path  string // dotted file key, e.g. "database.port"
+	value reflect.Value
+	tag   reflect.StructTag
+}
+
+// Load builds the configuration in layers, each overriding the one before:
+//
+//  1. built-in defaults
+//  2. the YAML or TOML file named by -config or TODO_CONFIG
+//  3. environment variables
+//  4. NAME_FILE environment variables, which read the value of NAME from a
+//     file, such as a mounted secret
+//  5. command-line flags
+//
+// args are the command-line arguments without the program name. The
+// arguments left over after flag parsing are returned.
+func Load(args []string) (Config, []string, error) {
+	cfg := Default()
+	fields := collectFields(reflect.ValueOf(&cfg).Elem(), "")
+
+	flags := flag.NewFlagSet("gin-app", flag.ContinueOnError)
+	configPath := flags.String("config", os.Getenv(ConfigFileEnv), "YAML or TOML configuration file")
+	flagValues := make([]*flagValue, len(fields))
+	for i, f := range fields {
+		flagValues[i] = &flagValue{isBool: f.value.Kind() == reflect.Bool}
+		flags.Var(flagValues[i], f.tag.Get("flag"), fmt.Sprintf("%s (env %s)", f.tag.Get("usage"), f.tag.Get("env")))
+	}
+	if err := flags.Parse(args); err != nil {
+		return cfg, nil, err
+	}
+
+	if *configPath != "" {
+		if err := loadFile(*configPath, fields); err != nil {
+			return cfg, nil, fmt.Errorf("config file %s: %w", *configPath, err)
+		}
+	}
+
+	for _, f := range fields {
+		raw, ok, err := lookupEnv(f.tag.Get("env"))
+		if err != nil {
+			return cfg, nil, err
+		}
+		if ok {
+			if err := setField(f.value, raw); err != nil {
+				return cfg, nil, fmt.Errorf("%s: %w", f.tag.Get("env"), err)
+			}
+		}
+	}
+
+	for i, f := range fields {
+		if flagValues[i].set {
+			if err := setField(f.value, flagValues[i].raw); err != nil {
+				return cfg, nil, fmt.Errorf("-%s: %w", f.tag.Get("flag"), err)
+			}
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return cfg, nil, fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	return cfg, flags.Args(), nil
+}
+
+// String renders the configuration with secrets redacted, so it is safe to log
+func (c Config) String() string {
+	var parts []string
+	for _, f := range collectFields(reflect.ValueOf(&c).Elem(), "") {
+		v := fmt.Sprint(f.value.Interface())
+		if f.tag.Get("secret") == "true" && v != "" {
+			v = redacted
+		}
+		parts = append(parts, f.path+"="+v)
+	}
+	return strings.Join(parts, " ")
+}
+
+// collectFields walks nested structs and returns every leaf that has an env tag
+func collectFields(v reflect.Value, prefix string) []field {
+	var fields []field
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		path := prefix + sf.Tag.Get("yaml")
+		if sf.Type.Kind() == reflect.Struct && sf.Type != reflect.TypeOf(time.Time{}) && !isText(sf.Type) {
+			fields = append(fields, collectFields(v.Field(i), path+".")...)
+			continue
+		}
+		if sf.Tag.Get("env") != "" {
+			fields = append(fields, field{path: path, value: v.Field(i), tag: sf.Tag})
+		}
+	}
+	return fields
+}
+
+// lookupEnv reads the contents of the file named by NAME_FILE, or else NAME
+func lookupEnv(name string) (string, bool, error) {
+	path, ok := os.LookupEnv(name + "_FILE")
+	if !ok {
+		value, ok := os.LookupEnv(name)
+		return value, ok, nil
+	}
+	body, err := os.ReadFile(path)
+	if err != nil {
+		return "", false, fmt.Errorf("%s_FILE: %w", name, err)
+	}
+	return strings.TrimRight(string(body), "\r\n"), true, nil
+}
+
+// loadFile applies a YAML or TOML file, chosen by extension. Unknown keys are
+// rejected so that typos do not silently fall back to defaults.
+func loadFile(path string, fields []field) error {
+	body, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	tree := map[string]interface{}{}
+	tagName := "yaml"
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(body, &tree)
+	case ".toml":
+		err = toml.Unmarshal(body, &tree)
+		tagName = "toml"
+	default:
+		return errors.New("unsupported extension (want .yaml, .yml or .toml)")
+	}
+	if err != nil {
+		return err
+	}
+
+	values := map[string]interface{}{}
+	flatten("", tree, values)
+	for _, f := range fields {
+		key := f.path
+		if tagName != "yaml" {
+			key = key[:strings.LastIndex(key, ".")+1] + f.tag.Get(tagName)
+		}
+		raw, ok := values[key]
+		if !ok {
+			continue
+		}
+		delete(values, key)
+		if err := setField(f.value, fmt.Sprint(raw)); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+	}
+	for key := range values {
+		return fmt.Errorf("unknown setting %q", key)
+	}
+	return nil
+}
+
+func flatten(prefix string, tree map[string]interface{}, out map[string]interface{}) {
+	for k, v := range tree {
+		if sub, ok := v.(map[string]interface{}); ok {
+			flatten(prefix+k+".", sub, out)
+			continue
+		}
+		out[prefix+k] = v
+	}
+}
+
+// isText reports whether settings of type t parse themselves, such as rate limits
+func isText(t reflect.Type) bool {
+	return reflect.PointerTo(t).Implements(reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem())
+}
+
+// setField parses raw into the kind of v
+func setField(v reflect.Value, raw string) error {
+	switch {
+	case isText(v.Type()):
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(raw))
+	case v.Type() == reflect.TypeOf(time.Duration(0)):
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+	case v.Kind() == reflect.String:
+		v.SetString(raw)
+	case v.Kind() == reflect.Int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(n))
+	case v.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	default:
+		return fmt.Errorf("unsupported setting type %s", v.Type())
+	}
+	return nil
+}
+
+// flagValue records a flag's raw value so it can be applied after the
+// environment layer instead of at parse time
+type flagValue struct {
+	raw    string
+	set    bool
+	isBool bool
+}
+
+func (f *flagValue) String() string { return f.raw }
+
+func (f *flagValue) Set(raw string) error {
+	f.raw, f.set = raw, true
+	return nil
+}
+
+func (f *flagValue) IsBoolFlag() bool { return f.isBool }
@@ -0,0 +1,110 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// clearEnv unsets every variable Load reads for the rest of the test
+func clearEnv(t *testing.T) {
+	cfg := Default()
+	names := []string{ConfigFileEnv}
+	for _, f := range collectFields(reflect.ValueOf(&cfg).Elem(), "") {
+		names = append(names, f.tag.Get("env"), f.tag.Get("env")+"_FILE")
+	}
+	for _, name := range names {
+		t.Setenv(name, "")
+		os.Unsetenv(name)
+	}
+}
+
+func writeFile(t *testing.T, name, body string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// TestLoadLayers gives settings to successive layers, each of which must
+// override the ones before it
+func TestLoadLayers(t *testing.T) {
+	clearEnv(t)
+	secret := func(c string) string { return strings.Repeat(c, 32) }
+	t.Setenv(ConfigFileEnv, writeFile(t, "config.yaml", `
+server:
+  addr: ":1"
+  idempotency_ttl: 1h
+log:
+  format: text
+auth:
+  jwt_secret: `+secret("f")+`
+`))
+	t.Setenv("TODO_ADDR", ":2")
+	t.Setenv("TODO_IDEMPOTENCY_TTL", "2h")
+	t.Setenv("TODO_JWT_SECRET", secret("e"))
+	t.Setenv("TODO_ADDR_FILE", writeFile(t, "addr", ":3\n"))
+	t.Setenv("TODO_JWT_SECRET_FILE", writeFile(t, "jwt", secret("s")+"\n"))
+
+	cfg, args, err := Load([]string{"-addr", ":4", "serve"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, got := range map[string][2]interface{}{
+		"default":       {cfg.Server.DrainTimeout, 15 * time.Second},
+		"file":          {cfg.Log.Format, "text"},
+		"env":           {cfg.Server.IdempotencyTTL, 2 * time.Hour},
+		"env from file": {cfg.Auth.JWTSecret, secret("s")},
+		"flag":          {cfg.Server.Addr, ":4"},
+	} {
+		if got[0] != got[1] {
+			t.Errorf("%s layer: got %v, want %v", name, got[0], got[1])
+		}
+	}
+	if !reflect.DeepEqual(args, []string{"serve"}) {
+		t.Errorf("left over arguments %q", args)
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("TODO_JWT_SECRET", strings.Repeat("k", 32))
+
+	cfg, _, err := Load([]string{"-config", writeFile(t, "config.toml", "[server]\naddr = \":9\"\n[rate_limit]\ntodos = \"5/m\"\n")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server.Addr != ":9" || cfg.RateLimit.Todos.String() != "5/1m" {
+		t.Errorf("from TOML: addr %q, todos limit %v", cfg.Server.Addr, cfg.RateLimit.Todos)
+	}
+
+	for name, body := range map[string]string{
+		"config.yaml": "server:\n  adr: \":9\"\n",
+		"config.json": "{}",
+		"bad.yaml":    "server:\n  drain_timeout: soon\n",
+	} {
+		if _, _, err := Load([]string{"-config", writeFile(t, name, body)}); err == nil {
+			t.Errorf("%s: no error for %q", name, body)
+		}
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("TODO_JWT_SECRET", "short")
+	t.Setenv("TODO_STORE", "sqlite")
+	t.Setenv("TODO_SQLITE_PATH", "")
+	_, _, err := Load(nil)
+	if err == nil || !strings.Contains(err.Error(), "jwt_secret") || !strings.Contains(err.Error(), "sqlite_path") {
+		t.Errorf("got %v, want every invalid setting reported", err)
+	}
+
+	t.Setenv("TODO_JWT_SECRET_FILE", filepath.Join(t.TempDir(), "missing"))
+	if _, _, err := Load(nil); err == nil || !strings.Contains(err.Error(), "TODO_JWT_SECRET_FILE") {
+		t.Errorf("got %v for a missing secret file", err)
+	}
+}
@@ -0,0 +1,117 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"gin-app/middleware"
+	"gin-app/models"
+	"gin-app/repository"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type AdminControllerType struct {
+	Users repository.UserRepository
+}
+
+func AdminController(users repository.UserRepository) *AdminControllerType {
+	return &AdminControllerType{Users: users}
+}
+
+// GetUsers returns every account
+func (ac *AdminControllerType) GetUsers(c *gin.Context) {
+	users, err := ac.Users.List(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, users)
+}
+
+// CreateUser adds an account to the admin's tenant, a member unless the
+// input says otherwise
+func (ac *AdminControllerType) CreateUser(c *gin.Context) {
+	var input models.NewUser
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	user := models.User{
+		TenantID:     c.GetInt(middleware.TenantIDKey),
+		Email:        normalizeEmail(input.Email),
+		PasswordHash: string(hash),
+		Timezone:     "UTC",
+		Role:         input.Role,
+	}
+	if err := ac.Users.Create(c.Request.Context(), &user); err != nil {
+		if errors.Is(err, repository.ErrDuplicate) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Email is already registered"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, user)
+}
+
+func (ac *AdminControllerType) GetUser(c *gin.Context) {
+	id, ok := userID(c)
+	if !ok {
+		return
+	}
+
+	user, err := ac.Users.Get(c.Request.Context(), id)
+	if err != nil {
+		respondUserError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// SetUserRole changes the role of an account, which applies to its next
+// request, tokens issued before included. Admins cannot change their own
+// role, so that there is always one left.
+func (ac *AdminControllerType) SetUserRole(c *gin.Context) {
+	id, ok := userID(c)
+	if !ok {
+		return
+	}
+	var input models.UserRole
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if id == c.GetInt(middleware.UserIDKey) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Admins cannot change their own role"})
+		return
+	}
+
+	if err := ac.Users.SetRole(c.Request.Context(), id, input.Role); err != nil {
+		respondUserError(c, err)
+		return
+	}
+
+	ac.GetUser(c)
+}
+
+func userID(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user id"})
+		return 0, false
+	}
+	return id, true
+}
@@ -0,0 +1,140 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"gin-app/config"
+	"gin-app/middleware"
+	"gin-app/models"
+	"gin-app/repository"
+	"gin-app/tenant"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type AuthControllerType struct {
+	Users   repository.UserRepository
+	Tenants repository.TenantRepository
+	Auth    config.AuthConfig
+}
+
+func AuthController(users repository.UserRepository, tenants repository.TenantRepository, auth config.AuthConfig) *AuthControllerType {
+	return &AuthControllerType{Users: users, Tenants: tenants, Auth: auth}
+}
+
+// Register opens an account in the default tenant
+func (ac *AuthControllerType) Register(c *gin.Context) {
+	var creds models.Credentials
+	if err := c.ShouldBindJSON(&creds); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	t, err := ac.Tenants.GetByName(c.Request.Context(), tenantName(creds))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Tenant not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if t.ID != tenant.Default {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Accounts of this tenant are added by its admins"})
+		return
+	}
+	if t.SuspendedAt != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Tenant is suspended"})
+		return
+	}
+	ctx := tenant.With(c.Request.Context(), t.ID)
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(creds.Password), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	user := models.User{TenantID: t.ID, Email: normalizeEmail(creds.Email), PasswordHash: string(hash), Timezone: "UTC", Role: models.AccountMember}
+	if ac.Auth.IsAdmin(user.Email) {
+		user.Role = models.AccountAdmin
+	}
+	if err := ac.Users.Create(ctx, &user); err != nil {
+		if errors.Is(err, repository.ErrDuplicate) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Email is already registered"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	token, err := middleware.GenerateToken(ac.Auth, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"user": user, "token": token})
+}
+
+// Login issues a token to an account of the tenant named in the
+// credentials
+func (ac *AuthControllerType) Login(c *gin.Context) {
+	var creds models.Credentials
+	if err := c.ShouldBindJSON(&creds); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user models.User
+	t, err := ac.Tenants.GetByName(c.Request.Context(), tenantName(creds))
+	if err == nil {
+		user, err = ac.Users.GetByEmail(tenant.With(c.Request.Context(), t.ID), normalizeEmail(creds.Email))
+	}
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Unknown tenants, unknown emails and wrong passwords get the same response
+	if err != nil || bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(creds.Password)) != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+		return
+	}
+	if t.SuspendedAt != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Tenant is suspended"})
+		return
+	}
+	ctx := tenant.With(c.Request.Context(), t.ID)
+
+	// Configured admins of the default tenant are promoted on their next login
+	if t.ID == tenant.Default && ac.Auth.IsAdmin(user.Email) && user.Role != models.AccountAdmin {
+		if err := ac.Users.SetRole(ctx, user.ID, models.AccountAdmin); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		user.Role = models.AccountAdmin
+	}
+
+	token, err := middleware.GenerateToken(ac.Auth, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user": user, "token": token})
+}
+
+func tenantName(creds models.Credentials) string {
+	if creds.Tenant == "" {
+		return models.DefaultTenant
+	}
+	return creds.Tenant
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
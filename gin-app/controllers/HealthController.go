@@ -0,0 +1,67 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"time"
+
+	"gin-app/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+// readyTimeout bounds the database checks of a readiness probe
+const readyTimeout = 2 * time.Second
+
+type HealthControllerType struct {
+	DB       *sql.DB
+	Migrator *database.Migrator
+	// err is why the migrations cannot be checked, if they cannot
+	err error
+}
+
+// HealthController checks the database open with dialect, or nothing when
+// db is nil, as with the memory store
+func HealthController(db *sql.DB, dialect string) *HealthControllerType {
+	hc := &HealthControllerType{DB: db}
+	if db != nil {
+		hc.Migrator, hc.err = database.NewMigrator(db, dialect)
+	}
+	return hc
+}
+
+// Live answers as long as the process serves requests
+func (hc *HealthControllerType) Live(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Ready answers 503 while the database is unreachable or its schema is
+// behind the binary, so that no traffic is routed to this instance
+func (hc *HealthControllerType) Ready(c *gin.Context) {
+	if hc.DB == nil {
+		c.JSON(http.StatusOK, gin.H{"status": "ready"})
+		return
+	}
+	if hc.err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Cannot check migrations: " + hc.err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), readyTimeout)
+	defer cancel()
+	if err := hc.DB.PingContext(ctx); err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database is unreachable"})
+		return
+	}
+	pending, err := hc.Migrator.Pending(ctx)
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Cannot check migrations: " + err.Error()})
+		return
+	}
+	if len(pending) > 0 {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Migrations are pending", "pending": len(pending)})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ready"})
+}
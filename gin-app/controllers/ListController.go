@@ -0,0 +1,390 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"gin-app/middleware"
+	"gin-app/models"
+	"gin-app/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+// roleRank orders list roles; each role can do what the ones below it can
+var roleRank = map[string]int{
+	models.RoleViewer: 1,
+	models.RoleEditor: 2,
+	models.RoleOwner:  3,
+}
+
+// hasRole reports whether role grants what need does
+func hasRole(role, need string) bool {
+	return roleRank[role] >= roleRank[need]
+}
+
+type ListControllerType struct {
+	Lists repository.ListRepository
+	Users repository.UserRepository
+}
+
+func ListController(lists repository.ListRepository, users repository.UserRepository) *ListControllerType {
+	return &ListControllerType{Lists: lists, Users: users}
+}
+
+// GetLists returns the lists the caller owns or is a member of
+func (lc *ListControllerType) GetLists(c *gin.Context) {
+	lists, err := lc.Lists.List(c.Request.Context(), c.GetInt(middleware.UserIDKey))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, lists)
+}
+
+func (lc *ListControllerType) CreateList(c *gin.Context) {
+	input, ok := bindListInput(c)
+	if !ok {
+		return
+	}
+
+	list := models.List{OwnerID: c.GetInt(middleware.UserIDKey), Name: input.Name}
+	if err := lc.Lists.Create(c.Request.Context(), &list); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, list)
+}
+
+func (lc *ListControllerType) GetList(c *gin.Context) {
+	list, ok := lc.list(c, models.RoleViewer)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, list)
+}
+
+func (lc *ListControllerType) RenameList(c *gin.Context) {
+	list, ok := lc.list(c, models.RoleOwner)
+	if !ok {
+		return
+	}
+	input, ok := bindListInput(c)
+	if !ok {
+		return
+	}
+
+	if err := lc.Lists.Rename(c.Request.Context(), list.ID, input.Name); err != nil {
+		respondListError(c, err)
+		return
+	}
+	list.Name = input.Name
+
+	c.JSON(http.StatusOK, list)
+}
+
+// DeleteList removes a list. Only the account that owns it can, and its
+// todos stay with that account outside of any list.
+func (lc *ListControllerType) DeleteList(c *gin.Context) {
+	list, ok := lc.list(c, models.RoleOwner)
+	if !ok {
+		return
+	}
+	if list.OwnerID != c.GetInt(middleware.UserIDKey) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the creator of the list can delete it"})
+		return
+	}
+
+	if err := lc.Lists.Delete(c.Request.Context(), list.ID); err != nil {
+		respondListError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "List deleted successfully"})
+}
+
+func (lc *ListControllerType) GetMembers(c *gin.Context) {
+	list, ok := lc.list(c, models.RoleViewer)
+	if !ok {
+		return
+	}
+
+	members, err := lc.Lists.Members(c.Request.Context(), list.ID)
+	if err != nil {
+		respondListError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, members)
+}
+
+func (lc *ListControllerType) SetMemberRole(c *gin.Context) {
+	list, ok := lc.list(c, models.RoleOwner)
+	if !ok {
+		return
+	}
+	userID, ok := memberID(c, list)
+	if !ok {
+		return
+	}
+	var input models.MemberRole
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := lc.Lists.SetRole(c.Request.Context(), list.ID, userID, input.Role); err != nil {
+		respondMemberError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Member role updated successfully"})
+}
+
+// RemoveMember takes someone off a list. Owners can remove anyone but the
+// creator of the list, and every member can remove themselves.
+func (lc *ListControllerType) RemoveMember(c *gin.Context) {
+	list, ok := lc.list(c, models.RoleViewer)
+	if !ok {
+		return
+	}
+	userID, ok := memberID(c, list)
+	if !ok {
+		return
+	}
+	if userID != c.GetInt(middleware.UserIDKey) && !hasRole(list.Role, models.RoleOwner) {
+		respondForbidden(c, models.RoleOwner)
+		return
+	}
+
+	if err := lc.Lists.RemoveMember(c.Request.Context(), list.ID, userID); err != nil {
+		respondMemberError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Member removed successfully"})
+}
+
+// CreateInvite invites an email address to the list with a role. The
+// invitation waits for that address to register, if it has not.
+func (lc *ListControllerType) CreateInvite(c *gin.Context) {
+	list, ok := lc.list(c, models.RoleOwner)
+	if !ok {
+		return
+	}
+	var input models.Invitation
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	invite := models.ListInvite{
+		ListID:    list.ID,
+		Email:     normalizeEmail(input.Email),
+		Role:      input.Role,
+		InvitedBy: c.GetInt(middleware.UserIDKey),
+	}
+	if err := lc.Lists.Invite(c.Request.Context(), &invite); err != nil {
+		respondListError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, invite)
+}
+
+func (lc *ListControllerType) GetInvites(c *gin.Context) {
+	list, ok := lc.list(c, models.RoleOwner)
+	if !ok {
+		return
+	}
+
+	invites, err := lc.Lists.Invites(c.Request.Context(), list.ID)
+	if err != nil {
+		respondListError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, invites)
+}
+
+func (lc *ListControllerType) RevokeInvite(c *gin.Context) {
+	list, ok := lc.list(c, models.RoleOwner)
+	if !ok {
+		return
+	}
+	inviteID, err := strconv.Atoi(c.Param("invite_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invite id"})
+		return
+	}
+
+	if err := lc.Lists.RevokeInvite(c.Request.Context(), list.ID, inviteID); err != nil {
+		respondInviteError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Invite revoked successfully"})
+}
+
+// GetInvitations returns the invitations waiting for the caller's email
+func (lc *ListControllerType) GetInvitations(c *gin.Context) {
+	user, ok := lc.caller(c)
+	if !ok {
+		return
+	}
+
+	invites, err := lc.Lists.Invitations(c.Request.Context(), user.Email)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, invites)
+}
+
+// AcceptInvite joins the list of an invitation to the caller and returns it
+func (lc *ListControllerType) AcceptInvite(c *gin.Context) {
+	id, ok := inviteID(c)
+	if !ok {
+		return
+	}
+	user, ok := lc.caller(c)
+	if !ok {
+		return
+	}
+
+	list, err := lc.Lists.Accept(c.Request.Context(), user, id)
+	if err != nil {
+		respondInviteError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, list)
+}
+
+func (lc *ListControllerType) DeclineInvite(c *gin.Context) {
+	id, ok := inviteID(c)
+	if !ok {
+		return
+	}
+	user, ok := lc.caller(c)
+	if !ok {
+		return
+	}
+
+	if err := lc.Lists.Decline(c.Request.Context(), user.Email, id); err != nil {
+		respondInviteError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Invite declined"})
+}
+
+// list loads the :id list with the caller's role on it, writing 404 when
+// the caller is not a member and 403 when their role is below need
+func (lc *ListControllerType) list(c *gin.Context, need string) (models.List, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid list id"})
+		return models.List{}, false
+	}
+	list, err := lc.Lists.Get(c.Request.Context(), c.GetInt(middleware.UserIDKey), id)
+	if err != nil {
+		respondListError(c, err)
+		return models.List{}, false
+	}
+	if !hasRole(list.Role, need) {
+		respondForbidden(c, need)
+		return models.List{}, false
+	}
+	return list, true
+}
+
+// caller loads the authenticated user, whose email invitations are addressed to
+func (lc *ListControllerType) caller(c *gin.Context) (models.User, bool) {
+	user, err := lc.Users.Get(c.Request.Context(), c.GetInt(middleware.UserIDKey))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return user, false
+	}
+	return user, true
+}
+
+func bindListInput(c *gin.Context) (models.ListInput, bool) {
+	var input models.ListInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return input, false
+	}
+	input.Name = strings.TrimSpace(input.Name)
+	if input.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "List name must not be blank"})
+		return input, false
+	}
+	return input, true
+}
+
+// memberID parses the :user_id path parameter. The creator of a list is
+// always its owner, so their membership cannot be changed.
+func memberID(c *gin.Context, list models.List) (int, bool) {
+	id, err := strconv.Atoi(c.Param("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user id"})
+		return 0, false
+	}
+	if id == list.OwnerID {
+		c.JSON(http.StatusConflict, gin.H{"error": "The creator of a list stays its owner"})
+		return 0, false
+	}
+	return id, true
+}
+
+func inviteID(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invite id"})
+		return 0, false
+	}
+	return id, true
+}
+
+// respondForbidden writes 403 for a caller whose role on a list is below need
+func respondForbidden(c *gin.Context, need string) {
+	c.JSON(http.StatusForbidden, gin.H{"error": forbiddenMessage(need)})
+}
+
+func forbiddenMessage(need string) string {
+	return "Requires the " + need + " role on the list"
+}
+
+func respondListError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "List not found"})
+	case errors.Is(err, repository.ErrDuplicate):
+		c.JSON(http.StatusConflict, gin.H{"error": "That email is already a member or invited"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+func respondMemberError(c *gin.Context, err error) {
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Member not found"})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
+
+func respondInviteError(c *gin.Context, err error) {
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invite not found"})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
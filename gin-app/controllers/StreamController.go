@@ -0,0 +1,176 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"gin-app/middleware"
+	"gin-app/stream"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// resetEvent tells a resuming client that the events it missed are no longer
+// buffered and it should reload its todos
+const resetEvent = "reset"
+
+// writeWait bounds how long a write to a stream client may block
+const writeWait = 10 * time.Second
+
+var upgrader = websocket.Upgrader{
+	// Streams authenticate with a bearer token rather than cookies, so other
+	// origins cannot ride on a user's session
+	CheckOrigin: func(*http.Request) bool { return true },
+}
+
+type StreamControllerType struct {
+	Hub       *stream.Hub
+	Heartbeat time.Duration
+}
+
+func StreamController(hub *stream.Hub, heartbeat time.Duration) *StreamControllerType {
+	return &StreamControllerType{Hub: hub, Heartbeat: heartbeat}
+}
+
+// Stream pushes the user's todo events as Server-Sent Events, or as JSON
+// messages when the request is a WebSocket upgrade. Clients resume with the
+// Last-Event-ID header or ?last_event_id=.
+func (sc *StreamControllerType) Stream(c *gin.Context) {
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("last_event_id")
+	}
+
+	if websocket.IsWebSocketUpgrade(c.Request) {
+		sc.streamWebSocket(c, lastEventID)
+		return
+	}
+	sc.streamSSE(c, lastEventID)
+}
+
+func (sc *StreamControllerType) streamSSE(c *gin.Context, lastEventID string) {
+	sub, replay, reset := sc.Hub.Subscribe(c.GetInt(middleware.UserIDKey), lastEventID)
+	defer sub.Close()
+
+	header := c.Writer.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	header.Set("X-Accel-Buffering", "no")
+	c.Writer.WriteHeader(http.StatusOK)
+
+	if reset {
+		fmt.Fprintf(c.Writer, "event: %s\ndata: {}\n\n", resetEvent)
+	}
+	for _, msg := range replay {
+		if writeSSE(c.Writer, msg) != nil {
+			return
+		}
+	}
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(sc.Heartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case msg, ok := <-sub.C:
+			// A closed subscription fell behind or the server is shutting
+			// down; the client resumes from the replay buffer when it
+			// reconnects
+			if !ok || writeSSE(c.Writer, msg) != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := io.WriteString(c.Writer, ": ping\n\n"); err != nil {
+				return
+			}
+		}
+		c.Writer.Flush()
+	}
+}
+
+func writeSSE(w io.Writer, msg stream.Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", msg.ID, msg.Type, data)
+	return err
+}
+
+func (sc *StreamControllerType) streamWebSocket(c *gin.Context, lastEventID string) {
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// Upgrade has already answered the request
+		return
+	}
+	defer conn.Close()
+
+	sub, replay, reset := sc.Hub.Subscribe(c.GetInt(middleware.UserIDKey), lastEventID)
+	defer sub.Close()
+
+	// Read only to process pongs and notice the client going away
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		conn.SetReadLimit(512)
+		conn.SetReadDeadline(time.Now().Add(2 * sc.Heartbeat))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(2 * sc.Heartbeat))
+		})
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	send := func(v interface{}) error {
+		conn.SetWriteDeadline(time.Now().Add(writeWait))
+		return conn.WriteJSON(v)
+	}
+
+	if reset {
+		if send(gin.H{"event": resetEvent}) != nil {
+			return
+		}
+	}
+	for _, msg := range replay {
+		if send(msg) != nil {
+			return
+		}
+	}
+
+	heartbeat := time.NewTicker(sc.Heartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case msg, ok := <-sub.C:
+			if !ok {
+				closing := websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "too far behind, resume with last_event_id")
+				if sc.Hub.Closed() {
+					closing = websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down, resume with last_event_id")
+				}
+				conn.WriteControl(websocket.CloseMessage, closing, time.Now().Add(writeWait))
+				return
+			}
+			if send(msg) != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait)) != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"gin-app/middleware"
+	"gin-app/models"
+	"gin-app/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+type TagControllerType struct {
+	Tags repository.TagRepository
+}
+
+func TagController(tags repository.TagRepository) *TagControllerType {
+	return &TagControllerType{Tags: tags}
+}
+
+func (tc *TagControllerType) GetTags(c *gin.Context) {
+	tags, err := tc.Tags.List(c.Request.Context(), c.GetInt(middleware.UserIDKey))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, tags)
+}
+
+func (tc *TagControllerType) RenameTag(c *gin.Context) {
+	id, ok := tagID(c)
+	if !ok {
+		return
+	}
+	var rename models.TagRename
+	if err := c.ShouldBindJSON(&rename); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if repository.NormalizeTag(rename.Name) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Tag name must not be blank"})
+		return
+	}
+
+	tag, err := tc.Tags.Rename(c.Request.Context(), c.GetInt(middleware.UserIDKey), id, rename.Name)
+	if err != nil {
+		respondTagError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, tag)
+}
+
+// MergeTags retags every todo carrying :id with the "into" tag and deletes :id
+func (tc *TagControllerType) MergeTags(c *gin.Context) {
+	id, ok := tagID(c)
+	if !ok {
+		return
+	}
+	var merge models.TagMerge
+	if err := c.ShouldBindJSON(&merge); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if merge.Into == id {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot merge a tag into itself"})
+		return
+	}
+
+	tag, err := tc.Tags.Merge(c.Request.Context(), c.GetInt(middleware.UserIDKey), id, merge.Into)
+	if err != nil {
+		respondTagError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, tag)
+}
+
+func tagID(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tag id"})
+		return 0, false
+	}
+	return id, true
+}
+
+func respondTagError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tag not found"})
+	case errors.Is(err, repository.ErrDuplicate):
+		c.JSON(http.StatusConflict, gin.H{"error": "A tag with that name already exists; merge the tags instead"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
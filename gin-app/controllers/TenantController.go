@@ -0,0 +1,119 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"gin-app/models"
+	"gin-app/repository"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type TenantControllerType struct {
+	Tenants repository.TenantRepository
+}
+
+func TenantController(tenants repository.TenantRepository) *TenantControllerType {
+	return &TenantControllerType{Tenants: tenants}
+}
+
+func (tc *TenantControllerType) GetTenants(c *gin.Context) {
+	tenants, err := tc.Tenants.List(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, tenants)
+}
+
+func (tc *TenantControllerType) GetTenant(c *gin.Context) {
+	id, ok := tenantID(c)
+	if !ok {
+		return
+	}
+
+	t, err := tc.Tenants.Get(c.Request.Context(), id)
+	if err != nil {
+		respondTenantError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, t)
+}
+
+// CreateTenant provisions a tenant along with its first account, an admin
+// who can then add the others
+func (tc *TenantControllerType) CreateTenant(c *gin.Context) {
+	var input models.TenantInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(input.AdminPassword), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	t := models.Tenant{Name: input.Name}
+	admin := models.User{Email: normalizeEmail(input.AdminEmail), PasswordHash: string(hash), Timezone: "UTC", Role: models.AccountAdmin}
+	if err := tc.Tenants.Create(c.Request.Context(), &t, &admin); err != nil {
+		respondTenantError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"tenant": t, "admin": admin})
+}
+
+// SuspendTenant locks the accounts of a tenant out, tokens already issued
+// included, while keeping its data
+func (tc *TenantControllerType) SuspendTenant(c *gin.Context) {
+	tc.setSuspended(c, true)
+}
+
+func (tc *TenantControllerType) ResumeTenant(c *gin.Context) {
+	tc.setSuspended(c, false)
+}
+
+func (tc *TenantControllerType) setSuspended(c *gin.Context, suspended bool) {
+	id, ok := tenantID(c)
+	if !ok {
+		return
+	}
+
+	t, err := tc.Tenants.SetSuspended(c.Request.Context(), id, suspended)
+	if err != nil {
+		respondTenantError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, t)
+}
+
+func tenantID(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tenant id"})
+		return 0, false
+	}
+	return id, true
+}
+
+// respondTenantError maps repository errors to HTTP responses
+func respondTenantError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tenant not found"})
+	case errors.Is(err, repository.ErrDuplicate):
+		c.JSON(http.StatusConflict, gin.H{"error": "Tenant name is already taken"})
+	case errors.Is(err, repository.ErrTenantsUnsupported):
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "Tenants can only be provisioned with the postgres store"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
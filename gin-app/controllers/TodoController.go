@@ -1,91 +1,1233 @@
 package controllers
 
 import (
-	"database/sql"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
+	"gin-app/events"
+	"gin-app/exchange"
+	"gin-app/logging"
+	"gin-app/middleware"
 	"gin-app/models"
+	"gin-app/recurrence"
+	"gin-app/repository"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 )
 
+// Page sizes for GET /todos
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+// Limits of POST /todos/import
+const (
+	maxImportSize = 5 << 20
+	maxImportRows = 5000
+)
+
+// TodoControllerType serves todos to their owner and to the members of the
+// lists they are in. Todos stay stored under the owning account, so every
+// operation on an existing todo first resolves that account and the caller's
+// role: viewers read, editors change, and purging takes an owner.
 type TodoControllerType struct {
-	DB *sql.DB
+	Todos     repository.TodoRepository
+	History   repository.HistoryRepository
+	Lists     repository.ListRepository
+	CursorKey []byte
+	Scheduler *recurrence.Scheduler
+	Events    *events.Bus
+	// RequireIfMatch rejects updates and deletes without an If-Match header
+	RequireIfMatch bool
 }
 
-func TodoController(db *sql.DB) *TodoControllerType {
-	return &TodoControllerType{DB: db}
+func TodoController(todos repository.TodoRepository, history repository.HistoryRepository, lists repository.ListRepository, cursorKey []byte, scheduler *recurrence.Scheduler, bus *events.Bus, requireIfMatch bool) *TodoControllerType {
+	return &TodoControllerType{Todos: todos, History: history, Lists: lists, CursorKey: cursorKey, Scheduler: scheduler, Events: bus, RequireIfMatch: requireIfMatch}
 }
 
+// GetTodos lists the caller's todos, or with list_id=<id> the todos of a
+// list the caller is a member of, one page at a time. Query parameters:
+// completed=true|false, q=<title substring>, tag=<name> (repeatable, all
+// must match), priority=0..3, due_after/due_before=<RFC 3339>, overdue=true,
+// sort=id|title|created_at, order=asc|desc, limit=1..200 and
+// cursor=<next_cursor of the previous page>. The page carries a weak ETag
+// and If-None-Match gives 304 while it is unchanged.
 func (tc *TodoControllerType) GetTodos(c *gin.Context) {
-	rows, err := tc.DB.Query("SELECT id, title, completed FROM todos")
+	query, filter, ok := tc.todoQuery(c)
+	if !ok {
+		return
+	}
+
+	ownerID := c.GetInt(middleware.UserIDKey)
+	if query.ListID != nil {
+		list, err := tc.Lists.Get(c.Request.Context(), ownerID, *query.ListID)
+		if err != nil {
+			respondListError(c, err)
+			return
+		}
+		ownerID = list.OwnerID
+	}
+
+	tc.respondTodoPage(c, ownerID, query, filter)
+}
+
+// GetAllTodos lists the todos of every account, for admins. It takes the
+// filters and cursors of GetTodos.
+func (tc *TodoControllerType) GetAllTodos(c *gin.Context) {
+	query, filter, ok := tc.todoQuery(c)
+	if !ok {
+		return
+	}
+	query.AllUsers = true
+
+	tc.respondTodoPage(c, 0, query, filter)
+}
+
+// todoQuery parses the filters and cursor of a todo listing, writing 400
+// when they are invalid
+func (tc *TodoControllerType) todoQuery(c *gin.Context) (repository.TodoQuery, string, bool) {
+	query, filter, err := parseTodoQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return query, filter, false
+	}
+
+	if token := c.Query("cursor"); token != "" {
+		cursor, err := decodeCursor(tc.CursorKey, token)
+		if err != nil || cursor.Sort != query.Sort || cursor.Desc != query.Desc || cursor.Filter != filter {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+			return query, filter, false
+		}
+		query.After = &cursor.Position
+	}
+	return query, filter, true
+}
+
+// respondTodoPage writes a page of the todos of ownerID matching query,
+// with the cursor of the next page
+func (tc *TodoControllerType) respondTodoPage(c *gin.Context, ownerID int, query repository.TodoQuery, filter string) {
+	todos, more, err := tc.Todos.List(c.Request.Context(), ownerID, query)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	defer rows.Close()
 
-	var todos []models.Todo
-	for rows.Next() {
-		var todo models.Todo
-		if err := rows.Scan(&todo.ID, &todo.Title, &todo.Completed); err != nil {
+	var next *string
+	if more {
+		token, err := encodeCursor(tc.CursorKey, cursorPayload{
+			Sort:     query.Sort,
+			Desc:     query.Desc,
+			Filter:   filter,
+			Position: repository.CursorFor(todos[len(todos)-1]),
+		})
+		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
-		todos = append(todos, todo)
+		next = &token
 	}
 
-	c.JSON(http.StatusOK, todos)
+	body, err := json.Marshal(gin.H{"data": todos, "next_cursor": next})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	etag := bodyETag(body)
+	c.Header("ETag", etag)
+	if etagMatches(c.GetHeader("If-None-Match"), etag, true) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	c.Data(http.StatusOK, "application/json; charset=utf-8", body)
 }
 
+// GetTodo returns one todo with its version as ETag; If-None-Match gives 304
+// while it is unchanged
+func (tc *TodoControllerType) GetTodo(c *gin.Context) {
+	id, ok := todoID(c)
+	if !ok {
+		return
+	}
+
+	ownerID, ok := tc.access(c, id, models.RoleViewer)
+	if !ok {
+		return
+	}
+	todo, err := tc.Todos.Get(c.Request.Context(), ownerID, id)
+	if err != nil {
+		respondRepositoryError(c, err)
+		return
+	}
+
+	etag := todoETag(todo)
+	c.Header("ETag", etag)
+	if etagMatches(c.GetHeader("If-None-Match"), etag, true) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	c.JSON(http.StatusOK, todo)
+}
+
+// CreateTodo adds a todo to the caller's account, or to a list with
+// list_id. A subtask goes in its parent's list.
 func (tc *TodoControllerType) CreateTodo(c *gin.Context) {
 	var todo models.Todo
 	if err := c.ShouldBindJSON(&todo); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-
-	result, err := tc.DB.Exec("INSERT INTO todos (title, completed) VALUES (?, ?)", todo.Title, todo.Completed)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if err := validateRecurrence(todo); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var ok bool
+	if todo.UserID, ok = tc.newTodoOwner(c, todo); !ok {
 		return
 	}
 
-	id, err := result.LastInsertId()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if err := tc.Todos.Create(c.Request.Context(), &todo); err != nil {
+		respondRepositoryError(c, err)
 		return
 	}
+	tc.advance(c, todo)
+	tc.Events.Publish(c.Request.Context(), events.New(events.TodoCreated, todo))
 
-	todo.ID = int(id)
+	c.Header("ETag", todoETag(todo))
 	c.JSON(http.StatusCreated, todo)
 }
 
+// UpdateTodo replaces a todo. Completing a todo with open subtasks fails
+// with 409 unless children=complete is given, which completes them too.
+// With If-Match the update only applies to that version of the todo.
 func (tc *TodoControllerType) UpdateTodo(c *gin.Context) {
-	id := c.Param("id")
+	id, ok := todoID(c)
+	if !ok {
+		return
+	}
+	var opts repository.UpdateOptions
+	if opts.CompleteChildren, ok = completeChildren(c); !ok {
+		return
+	}
 	var todo models.Todo
 	if err := c.ShouldBindJSON(&todo); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	todo.ID = id
+	if err := validateRecurrence(todo); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-	_, err := tc.DB.Exec("UPDATE todos SET title = ?, completed = ? WHERE id = ?", todo.Title, todo.Completed, id)
+	// Someone else's todo outside a shared list looks exactly like a missing one
+	if todo.UserID, ok = tc.access(c, id, models.RoleEditor); !ok {
+		return
+	}
+	if status, err := tc.checkNewParent(c, todo.UserID, todo); err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	before, err := tc.Todos.Get(c.Request.Context(), todo.UserID, id)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondRepositoryError(c, err)
 		return
 	}
+	if opts.Version, ok = tc.checkIfMatch(c, before); !ok {
+		return
+	}
+	if err := tc.Todos.Update(c.Request.Context(), &todo, opts); err != nil {
+		tc.respondWriteError(c, todo.UserID, id, err)
+		return
+	}
+	tc.advance(c, todo)
+	tc.publishUpdate(c, before, todo)
 
+	c.Header("ETag", todoETag(todo))
 	c.JSON(http.StatusOK, gin.H{"message": "Todo updated successfully"})
 }
 
+// DeleteTodo moves a todo and its subtasks to the trash, honoring If-Match
+// like UpdateTodo
 func (tc *TodoControllerType) DeleteTodo(c *gin.Context) {
-	id := c.Param("id")
+	id, ok := todoID(c)
+	if !ok {
+		return
+	}
+
+	userID, ok := tc.access(c, id, models.RoleEditor)
+	if !ok {
+		return
+	}
+	todo, err := tc.Todos.Get(c.Request.Context(), userID, id)
+	if err != nil {
+		respondRepositoryError(c, err)
+		return
+	}
+	version, ok := tc.checkIfMatch(c, todo)
+	if !ok {
+		return
+	}
+	_, err = tc.Todos.Delete(c.Request.Context(), userID, id, version)
+	if err != nil {
+		tc.respondWriteError(c, userID, id, err)
+		return
+	}
+	tc.Events.Publish(c.Request.Context(), events.New(events.TodoDeleted, todo))
+
+	c.JSON(http.StatusOK, gin.H{"message": "Todo moved to trash"})
+}
+
+// BatchTodos applies a list of creates, updates and deletes. An atomic batch,
+// the default, applies all of them in one transaction or none, and fails
+// with the status of the first failing operation and its index. A
+// best_effort batch applies what it can and reports each outcome. Each
+// operation takes the role on its todo that it would take on its own.
+func (tc *TodoControllerType) BatchTodos(c *gin.Context) {
+	var batch models.Batch
+	if err := c.ShouldBindJSON(&batch); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	atomic := batch.Mode != models.BatchBestEffort
+
+	// indexes maps the operations passed to the repository back to the
+	// batch, as invalid ones of a best-effort batch are left out
+	results := make([]models.BatchResult, len(batch.Operations))
+	ops := []repository.BatchOp{}
+	indexes := []int{}
+	for i, operation := range batch.Operations {
+		results[i] = models.BatchResult{Index: i, Op: operation.Op}
+		op, status, err := tc.batchOp(c, operation)
+		if err != nil {
+			if atomic {
+				c.JSON(status, gin.H{"error": err.Error(), "index": i})
+				return
+			}
+			results[i].Status, results[i].Error = status, err.Error()
+			continue
+		}
+		ops = append(ops, op)
+		indexes = append(indexes, i)
+	}
+
+	applied, err := tc.Todos.Batch(c.Request.Context(), c.GetInt(middleware.UserIDKey), ops, atomic)
+	var batchErr *repository.BatchError
+	if errors.As(err, &batchErr) {
+		status, message := repositoryError(batchErr.Err)
+		c.JSON(status, gin.H{"error": message, "index": indexes[batchErr.Index]})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	for k, result := range applied {
+		item := &results[indexes[k]]
+		if result.Err != nil {
+			item.Status, item.Error = repositoryError(result.Err)
+			continue
+		}
+		todo := result.Todo
+		item.Todo = &todo
+		switch item.Op {
+		case repository.BatchCreate:
+			item.Status = http.StatusCreated
+			tc.advance(c, todo)
+			tc.Events.Publish(c.Request.Context(), events.New(events.TodoCreated, todo))
+		case repository.BatchUpdate:
+			item.Status = http.StatusOK
+			tc.advance(c, todo)
+			tc.publishUpdate(c, result.Before, todo)
+		case repository.BatchDelete:
+			item.Status = http.StatusOK
+			tc.Events.Publish(c.Request.Context(), events.New(events.TodoDeleted, result.Before))
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"results": results})
+}
+
+// batchOp checks one operation of a batch, and the caller's role on the
+// todo it acts on, and converts it for the repository, returning the status
+// code of the failure if it is invalid or not allowed
+func (tc *TodoControllerType) batchOp(c *gin.Context, operation models.BatchOperation) (repository.BatchOp, int, error) {
+	op := repository.BatchOp{
+		Op:      operation.Op,
+		Options: repository.UpdateOptions{CompleteChildren: operation.Children == "complete"},
+	}
+	if operation.Todo != nil {
+		op.Todo = *operation.Todo
+	}
+	if operation.Op == repository.BatchCreate {
+		op.Todo.ID = 0
+		if operation.Todo == nil {
+			return op, http.StatusBadRequest, errors.New("todo is required")
+		}
+		if err := validateRecurrence(op.Todo); err != nil {
+			return op, http.StatusBadRequest, err
+		}
+		var status int
+		var err error
+		op.UserID, status, err = tc.newOwner(c, op.Todo)
+		return op, status, err
+	}
+
+	if operation.ID == 0 {
+		return op, http.StatusBadRequest, errors.New("id is required")
+	}
+	if operation.Version == 0 && tc.RequireIfMatch {
+		return op, http.StatusPreconditionRequired, errors.New("version is required")
+	}
+	op.Todo.ID = operation.ID
+	op.Options.Version = operation.Version
+	if operation.Op == repository.BatchUpdate {
+		if operation.Todo == nil {
+			return op, http.StatusBadRequest, errors.New("todo is required")
+		}
+		if err := validateRecurrence(op.Todo); err != nil {
+			return op, http.StatusBadRequest, err
+		}
+	}
+	var status int
+	var err error
+	if op.UserID, status, err = tc.todoOwner(c, operation.ID, models.RoleEditor); err != nil {
+		return op, status, err
+	}
+	if operation.Op == repository.BatchUpdate {
+		status, err = tc.checkNewParent(c, op.UserID, op.Todo)
+	}
+	return op, status, err
+}
+
+// ExportTodos downloads all of the caller's todos, outside the trash, as
+// format=json|csv|ical|todotxt
+func (tc *TodoControllerType) ExportTodos(c *gin.Context) {
+	format, ok := exchange.Lookup(c.Query("format"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be one of " + strings.Join(exchange.Names(), ", ")})
+		return
+	}
+
+	userID := c.GetInt(middleware.UserIDKey)
+	query := repository.TodoQuery{Sort: repository.SortID, Limit: maxPageSize}
+	todos := []models.Todo{}
+	for {
+		page, more, err := tc.Todos.List(c.Request.Context(), userID, query)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		todos = append(todos, page...)
+		if !more {
+			break
+		}
+		after := repository.CursorFor(page[len(page)-1])
+		query.After = &after
+	}
+
+	var body bytes.Buffer
+	if err := format.Encode(&body, todos); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="todos.%s"`, format.Extension))
+	c.Data(http.StatusOK, format.ContentType, body.Bytes())
+}
+
+// ImportTodos creates todos from a file in the request body, in
+// format=json|csv|ical|todotxt. The file is imported whole or not at all:
+// if any row is invalid the response is 422 listing them by line. With
+// dry_run=true nothing is stored and every row is reported as it would be
+// created or why it cannot be. With list_id=<id> the todos go in that list,
+// under its owner's account, and the caller needs the editor role on it.
+func (tc *TodoControllerType) ImportTodos(c *gin.Context) {
+	format, ok := exchange.Lookup(c.Query("format"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be one of " + strings.Join(exchange.Names(), ", ")})
+		return
+	}
+	dryRun, err := strconv.ParseBool(c.DefaultQuery("dry_run", "false"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "dry_run must be true or false"})
+		return
+	}
+	ownerID := c.GetInt(middleware.UserIDKey)
+	var listID *int
+	if value := c.Query("list_id"); value != "" {
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid list_id"})
+			return
+		}
+		list, err := tc.Lists.Get(c.Request.Context(), ownerID, id)
+		if err != nil {
+			respondListError(c, err)
+			return
+		}
+		if !hasRole(list.Role, models.RoleEditor) {
+			respondForbidden(c, models.RoleEditor)
+			return
+		}
+		ownerID, listID = list.OwnerID, &list.ID
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxImportSize))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("Import files are limited to %d bytes", maxImportSize)})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	rows, err := format.Decode(data)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid %s file: %v", format.Name, err)})
+		return
+	}
+	if len(rows) > maxImportRows {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("Import files are limited to %d todos", maxImportRows)})
+		return
+	}
+
+	for i := range rows {
+		if rows[i].Err == nil {
+			rows[i].Err = validateImport(rows[i].Todo)
+		}
+	}
+	ops, rowOf := exchange.Plan(rows)
+	for k := range ops {
+		if ops[k].Op == repository.BatchCreate {
+			ops[k].Todo.ListID = listID
+		}
+	}
+
+	report := make([]models.ImportRow, len(rows))
+	invalid := []models.ImportRow{}
+	for i, row := range rows {
+		report[i].Line = row.Line
+		if row.Err != nil {
+			report[i].Error = row.Err.Error()
+			invalid = append(invalid, report[i])
+			continue
+		}
+		todo := row.Todo
+		report[i].Todo = &todo
+	}
+	if dryRun {
+		c.JSON(http.StatusOK, gin.H{"dry_run": true, "valid": len(rows) - len(invalid), "invalid": len(invalid), "rows": report})
+		return
+	}
+	if len(invalid) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Nothing was imported; the file has invalid rows", "rows": invalid})
+		return
+	}
+
+	results, err := tc.Todos.Batch(c.Request.Context(), ownerID, ops, true)
+	var batchErr *repository.BatchError
+	if errors.As(err, &batchErr) {
+		status, message := repositoryError(batchErr.Err)
+		if status == http.StatusInternalServerError {
+			c.JSON(status, gin.H{"error": message})
+			return
+		}
+		row := models.ImportRow{Line: rows[rowOf[batchErr.Index]].Line, Error: message}
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Nothing was imported; the file has invalid rows", "rows": []models.ImportRow{row}})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Blockers are linked after every todo is created, so a todo's last
+	// result is its final state
+	latest := map[int]models.Todo{}
+	for _, result := range results {
+		latest[result.Todo.ID] = result.Todo
+	}
+	todos := []models.Todo{}
+	for k, op := range ops {
+		if op.Op == repository.BatchCreate {
+			todos = append(todos, latest[results[k].Todo.ID])
+		}
+	}
+	for _, todo := range todos {
+		tc.advance(c, todo)
+		tc.Events.Publish(c.Request.Context(), events.New(events.TodoCreated, todo))
+	}
+	c.JSON(http.StatusCreated, gin.H{"imported": len(todos), "todos": todos})
+}
+
+// GetTrash lists the caller's deleted todos, most recently deleted first
+func (tc *TodoControllerType) GetTrash(c *gin.Context) {
+	todos, err := tc.Todos.Trash(c.Request.Context(), c.GetInt(middleware.UserIDKey))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, todos)
+}
+
+// RestoreTodo takes a todo out of the trash with the subtasks deleted along
+// with it. A subtask can only be restored once its parent is.
+func (tc *TodoControllerType) RestoreTodo(c *gin.Context) {
+	id, ok := todoID(c)
+	if !ok {
+		return
+	}
+
+	userID, ok := tc.access(c, id, models.RoleEditor)
+	if !ok {
+		return
+	}
+	todo, err := tc.Todos.Restore(c.Request.Context(), userID, id)
+	if err != nil {
+		respondRepositoryError(c, err)
+		return
+	}
+	tc.Events.Publish(c.Request.Context(), events.New(events.TodoRestored, todo))
+
+	c.Header("ETag", todoETag(todo))
+	c.JSON(http.StatusOK, todo)
+}
+
+// PurgeTodo permanently deletes a todo in the trash and its subtasks. In a
+// shared list it takes the owner role.
+func (tc *TodoControllerType) PurgeTodo(c *gin.Context) {
+	id, ok := todoID(c)
+	if !ok {
+		return
+	}
+
+	userID, ok := tc.access(c, id, models.RoleOwner)
+	if !ok {
+		return
+	}
+	if err := tc.Todos.Purge(c.Request.Context(), userID, id); err != nil {
+		respondRepositoryError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Todo deleted permanently"})
+}
+
+// EmptyTrash permanently deletes every todo in the caller's trash
+func (tc *TodoControllerType) EmptyTrash(c *gin.Context) {
+	n, err := tc.Todos.EmptyTrash(c.Request.Context(), c.GetInt(middleware.UserIDKey))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"purged": n})
+}
+
+// GetSubtree returns a todo with its subtasks nested under it at any depth
+func (tc *TodoControllerType) GetSubtree(c *gin.Context) {
+	id, ok := todoID(c)
+	if !ok {
+		return
+	}
 
-	_, err := tc.DB.Exec("DELETE FROM todos WHERE id = ?", id)
+	ownerID, ok := tc.access(c, id, models.RoleViewer)
+	if !ok {
+		return
+	}
+	todos, err := tc.Todos.Subtree(c.Request.Context(), ownerID, id)
+	if err != nil {
+		respondRepositoryError(c, err)
+		return
+	}
+
+	// Parents come first, so every node's parent is already in the index
+	nodes := map[int]*models.TodoNode{}
+	for _, todo := range todos {
+		node := &models.TodoNode{Todo: todo, Children: []*models.TodoNode{}}
+		nodes[todo.ID] = node
+		if todo.ID != id {
+			parent := nodes[*todo.ParentID]
+			parent.Children = append(parent.Children, node)
+		}
+	}
+
+	c.JSON(http.StatusOK, nodes[id])
+}
+
+// AddBlocker records that the todo cannot be done before blocked_by is
+func (tc *TodoControllerType) AddBlocker(c *gin.Context) {
+	id, ok := todoID(c)
+	if !ok {
+		return
+	}
+	var blocker models.Blocker
+	if err := c.ShouldBindJSON(&blocker); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, ok := tc.access(c, id, models.RoleEditor)
+	if !ok {
+		return
+	}
+	// The blocker must be one the caller can see, as well as in the same account
+	if userID != c.GetInt(middleware.UserIDKey) {
+		if _, _, err := tc.Lists.TodoRole(c.Request.Context(), c.GetInt(middleware.UserIDKey), blocker.BlockedBy); err != nil {
+			respondRepositoryError(c, referenceError(err))
+			return
+		}
+	}
+	if err := tc.Todos.AddBlocker(c.Request.Context(), userID, id, blocker.BlockedBy); err != nil {
+		respondRepositoryError(c, err)
+		return
+	}
+
+	todo, err := tc.Todos.Get(c.Request.Context(), userID, id)
+	if err != nil {
+		respondRepositoryError(c, err)
+		return
+	}
+	c.Header("ETag", todoETag(todo))
+	c.JSON(http.StatusOK, todo)
+}
+
+func (tc *TodoControllerType) RemoveBlocker(c *gin.Context) {
+	id, ok := todoID(c)
+	if !ok {
+		return
+	}
+	blockerID, err := strconv.Atoi(c.Param("blocker_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid blocker id"})
+		return
+	}
+
+	userID, ok := tc.access(c, id, models.RoleEditor)
+	if !ok {
+		return
+	}
+	if err := tc.Todos.RemoveBlocker(c.Request.Context(), userID, id, blockerID); err != nil {
+		respondRepositoryError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Blocker removed successfully"})
+}
+
+// checkIfMatch evaluates If-Match against the current todo. It returns the
+// version the write must still find, zero without the header, and writes 428
+// or 412 and returns false when the precondition fails.
+func (tc *TodoControllerType) checkIfMatch(c *gin.Context, current models.Todo) (int, bool) {
+	header := c.GetHeader("If-Match")
+	if header == "" {
+		if tc.RequireIfMatch {
+			c.JSON(http.StatusPreconditionRequired, gin.H{"error": "If-Match header is required"})
+			return 0, false
+		}
+		return 0, true
+	}
+	if !etagMatches(header, todoETag(current), false) {
+		respondPreconditionFailed(c, current)
+		return 0, false
+	}
+	return current.Version, true
+}
+
+// respondWriteError answers a failed update or delete. A version conflict
+// means another write won the race since checkIfMatch, so the response
+// carries the todo as it is now.
+func (tc *TodoControllerType) respondWriteError(c *gin.Context, userID, id int, err error) {
+	if errors.Is(err, repository.ErrVersionConflict) {
+		current, getErr := tc.Todos.Get(c.Request.Context(), userID, id)
+		if getErr == nil {
+			respondPreconditionFailed(c, current)
+			return
+		}
+		err = getErr
+	}
+	respondRepositoryError(c, err)
+}
+
+// respondPreconditionFailed writes 412 with the current representation so the
+// client can merge its change and retry with the new ETag
+func respondPreconditionFailed(c *gin.Context, current models.Todo) {
+	c.Header("ETag", todoETag(current))
+	c.JSON(http.StatusPreconditionFailed, current)
+}
+
+// GetHistory returns a todo's audit history, newest first. Query parameters:
+// limit=1..200 and before=<entry id> for the next page.
+func (tc *TodoControllerType) GetHistory(c *gin.Context) {
+	id, ok := todoID(c)
+	if !ok {
+		return
+	}
+
+	limit := defaultPageSize
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxPageSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", maxPageSize)})
+			return
+		}
+		limit = n
+	}
+	before := 0
+	if v := c.Query("before"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "before must be a history entry id"})
+			return
+		}
+		before = n
+	}
+
+	// The history of a purged todo outlives it, and is its owner's to read;
+	// History.List checks the owner against the history rows themselves
+	ownerID, role, err := tc.Lists.TodoRole(c.Request.Context(), c.GetInt(middleware.UserIDKey), id)
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		ownerID = c.GetInt(middleware.UserIDKey)
+	case err != nil:
+		respondRepositoryError(c, err)
+		return
+	case !hasRole(role, models.RoleViewer):
+		respondForbidden(c, models.RoleViewer)
+		return
+	}
+	entries, err := tc.History.List(c.Request.Context(), ownerID, id, before, limit)
+	if err != nil {
+		respondRepositoryError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, entries)
+}
+
+// RevertTodo sets a todo's fields back to how they were at a version in its
+// history. Subtasks, blockers and the trash are left alone, and
+// children=refuse|complete applies as in UpdateTodo.
+func (tc *TodoControllerType) RevertTodo(c *gin.Context) {
+	id, ok := todoID(c)
+	if !ok {
+		return
+	}
+	var opts repository.UpdateOptions
+	if opts.CompleteChildren, ok = completeChildren(c); !ok {
+		return
+	}
+	var revert models.Revert
+	if err := c.ShouldBindJSON(&revert); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, ok := tc.access(c, id, models.RoleEditor)
+	if !ok {
+		return
+	}
+	before, err := tc.Todos.Get(c.Request.Context(), userID, id)
+	if err != nil {
+		respondRepositoryError(c, err)
+		return
+	}
+	if _, ok := tc.checkIfMatch(c, before); !ok {
+		return
+	}
+	entry, err := tc.History.Version(c.Request.Context(), userID, id, revert.Version)
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Version not found in history"})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Todo deleted successfully"})
+	past := entry.Snapshot
+	todo := models.Todo{
+		ID:          id,
+		UserID:      userID,
+		Title:       past.Title,
+		Description: past.Description,
+		Completed:   past.Completed,
+		Priority:    past.Priority,
+		DueAt:       past.DueAt,
+		Tags:        past.Tags,
+		ParentID:    past.ParentID,
+		Recurrence:  past.Recurrence,
+	}
+	// Computed from the todo as read, so a concurrent write makes it fail
+	opts.Version = before.Version
+	opts.Operation = models.HistoryRevert
+	if err := tc.Todos.Update(c.Request.Context(), &todo, opts); err != nil {
+		tc.respondWriteError(c, userID, id, err)
+		return
+	}
+	tc.advance(c, todo)
+	tc.publishUpdate(c, before, todo)
+
+	c.Header("ETag", todoETag(todo))
+	c.JSON(http.StatusOK, todo)
+}
+
+// MoveTodo puts a top-level todo and its subtasks in another list, or takes
+// them out of their list with a null list_id. The caller needs the editor
+// role on both lists. Todos stay with the account owning them, so they only
+// move between that account's lists, and only it can take them out of one.
+func (tc *TodoControllerType) MoveTodo(c *gin.Context) {
+	id, ok := todoID(c)
+	if !ok {
+		return
+	}
+	var move models.Move
+	if err := c.ShouldBindJSON(&move); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	callerID := c.GetInt(middleware.UserIDKey)
+	userID, ok := tc.access(c, id, models.RoleEditor)
+	if !ok {
+		return
+	}
+	if move.ListID != nil {
+		list, err := tc.Lists.Get(c.Request.Context(), callerID, *move.ListID)
+		if err != nil {
+			respondRepositoryError(c, listReferenceError(err))
+			return
+		}
+		if !hasRole(list.Role, models.RoleEditor) {
+			respondForbidden(c, models.RoleEditor)
+			return
+		}
+		if list.OwnerID != userID {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Todos only move between lists of the account that owns them"})
+			return
+		}
+	} else if userID != callerID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the owner of the todo can take it out of its list"})
+		return
+	}
+
+	before, err := tc.Todos.Get(c.Request.Context(), userID, id)
+	if err != nil {
+		respondRepositoryError(c, err)
+		return
+	}
+	todo, err := tc.Todos.Move(c.Request.Context(), userID, id, move.ListID)
+	if err != nil {
+		respondRepositoryError(c, err)
+		return
+	}
+	if todo.Version != before.Version {
+		tc.publishUpdate(c, before, todo)
+	}
+
+	c.Header("ETag", todoETag(todo))
+	c.JSON(http.StatusOK, todo)
+}
+
+// access resolves the account owning a todo, in or out of the trash, and
+// checks that the caller's role on it is at least need. It writes 404 when
+// the caller cannot see the todo and 403 when their role is too low.
+func (tc *TodoControllerType) access(c *gin.Context, id int, need string) (int, bool) {
+	ownerID, status, err := tc.todoOwner(c, id, need)
+	if err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return 0, false
+	}
+	return ownerID, true
+}
+
+// todoOwner is access for requests acting on several todos: it returns the
+// status code and error of the response instead of writing it
+func (tc *TodoControllerType) todoOwner(c *gin.Context, id int, need string) (int, int, error) {
+	ownerID, role, err := tc.Lists.TodoRole(c.Request.Context(), c.GetInt(middleware.UserIDKey), id)
+	if err != nil {
+		status, message := repositoryError(err)
+		return 0, status, errors.New(message)
+	}
+	if !hasRole(role, need) {
+		return 0, http.StatusForbidden, errors.New(forbiddenMessage(need))
+	}
+	return ownerID, 0, nil
+}
+
+// newTodoOwner returns the account a new todo is stored under: that of its
+// parent or list, on which the caller needs the editor role, or else the
+// caller's own
+func (tc *TodoControllerType) newTodoOwner(c *gin.Context, todo models.Todo) (int, bool) {
+	ownerID, status, err := tc.newOwner(c, todo)
+	if err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return 0, false
+	}
+	return ownerID, true
+}
+
+// newOwner is newTodoOwner returning the status code and error of a failure
+func (tc *TodoControllerType) newOwner(c *gin.Context, todo models.Todo) (int, int, error) {
+	callerID := c.GetInt(middleware.UserIDKey)
+	if todo.ParentID != nil {
+		ownerID, role, err := tc.Lists.TodoRole(c.Request.Context(), callerID, *todo.ParentID)
+		if err != nil {
+			status, message := repositoryError(referenceError(err))
+			return 0, status, errors.New(message)
+		}
+		if !hasRole(role, models.RoleEditor) {
+			return 0, http.StatusForbidden, errors.New(forbiddenMessage(models.RoleEditor))
+		}
+		return ownerID, 0, nil
+	}
+	if todo.ListID != nil {
+		list, err := tc.Lists.Get(c.Request.Context(), callerID, *todo.ListID)
+		if err != nil {
+			status, message := repositoryError(listReferenceError(err))
+			return 0, status, errors.New(message)
+		}
+		if !hasRole(list.Role, models.RoleEditor) {
+			return 0, http.StatusForbidden, errors.New(forbiddenMessage(models.RoleEditor))
+		}
+		return list.OwnerID, 0, nil
+	}
+	return callerID, 0, nil
+}
+
+// checkNewParent checks that the caller can see the parent an update gives a
+// todo of someone else's account. Otherwise a list member could tell the
+// owner's private todos from missing ones by the error, so those look missing.
+func (tc *TodoControllerType) checkNewParent(c *gin.Context, ownerID int, todo models.Todo) (int, error) {
+	callerID := c.GetInt(middleware.UserIDKey)
+	if todo.ParentID == nil || ownerID == callerID {
+		return 0, nil
+	}
+	if _, _, err := tc.Lists.TodoRole(c.Request.Context(), callerID, *todo.ParentID); err != nil {
+		status, message := repositoryError(referenceError(err))
+		return status, errors.New(message)
+	}
+	return 0, nil
+}
+
+// referenceError reports a todo named in a request body that the caller
+// cannot see as an invalid reference rather than a missing resource
+func referenceError(err error) error {
+	if errors.Is(err, repository.ErrNotFound) {
+		return repository.ErrInvalidReference
+	}
+	return err
+}
+
+// listReferenceError does the same for lists
+func listReferenceError(err error) error {
+	if errors.Is(err, repository.ErrNotFound) {
+		return repository.ErrInvalidList
+	}
+	return err
+}
+
+// completeChildren reads children=refuse|complete, writing a 400 response
+// when it is neither
+func completeChildren(c *gin.Context) (bool, bool) {
+	switch c.DefaultQuery("children", "refuse") {
+	case "refuse":
+		return false, true
+	case "complete":
+		return true, true
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "children must be refuse or complete"})
+		return false, false
+	}
+}
+
+// publishUpdate announces an updated todo, and its completion when it was
+// just completed
+func (tc *TodoControllerType) publishUpdate(c *gin.Context, before, todo models.Todo) {
+	tc.Events.Publish(c.Request.Context(), events.New(events.TodoUpdated, todo))
+	if todo.Completed && !before.Completed {
+		tc.Events.Publish(c.Request.Context(), events.New(events.TodoCompleted, todo))
+	}
+}
+
+// validateRecurrence checks the rule of a recurring todo, which repeats from its due date
+func validateRecurrence(todo models.Todo) error {
+	if todo.Recurrence == "" {
+		return nil
+	}
+	if todo.DueAt == nil {
+		return errors.New("due_at is required for recurring todos")
+	}
+	return recurrence.Validate(todo.Recurrence)
+}
+
+// validateImport checks a todo read from an import file as CreateTodo
+// checks a request body, and also requires a title, which an empty or
+// misaligned row lacks
+func validateImport(todo models.Todo) error {
+	if strings.TrimSpace(todo.Title) == "" {
+		return errors.New("title is required")
+	}
+	if err := binding.Validator.ValidateStruct(&todo); err != nil {
+		return err
+	}
+	return validateRecurrence(todo)
+}
+
+// advance materializes the next occurrences of a recurring todo that was just
+// saved. Failures are only logged: the todo itself is stored and the
+// scheduler retries on its next run.
+func (tc *TodoControllerType) advance(c *gin.Context, todo models.Todo) {
+	ctx := c.Request.Context()
+	if err := tc.Scheduler.Advance(ctx, todo); err != nil {
+		logging.FromContext(ctx).ErrorContext(ctx, "Error advancing series", "todo_id", todo.ID, "error", err)
+	}
+}
+
+// parseTodoQuery reads the listing parameters. The returned filter string
+// fingerprints the filters so cursors can be bound to them.
+func parseTodoQuery(c *gin.Context) (repository.TodoQuery, string, error) {
+	query := repository.TodoQuery{
+		Search: c.Query("q"),
+		Sort:   c.DefaultQuery("sort", repository.SortID),
+		Limit:  defaultPageSize,
+	}
+
+	if v := c.Query("completed"); v != "" {
+		completed, err := strconv.ParseBool(v)
+		if err != nil {
+			return query, "", errors.New("completed must be true or false")
+		}
+		query.Completed = &completed
+	}
+
+	switch query.Sort {
+	case repository.SortID, repository.SortTitle, repository.SortCreatedAt:
+	default:
+		return query, "", errors.New("sort must be one of id, title, created_at")
+	}
+
+	switch c.DefaultQuery("order", "asc") {
+	case "asc":
+	case "desc":
+		query.Desc = true
+	default:
+		return query, "", errors.New("order must be asc or desc")
+	}
+
+	for _, tag := range c.QueryArray("tag") {
+		if tag = repository.NormalizeTag(tag); tag != "" {
+			query.Tags = append(query.Tags, tag)
+		}
+	}
+	sort.Strings(query.Tags)
+
+	if v := c.Query("priority"); v != "" {
+		priority, err := strconv.Atoi(v)
+		if err != nil || priority < models.PriorityNone || priority > models.PriorityHigh {
+			return query, "", errors.New("priority must be between 0 and 3")
+		}
+		query.Priority = &priority
+	}
+
+	for param, dst := range map[string]**time.Time{"due_after": &query.DueAfter, "due_before": &query.DueBefore} {
+		if v := c.Query(param); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return query, "", fmt.Errorf("%s must be an RFC 3339 timestamp", param)
+			}
+			*dst = &t
+		}
+	}
+
+	if v := c.Query("list_id"); v != "" {
+		listID, err := strconv.Atoi(v)
+		if err != nil {
+			return query, "", errors.New("list_id must be a list id")
+		}
+		query.ListID = &listID
+	}
+
+	if v := c.Query("overdue"); v != "" {
+		overdue, err := strconv.ParseBool(v)
+		if err != nil {
+			return query, "", errors.New("overdue must be true or false")
+		}
+		query.Overdue = overdue
+		query.Now = time.Now()
+	}
+
+	if v := c.Query("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxPageSize {
+			return query, "", fmt.Errorf("limit must be between 1 and %d", maxPageSize)
+		}
+		query.Limit = limit
+	}
+
+	return query, filterFingerprint(query), nil
+}
+
+// filterFingerprint hashes the filters of query, leaving out paging, sort
+// order and the clock
+func filterFingerprint(query repository.TodoQuery) string {
+	query.Sort, query.Desc, query.Limit, query.After, query.Now = "", false, 0, nil, time.Time{}
+	body, _ := json.Marshal(query)
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:8])
+}
+
+// todoID parses the :id path parameter, writing a 400 response when it is not a number
+func todoID(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid todo id"})
+		return 0, false
+	}
+	return id, true
+}
+
+// respondRepositoryError maps repository errors to HTTP responses
+func respondRepositoryError(c *gin.Context, err error) {
+	status, message := repositoryError(err)
+	c.JSON(status, gin.H{"error": message})
+}
+
+// repositoryError returns the status code and message of a repository error
+func repositoryError(err error) (int, string) {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		return http.StatusNotFound, "Todo not found"
+	case errors.Is(err, repository.ErrInvalidReference):
+		return http.StatusUnprocessableEntity, "Referenced todo not found"
+	case errors.Is(err, repository.ErrCycle):
+		return http.StatusConflict, "Link would create a cycle"
+	case errors.Is(err, repository.ErrVersionConflict):
+		return http.StatusPreconditionFailed, "Todo has been modified"
+	case errors.Is(err, repository.ErrParentTrashed):
+		return http.StatusConflict, "Parent todo is in the trash; restore it first"
+	case errors.Is(err, repository.ErrOpenChildren):
+		return http.StatusConflict, "Todo has open subtasks; pass children=complete to complete them too"
+	case errors.Is(err, repository.ErrInvalidList):
+		return http.StatusUnprocessableEntity, "List not found"
+	case errors.Is(err, repository.ErrListMismatch):
+		return http.StatusConflict, "Subtasks must be in their parent's list; move the parent instead"
+	default:
+		return http.StatusInternalServerError, err.Error()
+	}
 }
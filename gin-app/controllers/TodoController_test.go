@@ -0,0 +1,491 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"gin-app/audit"
+	"gin-app/config"
+	"gin-app/database"
+	"gin-app/events"
+	"gin-app/middleware"
+	"gin-app/models"
+	"gin-app/recurrence"
+	"gin-app/repository"
+	"gin-app/tenant"
+
+	"github.com/gin-gonic/gin"
+)
+
+// testStores opens each store the controllers run on, so that every test
+// runs against all of them and the memory store cannot drift from SQL
+var testStores = map[string]func(t *testing.T) *repository.Store{
+	"memory": func(t *testing.T) *repository.Store { return repository.NewMemory() },
+	"sqlite": openSQLite,
+}
+
+// openSQLite migrates a fresh SQLite database in a temporary directory
+func openSQLite(t *testing.T) *repository.Store {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "todo.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec("PRAGMA foreign_keys = ON"); err != nil {
+		t.Fatal(err)
+	}
+	migrator, err := database.NewMigrator(db, database.DialectSQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatalf("migrating: %v", err)
+	}
+	return repository.NewSQLite(db)
+}
+
+// testUsers is the number of accounts every test store starts with; their
+// IDs are 1 to testUsers
+const testUsers = 3
+
+// testAPI serves the todo and list routes over a store, authenticating
+// requests as the user in their X-Test-User header. The custom methods of
+// the real routes are served at /batch, /import and /export.
+type testAPI struct {
+	t      *testing.T
+	store  *repository.Store
+	router *gin.Engine
+}
+
+func newTestAPI(t *testing.T, store *repository.Store) *testAPI {
+	gin.SetMode(gin.TestMode)
+	ctx := tenant.With(context.Background(), tenant.Default)
+	for i := 1; i <= testUsers; i++ {
+		user := models.User{TenantID: tenant.Default, Email: "user" + strconv.Itoa(i) + "@example.com", Timezone: "UTC"}
+		if err := store.Users.Create(ctx, &user); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg := config.Default()
+	bus := events.NewBus()
+	tc := TodoController(store.Todos, store.History, store.Lists, []byte(strings.Repeat("k", 32)),
+		recurrence.NewScheduler(store, bus, cfg.Scheduler), bus, false)
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		userID, _ := strconv.Atoi(c.GetHeader("X-Test-User"))
+		c.Set(middleware.UserIDKey, userID)
+		c.Set(middleware.TenantIDKey, tenant.Default)
+		c.Request = c.Request.WithContext(audit.WithActor(tenant.With(c.Request.Context(), tenant.Default), userID))
+	})
+	r.GET("/todos", tc.GetTodos)
+	r.POST("/todos", tc.CreateTodo)
+	r.GET("/todos/:id", tc.GetTodo)
+	r.GET("/todos/:id/subtree", tc.GetSubtree)
+	r.PUT("/todos/:id", tc.UpdateTodo)
+	r.DELETE("/todos/:id", tc.DeleteTodo)
+	r.POST("/todos/:id/blockers", tc.AddBlocker)
+	r.DELETE("/todos/:id/blockers/:blocker_id", tc.RemoveBlocker)
+	r.POST("/todos/:id/restore", tc.RestoreTodo)
+	r.POST("/todos/:id/move", tc.MoveTodo)
+	r.POST("/todos/:id/revert", tc.RevertTodo)
+	r.GET("/todos/:id/history", tc.GetHistory)
+	r.GET("/trash", tc.GetTrash)
+	r.DELETE("/trash/:id", tc.PurgeTodo)
+	r.POST("/batch", tc.BatchTodos)
+	r.POST("/import", tc.ImportTodos)
+	r.GET("/export", tc.ExportTodos)
+
+	lc := ListController(store.Lists, store.Users)
+	r.POST("/lists", lc.CreateList)
+	r.POST("/lists/:id/invites", lc.CreateInvite)
+	r.POST("/invites/:id/accept", lc.AcceptInvite)
+
+	return &testAPI{t: t, store: store, router: r}
+}
+
+// step is one request of a test case and the response it expects
+type step struct {
+	user   int
+	method string
+	path   string
+	body   string
+	header map[string]string
+	status int
+	// contains is a substring the response body must have
+	contains string
+}
+
+func (api *testAPI) run(steps []step) {
+	api.t.Helper()
+	for i, s := range steps {
+		w := api.do(s)
+		if w.Code != s.status {
+			api.t.Fatalf("step %d: %s %s got %d, want %d: %s", i, s.method, s.path, w.Code, s.status, w.Body)
+		}
+		if !strings.Contains(w.Body.String(), s.contains) {
+			api.t.Fatalf("step %d: %s %s body %s does not contain %q", i, s.method, s.path, w.Body, s.contains)
+		}
+	}
+}
+
+func (api *testAPI) do(s step) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(s.method, s.path, strings.NewReader(s.body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Test-User", strconv.Itoa(max(s.user, 1)))
+	for name, value := range s.header {
+		req.Header.Set(name, value)
+	}
+	w := httptest.NewRecorder()
+	api.router.ServeHTTP(w, req)
+	return w
+}
+
+// forEachStore runs each case on a fresh API over every store
+func forEachStore(t *testing.T, cases map[string][]step) {
+	for storeName, open := range testStores {
+		for name, steps := range cases {
+			t.Run(storeName+"/"+name, func(t *testing.T) {
+				newTestAPI(t, open(t)).run(steps)
+			})
+		}
+	}
+}
+
+func TestTodos(t *testing.T) {
+	forEachStore(t, map[string][]step{
+		"create and get": {
+			{method: "POST", path: "/todos", body: `{"title":"Write tests","priority":2}`, status: http.StatusCreated, contains: `"title":"Write tests"`},
+			{method: "GET", path: "/todos/1", status: http.StatusOK, contains: `"priority":2`},
+			{method: "GET", path: "/todos", status: http.StatusOK, contains: `"id":1`},
+		},
+		"invalid priority": {
+			{method: "POST", path: "/todos", body: `{"title":"x","priority":9}`, status: http.StatusBadRequest},
+		},
+		"missing todo": {
+			{method: "GET", path: "/todos/99", status: http.StatusNotFound},
+			{method: "PUT", path: "/todos/99", body: `{"title":"x"}`, status: http.StatusNotFound},
+		},
+		"other user's todo looks missing": {
+			{method: "POST", path: "/todos", body: `{"title":"mine"}`, status: http.StatusCreated},
+			{user: 2, method: "GET", path: "/todos/1", status: http.StatusNotFound},
+			{user: 2, method: "PUT", path: "/todos/1", body: `{"title":"theirs"}`, status: http.StatusNotFound},
+			{user: 2, method: "DELETE", path: "/todos/1", status: http.StatusNotFound},
+			{user: 2, method: "GET", path: "/todos", status: http.StatusOK, contains: `"data":[]`},
+		},
+		"update": {
+			{method: "POST", path: "/todos", body: `{"title":"a"}`, status: http.StatusCreated},
+			{method: "PUT", path: "/todos/1", body: `{"title":"b","completed":true}`, status: http.StatusOK},
+			{method: "GET", path: "/todos/1", status: http.StatusOK, contains: `"completed":true`},
+			{method: "GET", path: "/todos?completed=false", status: http.StatusOK, contains: `"data":[]`},
+		},
+		"stale If-Match": {
+			{method: "POST", path: "/todos", body: `{"title":"a"}`, status: http.StatusCreated},
+			{method: "PUT", path: "/todos/1", body: `{"title":"b"}`, header: map[string]string{"If-Match": `"1"`}, status: http.StatusOK},
+			{method: "PUT", path: "/todos/1", body: `{"title":"c"}`, header: map[string]string{"If-Match": `"1"`}, status: http.StatusPreconditionFailed},
+		},
+		"trash and restore": {
+			{method: "POST", path: "/todos", body: `{"title":"a"}`, status: http.StatusCreated},
+			{method: "DELETE", path: "/todos/1", status: http.StatusOK},
+			{method: "GET", path: "/todos/1", status: http.StatusNotFound},
+			{method: "GET", path: "/trash", status: http.StatusOK, contains: `"id":1`},
+			{method: "POST", path: "/todos/1/restore", status: http.StatusOK},
+			{method: "GET", path: "/todos/1", status: http.StatusOK},
+		},
+		"purge": {
+			{method: "POST", path: "/todos", body: `{"title":"a"}`, status: http.StatusCreated},
+			{method: "DELETE", path: "/todos/1", status: http.StatusOK},
+			{method: "DELETE", path: "/trash/1", status: http.StatusOK},
+			{method: "POST", path: "/todos/1/restore", status: http.StatusNotFound},
+		},
+		"open subtasks": {
+			{method: "POST", path: "/todos", body: `{"title":"parent"}`, status: http.StatusCreated},
+			{method: "POST", path: "/todos", body: `{"title":"child","parent_id":1}`, status: http.StatusCreated},
+			{method: "PUT", path: "/todos/1", body: `{"title":"parent","completed":true}`, status: http.StatusConflict},
+			{method: "PUT", path: "/todos/1?children=complete", body: `{"title":"parent","completed":true}`, status: http.StatusOK},
+			{method: "GET", path: "/todos/2", status: http.StatusOK, contains: `"completed":true`},
+		},
+		"missing parent": {
+			{method: "POST", path: "/todos", body: `{"title":"child","parent_id":42}`, status: http.StatusUnprocessableEntity},
+		},
+		"blocker cycle": {
+			{method: "POST", path: "/todos", body: `{"title":"a"}`, status: http.StatusCreated},
+			{method: "POST", path: "/todos", body: `{"title":"b"}`, status: http.StatusCreated},
+			{method: "POST", path: "/todos/1/blockers", body: `{"blocked_by":2}`, status: http.StatusOK, contains: `"blocked":true`},
+			{method: "POST", path: "/todos/2/blockers", body: `{"blocked_by":1}`, status: http.StatusConflict},
+		},
+		"blocker removed": {
+			{method: "POST", path: "/todos", body: `{"title":"a"}`, status: http.StatusCreated},
+			{method: "POST", path: "/todos", body: `{"title":"b"}`, status: http.StatusCreated},
+			{method: "POST", path: "/todos/1/blockers", body: `{"blocked_by":2}`, status: http.StatusOK},
+			{method: "DELETE", path: "/todos/1/blockers/2", status: http.StatusOK},
+			{method: "GET", path: "/todos/1", status: http.StatusOK, contains: `"blocked_by":[],"blocked":false`},
+		},
+		"subtree": {
+			{method: "POST", path: "/todos", body: `{"title":"parent"}`, status: http.StatusCreated},
+			{method: "POST", path: "/todos", body: `{"title":"child","parent_id":1}`, status: http.StatusCreated},
+			{method: "POST", path: "/todos", body: `{"title":"grandchild","parent_id":2}`, status: http.StatusCreated},
+			{method: "GET", path: "/todos/2/subtree", status: http.StatusOK, contains: `"title":"grandchild"`},
+		},
+		"details and filters": {
+			{method: "POST", path: "/todos", body: `{"title":"a","description":"first","priority":3,"tags":["Work"],"due_at":"2020-01-02T03:04:05Z"}`, status: http.StatusCreated, contains: `"tags":["work"]`},
+			{method: "POST", path: "/todos", body: `{"title":"b","priority":1}`, status: http.StatusCreated},
+			{method: "GET", path: "/todos?priority=3", status: http.StatusOK, contains: `"description":"first"`},
+			{method: "GET", path: "/todos?tag=WORK&priority=1", status: http.StatusOK, contains: `"data":[]`},
+			{method: "GET", path: "/todos?overdue=true", status: http.StatusOK, contains: `"due_at":"2020-01-02T03:04:05Z"`},
+			{method: "GET", path: "/todos?q=b", status: http.StatusOK, contains: `"title":"b"`},
+			{method: "GET", path: "/todos?sort=priority", status: http.StatusBadRequest},
+			{method: "GET", path: "/todos?cursor=garbage", status: http.StatusBadRequest, contains: "Invalid cursor"},
+		},
+		"revert": {
+			{method: "POST", path: "/todos", body: `{"title":"a"}`, status: http.StatusCreated},
+			{method: "PUT", path: "/todos/1", body: `{"title":"b"}`, status: http.StatusOK},
+			{method: "POST", path: "/todos/1/revert", body: `{"version":1}`, status: http.StatusOK, contains: `"title":"a"`},
+			{method: "GET", path: "/todos/1/history", status: http.StatusOK, contains: `"operation":"revert"`},
+			{method: "POST", path: "/todos/1/revert", body: `{"version":9}`, status: http.StatusNotFound},
+		},
+		"export": {
+			{method: "POST", path: "/todos", body: `{"title":"exported","tags":["home"]}`, status: http.StatusCreated},
+			{method: "GET", path: "/export?format=json", status: http.StatusOK, contains: `"title": "exported"`},
+			{method: "GET", path: "/export?format=ical", status: http.StatusOK, contains: "SUMMARY:exported"},
+			{method: "GET", path: "/export?format=xml", status: http.StatusBadRequest},
+		},
+	})
+}
+
+// TestPagination follows the cursors of a sorted listing to its end, and
+// checks that a cursor only continues the listing it came from
+func TestPagination(t *testing.T) {
+	titles := []string{"c", "a", "e", "b", "d"}
+	for storeName, open := range testStores {
+		t.Run(storeName, func(t *testing.T) {
+			api := newTestAPI(t, open(t))
+			for _, title := range titles {
+				api.run([]step{{method: "POST", path: "/todos", body: `{"title":"` + title + `"}`, status: http.StatusCreated}})
+			}
+
+			var got []string
+			var cursor string
+			for pages := 0; pages == 0 || cursor != ""; pages++ {
+				if pages > len(titles) {
+					t.Fatal("the listing does not end")
+				}
+				path := "/todos?sort=title&order=desc&limit=2"
+				if cursor != "" {
+					path += "&cursor=" + cursor
+				}
+				w := api.do(step{method: "GET", path: path})
+				var page struct {
+					Data       []models.Todo `json:"data"`
+					NextCursor *string       `json:"next_cursor"`
+				}
+				if err := json.Unmarshal(w.Body.Bytes(), &page); w.Code != http.StatusOK || err != nil {
+					t.Fatalf("GET %s got %d: %s", path, w.Code, w.Body)
+				}
+				for _, todo := range page.Data {
+					got = append(got, todo.Title)
+				}
+				cursor = ""
+				if page.NextCursor != nil {
+					cursor = *page.NextCursor
+					api.run([]step{
+						{method: "GET", path: "/todos?sort=title&limit=2&cursor=" + cursor, status: http.StatusBadRequest},
+						{method: "GET", path: "/todos?sort=title&order=desc&limit=2&priority=1&cursor=" + cursor, status: http.StatusBadRequest},
+					})
+				}
+			}
+			if want := []string{"e", "d", "c", "b", "a"}; !reflect.DeepEqual(got, want) {
+				t.Errorf("got %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestHistory(t *testing.T) {
+	forEachStore(t, map[string][]step{
+		"outlives a purged todo": {
+			{method: "POST", path: "/todos", body: `{"title":"a"}`, status: http.StatusCreated},
+			{method: "PUT", path: "/todos/1", body: `{"title":"b"}`, status: http.StatusOK},
+			{method: "DELETE", path: "/todos/1", status: http.StatusOK},
+			{method: "DELETE", path: "/trash/1", status: http.StatusOK},
+			{method: "GET", path: "/todos/1", status: http.StatusNotFound},
+			{method: "GET", path: "/todos/1/history", status: http.StatusOK, contains: `"operation":"purge"`},
+			{user: 2, method: "GET", path: "/todos/1/history", status: http.StatusNotFound},
+		},
+		"missing todo": {
+			{method: "GET", path: "/todos/1/history", status: http.StatusNotFound},
+		},
+		"of subtasks trashed and restored with their parent": {
+			{method: "POST", path: "/todos", body: `{"title":"parent"}`, status: http.StatusCreated},
+			{method: "POST", path: "/todos", body: `{"title":"child","parent_id":1}`, status: http.StatusCreated},
+			{method: "DELETE", path: "/todos/1", status: http.StatusOK},
+			{method: "GET", path: "/todos/2/history", status: http.StatusOK, contains: `"operation":"delete"`},
+			{method: "POST", path: "/todos/1/restore", status: http.StatusOK},
+			{method: "GET", path: "/todos/2/history", status: http.StatusOK, contains: `"operation":"restore"`},
+		},
+		"of subtasks purged with their parent": {
+			{method: "POST", path: "/todos", body: `{"title":"parent"}`, status: http.StatusCreated},
+			{method: "POST", path: "/todos", body: `{"title":"child","parent_id":1}`, status: http.StatusCreated},
+			{method: "DELETE", path: "/todos/1", status: http.StatusOK},
+			{method: "DELETE", path: "/trash/1", status: http.StatusOK},
+			{method: "GET", path: "/todos/2/history", status: http.StatusOK, contains: `"operation":"purge"`},
+		},
+		"of subtasks moved with their parent": {
+			{method: "POST", path: "/lists", body: `{"name":"Errands"}`, status: http.StatusCreated},
+			{method: "POST", path: "/todos", body: `{"title":"parent"}`, status: http.StatusCreated},
+			{method: "POST", path: "/todos", body: `{"title":"child","parent_id":1}`, status: http.StatusCreated},
+			{method: "POST", path: "/todos/1/move", body: `{"list_id":1}`, status: http.StatusOK},
+			{method: "GET", path: "/todos/2/history", status: http.StatusOK, contains: `"operation":"move"`},
+		},
+		"of subtasks completed with their parent": {
+			{method: "POST", path: "/todos", body: `{"title":"parent"}`, status: http.StatusCreated},
+			{method: "POST", path: "/todos", body: `{"title":"child","parent_id":1}`, status: http.StatusCreated},
+			{method: "PUT", path: "/todos/1?children=complete", body: `{"title":"parent","completed":true}`, status: http.StatusOK},
+			{method: "GET", path: "/todos/2/history", status: http.StatusOK, contains: `"completed":{"before":false,"after":true}`},
+		},
+		// The next day's occurrence is within the default horizon
+		"of occurrences": {
+			{method: "POST", path: "/todos", body: `{"title":"daily","due_at":"` + time.Now().Add(-time.Hour).UTC().Format(time.RFC3339) + `","recurrence":"FREQ=DAILY"}`, status: http.StatusCreated},
+			{method: "GET", path: "/todos/2", status: http.StatusOK, contains: `"series_id":1`},
+			{method: "GET", path: "/todos/2/history", status: http.StatusOK, contains: `"operation":"create"`},
+		},
+	})
+}
+
+// sharedList has user 1 share list 1 with user 2 as editor and user 3 as
+// viewer
+var sharedList = []step{
+	{method: "POST", path: "/lists", body: `{"name":"Shared"}`, status: http.StatusCreated},
+	{method: "POST", path: "/lists/1/invites", body: `{"email":"user2@example.com","role":"editor"}`, status: http.StatusCreated},
+	{method: "POST", path: "/lists/1/invites", body: `{"email":"user3@example.com","role":"viewer"}`, status: http.StatusCreated},
+	{user: 2, method: "POST", path: "/invites/1/accept", status: http.StatusOK},
+	{user: 3, method: "POST", path: "/invites/2/accept", status: http.StatusOK},
+}
+
+// sharedCase starts a case with sharedList, todo 1 in the list and todo 2
+// private to user 1
+func sharedCase(steps []step) []step {
+	return append(append([]step{}, sharedList...), append([]step{
+		{method: "POST", path: "/todos", body: `{"title":"shared","list_id":1}`, status: http.StatusCreated},
+		{method: "POST", path: "/todos", body: `{"title":"private"}`, status: http.StatusCreated},
+	}, steps...)...)
+}
+
+func TestSharedLists(t *testing.T) {
+	forEachStore(t, map[string][]step{
+		"editors update": sharedCase([]step{
+			{user: 2, method: "PUT", path: "/todos/1", body: `{"title":"edited"}`, status: http.StatusOK},
+			{user: 3, method: "PUT", path: "/todos/1", body: `{"title":"viewed"}`, status: http.StatusForbidden},
+			{user: 3, method: "GET", path: "/todos/1", status: http.StatusOK, contains: `"title":"edited"`},
+		}),
+		"private parent looks missing": sharedCase([]step{
+			{user: 2, method: "PUT", path: "/todos/1", body: `{"title":"shared","parent_id":2}`, status: http.StatusUnprocessableEntity, contains: "Referenced todo not found"},
+			{user: 2, method: "PUT", path: "/todos/1", body: `{"title":"shared","parent_id":99}`, status: http.StatusUnprocessableEntity, contains: "Referenced todo not found"},
+			{user: 2, method: "POST", path: "/batch", body: `{"operations":[{"op":"update","id":1,"todo":{"title":"shared","parent_id":2}}]}`, status: http.StatusUnprocessableEntity, contains: "Referenced todo not found"},
+		}),
+		"batch on a shared list": sharedCase([]step{
+			{user: 2, method: "POST", path: "/batch", body: `{"operations":[
+				{"op":"update","id":1,"todo":{"title":"edited"}},
+				{"op":"create","todo":{"title":"added","list_id":1}},
+				{"op":"create","todo":{"title":"subtask","parent_id":1}},
+				{"op":"create","todo":{"title":"own"}}]}`, status: http.StatusOK},
+			{method: "GET", path: "/todos/1", status: http.StatusOK, contains: `"title":"edited"`},
+			{method: "GET", path: "/todos/3", status: http.StatusOK, contains: `"user_id":1`},
+			{method: "GET", path: "/todos/4", status: http.StatusOK, contains: `"parent_id":1`},
+			{user: 2, method: "GET", path: "/todos/5", status: http.StatusOK, contains: `"user_id":2`},
+			{user: 2, method: "POST", path: "/batch", body: `{"operations":[{"op":"delete","id":1},{"op":"delete","id":2}]}`, status: http.StatusNotFound, contains: `"index":1`},
+			{user: 3, method: "POST", path: "/batch", body: `{"operations":[{"op":"delete","id":1}]}`, status: http.StatusForbidden, contains: `"index":0`},
+			{user: 3, method: "POST", path: "/batch", body: `{"mode":"best_effort","operations":[{"op":"create","todo":{"title":"x","list_id":1}}]}`, status: http.StatusOK, contains: `"status":403`},
+			{method: "GET", path: "/todos/1", status: http.StatusOK},
+		}),
+		"import into a shared list": sharedCase([]step{
+			{user: 2, method: "POST", path: "/import?format=json&list_id=1", body: `[{"id":1,"title":"parent"},{"title":"child","parent_id":1}]`, status: http.StatusCreated, contains: `"imported":2`},
+			{method: "GET", path: "/todos?list_id=1", status: http.StatusOK, contains: `"title":"child"`},
+			{user: 3, method: "POST", path: "/import?format=json&list_id=1", body: `[{"title":"x"}]`, status: http.StatusForbidden},
+			{user: 2, method: "POST", path: "/import?format=json&list_id=2", body: `[{"title":"x"}]`, status: http.StatusNotFound},
+		}),
+		"viewers cannot write": sharedCase([]step{
+			{user: 3, method: "POST", path: "/batch", body: `{"operations":[{"op":"update","id":1,"todo":{"title":"viewed"}}]}`, status: http.StatusForbidden, contains: `"index":0`},
+			{user: 3, method: "POST", path: "/batch", body: `{"mode":"best_effort","operations":[{"op":"update","id":1,"todo":{"title":"viewed"}}]}`, status: http.StatusOK, contains: `"status":403`},
+			{user: 3, method: "POST", path: "/import?format=json&list_id=1", body: `[{"title":"imported"}]`, status: http.StatusForbidden},
+			{user: 3, method: "POST", path: "/todos/1/move", body: `{"list_id":null}`, status: http.StatusForbidden},
+			{user: 3, method: "POST", path: "/todos", body: `{"title":"own"}`, status: http.StatusCreated},
+			{user: 3, method: "POST", path: "/todos/3/move", body: `{"list_id":1}`, status: http.StatusForbidden},
+			{method: "GET", path: "/todos/1", status: http.StatusOK, contains: `"version":1}`},
+			{method: "GET", path: "/todos?list_id=1", status: http.StatusOK, contains: `"version":1}],"next_cursor":null`},
+		}),
+		"editors move within the owner's lists": sharedCase([]step{
+			{method: "POST", path: "/lists", body: `{"name":"Other"}`, status: http.StatusCreated},
+			{user: 2, method: "POST", path: "/todos/1/move", body: `{"list_id":2}`, status: http.StatusUnprocessableEntity},
+			{method: "POST", path: "/lists/2/invites", body: `{"email":"user2@example.com","role":"editor"}`, status: http.StatusCreated},
+			{user: 2, method: "POST", path: "/invites/3/accept", status: http.StatusOK},
+			{user: 2, method: "POST", path: "/todos/1/move", body: `{"list_id":2}`, status: http.StatusOK, contains: `"list_id":2`},
+			{user: 2, method: "POST", path: "/todos/1/move", body: `{"list_id":null}`, status: http.StatusForbidden},
+		}),
+	})
+}
+
+// TestImportMaxRows imports as many todos as a file may have, more than
+// one statement can bind the parameters of
+func TestImportMaxRows(t *testing.T) {
+	rows := make([]string, maxImportRows)
+	for i := range rows {
+		rows[i] = `{"title":"todo ` + strconv.Itoa(i+1) + `","tags":["bulk"]}`
+	}
+	for storeName, open := range testStores {
+		t.Run(storeName, func(t *testing.T) {
+			newTestAPI(t, open(t)).run([]step{
+				{method: "POST", path: "/import?format=json", body: "[" + strings.Join(rows, ",") + "]", status: http.StatusCreated, contains: `"imported":` + strconv.Itoa(maxImportRows)},
+				{method: "GET", path: "/todos/" + strconv.Itoa(maxImportRows), status: http.StatusOK, contains: `"tags":["bulk"]`},
+			})
+		})
+	}
+}
+
+// TestWebhooksQueuedWithChanges checks that every change announced to
+// webhooks, subtasks changed with their parent included, is queued with it,
+// and that a batch rolled back queues nothing
+func TestWebhooksQueuedWithChanges(t *testing.T) {
+	ctx := tenant.With(context.Background(), tenant.Default)
+	for storeName, open := range testStores {
+		t.Run(storeName, func(t *testing.T) {
+			store := open(t)
+			api := newTestAPI(t, store)
+			webhook := models.Webhook{UserID: 1, URL: "https://example.com/hook", Events: []string{"*"}, Secret: "s3cret", Active: true}
+			if err := store.Webhooks.Create(ctx, &webhook); err != nil {
+				t.Fatal(err)
+			}
+			api.run([]step{
+				{method: "POST", path: "/todos", body: `{"title":"parent"}`, status: http.StatusCreated},
+				{method: "POST", path: "/todos", body: `{"title":"child","parent_id":1}`, status: http.StatusCreated},
+				{method: "POST", path: "/batch", body: `{"operations":[{"op":"create","todo":{"title":"x"}},{"op":"create","todo":{"title":"y","parent_id":42}}]}`, status: http.StatusUnprocessableEntity},
+				{method: "PUT", path: "/todos/1?children=complete", body: `{"title":"parent","completed":true}`, status: http.StatusOK},
+				{method: "DELETE", path: "/todos/1", status: http.StatusOK},
+			})
+
+			deliveries, err := store.Webhooks.Deliveries(ctx, 1, webhook.ID, 0, 100)
+			if err != nil {
+				t.Fatal(err)
+			}
+			queued := map[string]int{}
+			for _, delivery := range deliveries {
+				queued[delivery.Event]++
+			}
+			want := map[string]int{events.TodoCreated: 2, events.TodoUpdated: 2, events.TodoCompleted: 2, events.TodoDeleted: 2}
+			if !reflect.DeepEqual(queued, want) {
+				t.Errorf("queued %v, want %v", queued, want)
+			}
+		})
+	}
+}
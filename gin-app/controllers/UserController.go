@@ -0,0 +1,64 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"gin-app/middleware"
+	"gin-app/models"
+	"gin-app/recurrence"
+	"gin-app/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+type UserControllerType struct {
+	Users repository.UserRepository
+}
+
+func UserController(users repository.UserRepository) *UserControllerType {
+	return &UserControllerType{Users: users}
+}
+
+// GetMe returns the authenticated user's account
+func (uc *UserControllerType) GetMe(c *gin.Context) {
+	user, err := uc.Users.Get(c.Request.Context(), c.GetInt(middleware.UserIDKey))
+	if err != nil {
+		respondUserError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// UpdateMe changes the authenticated user's profile settings
+func (uc *UserControllerType) UpdateMe(c *gin.Context) {
+	var profile models.Profile
+	if err := c.ShouldBindJSON(&profile); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if _, err := recurrence.Location(profile.Timezone); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "timezone must be an IANA time zone name such as Europe/Berlin"})
+		return
+	}
+
+	userID := c.GetInt(middleware.UserIDKey)
+	if err := uc.Users.SetTimezone(c.Request.Context(), userID, profile.Timezone); err != nil {
+		respondUserError(c, err)
+		return
+	}
+
+	uc.GetMe(c)
+}
+
+// respondUserError maps repository errors to HTTP responses. A valid token
+// whose user no longer exists gets 404.
+func respondUserError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
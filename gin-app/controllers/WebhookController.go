@@ -0,0 +1,208 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"gin-app/middleware"
+	"gin-app/models"
+	"gin-app/repository"
+	"gin-app/webhooks"
+
+	"github.com/gin-gonic/gin"
+)
+
+type WebhookControllerType struct {
+	Webhooks repository.WebhookRepository
+	// AllowPrivate accepts URLs on loopback, private and link-local addresses
+	AllowPrivate bool
+}
+
+func WebhookController(webhooks repository.WebhookRepository, allowPrivate bool) *WebhookControllerType {
+	return &WebhookControllerType{Webhooks: webhooks, AllowPrivate: allowPrivate}
+}
+
+func (wc *WebhookControllerType) GetWebhooks(c *gin.Context) {
+	webhooks, err := wc.Webhooks.List(c.Request.Context(), c.GetInt(middleware.UserIDKey))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, webhooks)
+}
+
+func (wc *WebhookControllerType) GetWebhook(c *gin.Context) {
+	id, ok := webhookID(c)
+	if !ok {
+		return
+	}
+
+	webhook, err := wc.Webhooks.Get(c.Request.Context(), c.GetInt(middleware.UserIDKey), id)
+	if err != nil {
+		respondWebhookError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, webhook)
+}
+
+// CreateWebhook subscribes a URL to events. The response is the only one
+// that includes the signing secret.
+func (wc *WebhookControllerType) CreateWebhook(c *gin.Context) {
+	webhook, ok := bindWebhook(c, wc.AllowPrivate)
+	if !ok {
+		return
+	}
+	if webhook.Secret == "" {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		webhook.Secret = hex.EncodeToString(secret)
+	}
+
+	if err := wc.Webhooks.Create(c.Request.Context(), &webhook); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, webhook)
+}
+
+// UpdateWebhook replaces a webhook's settings, rotating the secret if one is given
+func (wc *WebhookControllerType) UpdateWebhook(c *gin.Context) {
+	id, ok := webhookID(c)
+	if !ok {
+		return
+	}
+	webhook, ok := bindWebhook(c, wc.AllowPrivate)
+	if !ok {
+		return
+	}
+	webhook.ID = id
+
+	if err := wc.Webhooks.Update(c.Request.Context(), &webhook); err != nil {
+		respondWebhookError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, webhook)
+}
+
+func (wc *WebhookControllerType) DeleteWebhook(c *gin.Context) {
+	id, ok := webhookID(c)
+	if !ok {
+		return
+	}
+
+	if err := wc.Webhooks.Delete(c.Request.Context(), c.GetInt(middleware.UserIDKey), id); err != nil {
+		respondWebhookError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook deleted successfully"})
+}
+
+// GetDeliveries returns a webhook's delivery log, newest first. Query
+// parameters: limit=1..200 and before=<delivery id> for the next page.
+func (wc *WebhookControllerType) GetDeliveries(c *gin.Context) {
+	id, ok := webhookID(c)
+	if !ok {
+		return
+	}
+
+	limit := defaultPageSize
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxPageSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", maxPageSize)})
+			return
+		}
+		limit = n
+	}
+	before := 0
+	if v := c.Query("before"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "before must be a delivery id"})
+			return
+		}
+		before = n
+	}
+
+	deliveries, err := wc.Webhooks.Deliveries(c.Request.Context(), c.GetInt(middleware.UserIDKey), id, before, limit)
+	if err != nil {
+		respondWebhookError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, deliveries)
+}
+
+// RedeliverDelivery queues a delivery again, typically a dead letter, with a
+// fresh set of attempts
+func (wc *WebhookControllerType) RedeliverDelivery(c *gin.Context) {
+	id, ok := webhookID(c)
+	if !ok {
+		return
+	}
+	deliveryID, err := strconv.Atoi(c.Param("delivery_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid delivery id"})
+		return
+	}
+
+	if err := wc.Webhooks.Redeliver(c.Request.Context(), c.GetInt(middleware.UserIDKey), id, deliveryID); err != nil {
+		respondWebhookError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "Delivery queued"})
+}
+
+// bindWebhook reads a WebhookInput, writing a 400 response when it is invalid
+func bindWebhook(c *gin.Context, allowPrivate bool) (models.Webhook, bool) {
+	var input models.WebhookInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return models.Webhook{}, false
+	}
+	if err := webhooks.CheckURL(input.URL, allowPrivate); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return models.Webhook{}, false
+	}
+
+	webhook := models.Webhook{
+		UserID: c.GetInt(middleware.UserIDKey),
+		URL:    input.URL,
+		Events: input.Events,
+		Secret: input.Secret,
+		Active: input.Active == nil || *input.Active,
+	}
+	return webhook, true
+}
+
+// webhookID parses the :id path parameter, writing a 400 response when it is not a number
+func webhookID(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook id"})
+		return 0, false
+	}
+	return id, true
+}
+
+func respondWebhookError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
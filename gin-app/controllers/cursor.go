@@ -0,0 +1,79 @@
+package controllers
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+
+	"gin-app/repository"
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// cursorPayload is the sealed content of a next_cursor token. It pins the
+// sort and filters so a cursor cannot be replayed against a different listing.
+type cursorPayload struct {
+	Sort     string                `json:"s"`
+	Desc     bool                  `json:"d"`
+	Filter   string                `json:"f"`
+	Position repository.TodoCursor `json:"p"`
+}
+
+// encodeCursor returns base64url(nonce || AES-GCM(payload)). The position
+// holds the title of the last todo of the page, so the payload is encrypted
+// rather than only signed: a cursor shared in a link or logged by a proxy
+// reveals nothing of the listing.
+func encodeCursor(key []byte, payload cursorPayload) (string, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	aead, err := cursorCipher(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(body)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(aead.Seal(nonce, nonce, body, nil)), nil
+}
+
+// decodeCursor authenticates the token before trusting any of the payload
+func decodeCursor(key []byte, token string) (cursorPayload, error) {
+	var payload cursorPayload
+	sealed, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return payload, errInvalidCursor
+	}
+	aead, err := cursorCipher(key)
+	if err != nil {
+		return payload, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return payload, errInvalidCursor
+	}
+	body, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return payload, errInvalidCursor
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return payload, errInvalidCursor
+	}
+	return payload, nil
+}
+
+// cursorCipher is AES-256-GCM under the SHA-256 of key, which may be of
+// any length
+func cursorCipher(key []byte) (cipher.AEAD, error) {
+	sum := sha256.Sum256(key)
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
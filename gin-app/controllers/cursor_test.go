@@ -0,0 +1,53 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"gin-app/repository"
+)
+
+func TestCursorSealed(t *testing.T) {
+	key := []byte("cursor key")
+	payload := cursorPayload{
+		Sort:     repository.SortTitle,
+		Filter:   "filter",
+		Position: repository.TodoCursor{ID: 7, Title: "Buy a ring for Alex", CreatedAt: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)},
+	}
+	token, err := encodeCursor(key, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := decodeCursor(key, token)
+	if err != nil || got != payload {
+		t.Fatalf("decoded %+v, %v", got, err)
+	}
+
+	sealed, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(sealed, []byte("ring")) {
+		t.Error("the cursor shows the title of the last todo")
+	}
+	if again, _ := encodeCursor(key, payload); again == token {
+		t.Error("the same position always gives the same cursor")
+	}
+
+	tampered := append([]byte{}, sealed...)
+	tampered[len(tampered)-1] ^= 1
+	for name, bad := range map[string]string{
+		"tampered":  base64.RawURLEncoding.EncodeToString(tampered),
+		"truncated": base64.RawURLEncoding.EncodeToString(sealed[:4]),
+		"garbage":   "not a cursor",
+	} {
+		if _, err := decodeCursor(key, bad); err != errInvalidCursor {
+			t.Errorf("%s cursor: got %v", name, err)
+		}
+	}
+	if _, err := decodeCursor([]byte("other key"), token); err != errInvalidCursor {
+		t.Errorf("cursor of another key: got %v", err)
+	}
+}
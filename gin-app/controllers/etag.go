@@ -0,0 +1,43 @@
+package controllers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+
+	"gin-app/models"
+)
+
+// todoETag returns the strong entity tag of a todo, which is its version
+func todoETag(todo models.Todo) string {
+	return `"` + strconv.Itoa(todo.Version) + `"`
+}
+
+// bodyETag returns a weak entity tag for a response body
+func bodyETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `W/"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// etagMatches reports whether an If-Match or If-None-Match header value
+// lists etag or is "*". weak selects the weak comparison of If-None-Match;
+// otherwise weak tags never match, as If-Match requires.
+func etagMatches(header, etag string, weak bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if weak {
+			if strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+			continue
+		}
+		if candidate == etag && !strings.HasPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
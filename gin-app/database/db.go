@@ -1,35 +1,144 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
-	"log"
+	"log/slog"
 
-	_ "github.com/lib/pq" // PostgreSQL driver
+	"gin-app/config"
+
+	_ "github.com/lib/pq"  // PostgreSQL driver
+	_ "modernc.org/sqlite" // SQLite driver
+)
+
+// Supported SQL dialects
+const (
+	DialectPostgres = "postgres"
+	DialectSQLite   = "sqlite"
 )
 
 var db *sql.DB
 
-// Initialize the database connection
-func InitDB() {
-	var err error
-	connStr := "user=postgres dbname=todo_db sslmode=disable password=postgress host=localhost port=5432"
+// workerDB connects as the role of migrations and background workers, which
+// bypasses row-level security to act for every tenant. SQLite has no roles,
+// so it is db there.
+var workerDB *sql.DB
+
+var dialect string
 
-	// connStr := "user=postgres dbname=todo_db sslmode=disable password=yourpassword host=postgres port=5432"
-	db, err = sql.Open("postgres", connStr)
+// Initialize the database connections for the configured driver
+func InitDB(cfg config.DatabaseConfig) error {
+	var err error
+	switch cfg.Driver {
+	case DialectSQLite:
+		db, err = openInstrumented("sqlite", cfg.SQLitePath)
+		workerDB = db
+	default:
+		db, err = openInstrumented("postgres", cfg.PostgresDSN())
+		if err == nil {
+			workerDB, err = openInstrumented("postgres", cfg.WorkerDSN())
+		}
+	}
 	if err != nil {
-		log.Fatalf("Error opening database: %v", err)
+		return fmt.Errorf("opening database: %w", err)
 	}
+	dialect = cfg.Driver
 
-	err = db.Ping()
-	if err != nil {
-		log.Fatalf("Error connecting to database: %v", err)
+	if dialect == DialectSQLite {
+		// SQLite serialises writers; a single connection avoids SQLITE_BUSY and
+		// keeps ":memory:" databases from being created once per connection
+		db.SetMaxOpenConns(1)
+
+		if _, err = db.Exec("PRAGMA foreign_keys = ON"); err != nil {
+			return fmt.Errorf("connecting to database: %w", err)
+		}
 	}
 
-	fmt.Println("Connected to the database!")
+	if err = db.Ping(); err != nil {
+		return fmt.Errorf("connecting to database: %w", err)
+	}
+	if err = workerDB.Ping(); err != nil {
+		return fmt.Errorf("connecting to database as the worker role: %w", err)
+	}
+
+	slog.Info("Connected to the database", "driver", dialect)
+	return nil
 }
 
 // GetDB returns the database instance
 func GetDB() *sql.DB {
 	return db
 }
+
+// GetWorkerDB returns the database instance of migrations and background
+// workers
+func GetWorkerDB() *sql.DB {
+	return workerDB
+}
+
+// Close closes the database connections
+func Close() error {
+	if workerDB != db {
+		workerDB.Close()
+	}
+	return db.Close()
+}
+
+// GetDialect returns the dialect of the open database
+func GetDialect() string {
+	return dialect
+}
+
+// Migrate applies all pending migrations to the open database, as the
+// worker role
+func Migrate() error {
+	migrator, err := NewMigrator(workerDB, dialect)
+	if err != nil {
+		return err
+	}
+	applied, err := migrator.Up(context.Background())
+	for _, m := range applied {
+		slog.Info("Applied migration", "version", m.Version, "name", m.Name)
+	}
+	return err
+}
+
+// CheckRowSecurity fails unless row-level security binds the Postgres role
+// that serves requests, and not the worker role. Requests must see only the
+// rows of their tenant, which superusers and roles with BYPASSRLS see past
+// even on tables that force it. Workers act for every tenant, so their role
+// needs BYPASSRLS to see any rows at all.
+func CheckRowSecurity(ctx context.Context) error {
+	if dialect != DialectPostgres {
+		return nil
+	}
+	user, bypasses, err := bypassesRowSecurity(ctx, db)
+	if err != nil {
+		return err
+	}
+	if bypasses {
+		return fmt.Errorf("database role %q is a superuser or has BYPASSRLS, so row-level security would not keep tenants apart; connect as a role without either", user)
+	}
+	worker, bypasses, err := bypassesRowSecurity(ctx, workerDB)
+	if err != nil {
+		return err
+	}
+	if !bypasses {
+		return fmt.Errorf("database worker role %q does not have BYPASSRLS, so background workers would see no tenant's rows; set database.worker_user to a role with it", worker)
+	}
+	return nil
+}
+
+// bypassesRowSecurity reports the Postgres role of conn, and whether it is a
+// superuser or has BYPASSRLS
+func bypassesRowSecurity(ctx context.Context, conn *sql.DB) (string, bool, error) {
+	var user string
+	var bypasses bool
+	err := conn.QueryRowContext(ctx, "SELECT rolname, rolsuper OR rolbypassrls FROM pg_roles WHERE rolname = current_user").
+		Scan(&user, &bypasses)
+	if err != nil {
+		return "", false, fmt.Errorf("checking the database role: %w", err)
+	}
+	return user, bypasses, nil
+}
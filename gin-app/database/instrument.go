@@ -0,0 +1,343 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"gin-app/logging"
+	"gin-app/tenant"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName identifies the spans of SQL statements
+const tracerName = "gin-app/database"
+
+// openInstrumented opens a database whose statements are traced as child
+// spans of the request that ran them, and logged at debug level to its
+// logger with their duration and redacted arguments. Postgres sessions are
+// also scoped to the tenant of each statement's context.
+func openInstrumented(driverName, dsn string) (*sql.DB, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return nil, err
+	}
+	d := db.Driver()
+	db.Close()
+
+	var connector driver.Connector = dsnConnector{driver: d, dsn: dsn}
+	if dc, ok := d.(driver.DriverContext); ok {
+		if connector, err = dc.OpenConnector(dsn); err != nil {
+			return nil, err
+		}
+	}
+
+	system := semconv.DBSystemPostgreSQL
+	if driverName == "sqlite" {
+		system = semconv.DBSystemSqlite
+	}
+	return sql.OpenDB(instrumentedConnector{Connector: connector, system: system, scoped: driverName == "postgres"}), nil
+}
+
+// dsnConnector adapts drivers that only open connections by name
+type dsnConnector struct {
+	driver driver.Driver
+	dsn    string
+}
+
+func (c dsnConnector) Connect(context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.dsn)
+}
+
+func (c dsnConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+type instrumentedConnector struct {
+	driver.Connector
+	system attribute.KeyValue
+	scoped bool
+}
+
+func (c instrumentedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedConn{Conn: conn, system: c.system, scoped: c.scoped}, nil
+}
+
+// instrumentedConn traces and logs the statements run directly on a
+// connection, which is how both drivers run every query with arguments, in
+// or out of transactions. Every other call is passed through.
+type instrumentedConn struct {
+	driver.Conn
+	system attribute.KeyValue
+	// scoped connections keep app.tenant_id set to the tenant of the
+	// statements they run; tenant holds its current value
+	scoped bool
+	tenant string
+}
+
+// unknownTenant is the tenant of a session whose setting may have been
+// rolled back, which is never current
+const unknownTenant = "?"
+
+// scope sets app.tenant_id to the tenant of ctx unless it is set already.
+// Row-level security policies read it, and it is the default of the
+// tenant_id columns.
+func (c *instrumentedConn) scope(ctx context.Context) error {
+	setting := tenant.Setting(ctx)
+	if !c.scoped || setting == c.tenant {
+		return nil
+	}
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return fmt.Errorf("%T cannot set the tenant of its session", c.Conn)
+	}
+	if _, err := execer.ExecContext(ctx, "SELECT set_config('app.tenant_id', $1, false)", []driver.NamedValue{{Ordinal: 1, Value: setting}}); err != nil {
+		return err
+	}
+	c.tenant = setting
+	return nil
+}
+
+func (c *instrumentedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	if err := c.scope(ctx); err != nil {
+		return nil, err
+	}
+	ctx, span := c.start(ctx, query)
+	start := time.Now()
+	result, err := execer.ExecContext(ctx, query, args)
+	end(span, err)
+	logStatement(ctx, query, args, start, err)
+	return result, err
+}
+
+func (c *instrumentedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	if err := c.scope(ctx); err != nil {
+		return nil, err
+	}
+	ctx, span := c.start(ctx, query)
+	start := time.Now()
+	rows, err := queryer.QueryContext(ctx, query, args)
+	end(span, err)
+	logStatement(ctx, query, args, start, err)
+	return rows, err
+}
+
+func (c *instrumentedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if err := c.scope(ctx); err != nil {
+		return nil, err
+	}
+	var stmt driver.Stmt
+	var err error
+	if preparer, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		stmt, err = preparer.PrepareContext(ctx, query)
+	} else {
+		stmt, err = c.Conn.Prepare(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedStmt{Stmt: stmt, conn: c, query: query}, nil
+}
+
+// instrumentedStmt scopes, traces and logs every execution of a prepared
+// statement, which may run long after it was prepared and for another
+// tenant
+type instrumentedStmt struct {
+	driver.Stmt
+	conn  *instrumentedConn
+	query string
+}
+
+func (s *instrumentedStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	if err := s.conn.scope(ctx); err != nil {
+		return nil, err
+	}
+	ctx, span := s.conn.start(ctx, s.query)
+	start := time.Now()
+	var result driver.Result
+	var err error
+	if execer, ok := s.Stmt.(driver.StmtExecContext); ok {
+		result, err = execer.ExecContext(ctx, args)
+	} else {
+		result, err = s.Stmt.Exec(values(args))
+	}
+	end(span, err)
+	logStatement(ctx, s.query, args, start, err)
+	return result, err
+}
+
+func (s *instrumentedStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	if err := s.conn.scope(ctx); err != nil {
+		return nil, err
+	}
+	ctx, span := s.conn.start(ctx, s.query)
+	start := time.Now()
+	var rows driver.Rows
+	var err error
+	if queryer, ok := s.Stmt.(driver.StmtQueryContext); ok {
+		rows, err = queryer.QueryContext(ctx, args)
+	} else {
+		rows, err = s.Stmt.Query(values(args))
+	}
+	end(span, err)
+	logStatement(ctx, s.query, args, start, err)
+	return rows, err
+}
+
+// values drops the names of arguments, for statements that predate them
+func values(args []driver.NamedValue) []driver.Value {
+	vs := make([]driver.Value, len(args))
+	for i, arg := range args {
+		vs[i] = arg.Value
+	}
+	return vs
+}
+
+// BeginTx scopes the session before the transaction begins, so that the
+// setting outlives it. A setting changed within a transaction that is rolled
+// back reverts, so the tenant is then set again before the next statement.
+func (c *instrumentedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if err := c.scope(ctx); err != nil {
+		return nil, err
+	}
+	var tx driver.Tx
+	var err error
+	if beginner, ok := c.Conn.(driver.ConnBeginTx); ok {
+		tx, err = beginner.BeginTx(ctx, opts)
+	} else {
+		tx, err = c.Conn.Begin()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return scopedTx{Tx: tx, conn: c}, nil
+}
+
+type scopedTx struct {
+	driver.Tx
+	conn *instrumentedConn
+}
+
+func (t scopedTx) Rollback() error {
+	t.conn.tenant = unknownTenant
+	return t.Tx.Rollback()
+}
+
+func (c *instrumentedConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *instrumentedConn) ResetSession(ctx context.Context) error {
+	if resetter, ok := c.Conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *instrumentedConn) IsValid() bool {
+	if validator, ok := c.Conn.(driver.Validator); ok {
+		return validator.IsValid()
+	}
+	return true
+}
+
+func (c *instrumentedConn) CheckNamedValue(value *driver.NamedValue) error {
+	if checker, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(value)
+	}
+	return driver.ErrSkip
+}
+
+// start begins the span of a statement, named after its operation. The
+// statement text is recorded as is: arguments are never part of it. Only
+// statements run within a trace get spans, which leaves out the polling of
+// background workers.
+func (c *instrumentedConn) start(ctx context.Context, query string) (context.Context, trace.Span) {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return ctx, trace.SpanFromContext(ctx)
+	}
+	operation, _, _ := strings.Cut(strings.TrimSpace(query), " ")
+	operation = strings.ToUpper(operation)
+	return otel.Tracer(tracerName).Start(ctx, operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(c.system, semconv.DBOperationName(operation), semconv.DBQueryText(normalize(query))),
+	)
+}
+
+func end(span trace.Span, err error) {
+	if err != nil && err != driver.ErrSkip {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func logStatement(ctx context.Context, query string, args []driver.NamedValue, start time.Time, err error) {
+	logger := logging.FromContext(ctx)
+	if !logger.Enabled(ctx, slog.LevelDebug) || err == driver.ErrSkip {
+		return
+	}
+	attrs := []any{
+		"sql", normalize(query),
+		"args", redact(args),
+		"duration_ms", milliseconds(time.Since(start)),
+	}
+	if err != nil {
+		attrs = append(attrs, "error", err)
+	}
+	logger.DebugContext(ctx, "SQL statement", attrs...)
+}
+
+// normalize puts a statement on one line
+func normalize(query string) string {
+	return strings.Join(strings.Fields(query), " ")
+}
+
+// redact keeps the arguments that cannot hold personal data or secrets, such
+// as IDs, flags and times, and replaces text and bytes with their size
+func redact(args []driver.NamedValue) []any {
+	values := make([]any, len(args))
+	for i, arg := range args {
+		switch v := arg.Value.(type) {
+		case string:
+			values[i] = redacted(len(v))
+		case []byte:
+			values[i] = redacted(len(v))
+		default:
+			values[i] = v
+		}
+	}
+	return values
+}
+
+func redacted(n int) string {
+	return fmt.Sprintf("[redacted %d bytes]", n)
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
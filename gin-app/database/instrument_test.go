@@ -0,0 +1,81 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"reflect"
+	"testing"
+
+	"gin-app/tenant"
+)
+
+// recordingConn records the statements run on it and the first argument of
+// each, which is the tenant of set_config calls
+type recordingConn struct {
+	statements []string
+}
+
+func (c *recordingConn) Prepare(string) (driver.Stmt, error) { return nil, driver.ErrSkip }
+func (c *recordingConn) Close() error                        { return nil }
+func (c *recordingConn) Begin() (driver.Tx, error)           { return recordingTx{}, nil }
+
+func (c *recordingConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if query == "SELECT set_config('app.tenant_id', $1, false)" {
+		query = "tenant " + args[0].Value.(string)
+	}
+	c.statements = append(c.statements, query)
+	return driver.RowsAffected(0), nil
+}
+
+type recordingTx struct{}
+
+func (recordingTx) Commit() error   { return nil }
+func (recordingTx) Rollback() error { return nil }
+
+func TestScope(t *testing.T) {
+	ctx := context.Background()
+	one, two := tenant.With(ctx, 1), tenant.With(ctx, 2)
+	exec := func(c *instrumentedConn, ctx context.Context) {
+		t.Helper()
+		if _, err := c.ExecContext(ctx, "UPDATE todos", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	conn := &recordingConn{}
+	c := &instrumentedConn{Conn: conn, scoped: true}
+	exec(c, one)
+	exec(c, one)
+	exec(c, two)
+	exec(c, tenant.All(ctx))
+	exec(c, ctx)
+	// A rolled back transaction may have reverted the setting, which is
+	// then set again even for the same tenant
+	tx, err := c.BeginTx(two, driver.TxOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	exec(c, two)
+	tx.Rollback()
+	exec(c, two)
+
+	want := []string{
+		"tenant 1", "UPDATE todos", "UPDATE todos",
+		"tenant 2", "UPDATE todos",
+		"tenant all", "UPDATE todos",
+		"tenant ", "UPDATE todos",
+		"tenant 2", "UPDATE todos",
+		"tenant 2", "UPDATE todos",
+	}
+	if !reflect.DeepEqual(conn.statements, want) {
+		t.Errorf("scoped connection ran %q, want %q", conn.statements, want)
+	}
+
+	conn = &recordingConn{}
+	c = &instrumentedConn{Conn: conn}
+	exec(c, one)
+	exec(c, two)
+	if want := []string{"UPDATE todos", "UPDATE todos"}; !reflect.DeepEqual(conn.statements, want) {
+		t.Errorf("unscoped connection ran %q, want %q", conn.statements, want)
+	}
+}
@@ -0,0 +1,368 @@
+package database
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gin-app/tenant"
+)
+
+//go:embed migrations
+var migrationFS embed.FS
+
+// migrationLockKey is the pg_advisory_lock key held while migrating, so
+// replicas starting at the same time apply each migration exactly once
+const migrationLockKey int64 = 0x67696e617070 // "ginapp"
+
+var migrationFile = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// Migration is one versioned schema change
+type Migration struct {
+	Version  int
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+// MigrationStatus reports whether a migration has been applied
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+	// Modified is set when the applied checksum differs from the embedded file
+	Modified bool
+	// Missing is set for applied versions that are no longer in the binary
+	Missing bool
+}
+
+// Migrator applies the embedded migrations for a dialect to a database
+type Migrator struct {
+	db         *sql.DB
+	dialect    string
+	migrations []Migration
+}
+
+// NewMigrator loads the migrations embedded for the given dialect
+func NewMigrator(db *sql.DB, dialect string) (*Migrator, error) {
+	sub, err := fs.Sub(migrationFS, path.Join("migrations", dialect))
+	if err != nil {
+		return nil, err
+	}
+	migrations, err := LoadMigrations(sub)
+	if err != nil {
+		return nil, fmt.Errorf("loading %s migrations: %w", dialect, err)
+	}
+	return &Migrator{db: db, dialect: dialect, migrations: migrations}, nil
+}
+
+// LoadMigrations reads NNNN_name.up.sql / NNNN_name.down.sql pairs from fsys
+// and returns them sorted by version
+func LoadMigrations(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		match := migrationFile.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+		version, _ := strconv.Atoi(match[1])
+		body, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %04d_%s has no up file", m.Version, m.Name)
+		}
+		sum := sha256.Sum256([]byte(m.Up + "\x00" + m.Down))
+		m.Checksum = hex.EncodeToString(sum[:])
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+type appliedMigration struct {
+	checksum  string
+	appliedAt time.Time
+}
+
+// Up applies every pending migration in version order and returns the ones applied
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	// Migrations may change the rows of every tenant
+	ctx = tenant.All(ctx)
+	var done []Migration
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if err := m.verify(applied); err != nil {
+			return err
+		}
+
+		for _, mig := range m.migrations {
+			if _, ok := applied[mig.Version]; ok {
+				continue
+			}
+			err := m.inTx(ctx, conn, mig.Up, "INSERT INTO schema_migrations (version, name, checksum) VALUES ($1, $2, $3)", mig.Version, mig.Name, mig.Checksum)
+			if err != nil {
+				return fmt.Errorf("applying %04d_%s: %w", mig.Version, mig.Name, err)
+			}
+			done = append(done, mig)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down rolls back the most recently applied migrations, newest first
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	ctx = tenant.All(ctx)
+	var done []Migration
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if err := m.verify(applied); err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+			mig := m.migrations[i]
+			if _, ok := applied[mig.Version]; !ok {
+				continue
+			}
+			if mig.Down == "" {
+				return fmt.Errorf("migration %04d_%s has no down file", mig.Version, mig.Name)
+			}
+			err := m.inTx(ctx, conn, mig.Down, "DELETE FROM schema_migrations WHERE version = $1", mig.Version)
+			if err != nil {
+				return fmt.Errorf("reverting %04d_%s: %w", mig.Version, mig.Name, err)
+			}
+			done = append(done, mig)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Status lists every known migration along with any applied version the
+// binary no longer contains
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	var statuses []MigrationStatus
+	err := m.withConn(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		known := map[int]bool{}
+		for _, mig := range m.migrations {
+			known[mig.Version] = true
+			status := MigrationStatus{Migration: mig}
+			if a, ok := applied[mig.Version]; ok {
+				status.Applied = true
+				status.AppliedAt = a.appliedAt
+				status.Modified = a.checksum != mig.Checksum
+			}
+			statuses = append(statuses, status)
+		}
+		for version, a := range applied {
+			if !known[version] {
+				statuses = append(statuses, MigrationStatus{
+					Migration: Migration{Version: version, Checksum: a.checksum},
+					Applied:   true,
+					AppliedAt: a.appliedAt,
+					Missing:   true,
+				})
+			}
+		}
+		sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+		return nil
+	})
+	return statuses, err
+}
+
+// Pending returns the migrations that have not been applied yet
+func (m *Migrator) Pending(ctx context.Context) ([]Migration, error) {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var pending []Migration
+	for _, s := range statuses {
+		if !s.Applied {
+			pending = append(pending, s.Migration)
+		}
+	}
+	return pending, nil
+}
+
+// verify refuses to run when an applied migration was edited after the fact
+func (m *Migrator) verify(applied map[int]appliedMigration) error {
+	for _, mig := range m.migrations {
+		if a, ok := applied[mig.Version]; ok && a.checksum != mig.Checksum {
+			return fmt.Errorf("migration %04d_%s was modified after it was applied (checksum %s, file %s)",
+				mig.Version, mig.Name, a.checksum, mig.Checksum)
+		}
+	}
+	return nil
+}
+
+func (m *Migrator) applied(ctx context.Context, conn *sql.Conn) (map[int]appliedMigration, error) {
+	if _, err := conn.ExecContext(ctx, m.trackingTableDDL()); err != nil {
+		return nil, fmt.Errorf("creating schema_migrations: %w", err)
+	}
+
+	rows, err := conn.QueryContext(ctx, "SELECT version, checksum, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]appliedMigration{}
+	for rows.Next() {
+		var version int
+		var a appliedMigration
+		if err := rows.Scan(&version, &a.checksum, &a.appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = a
+	}
+	return applied, rows.Err()
+}
+
+func (m *Migrator) trackingTableDDL() string {
+	if m.dialect == DialectPostgres {
+		return `CREATE TABLE IF NOT EXISTS schema_migrations (
+	version BIGINT PRIMARY KEY,
+	name TEXT NOT NULL,
+	checksum TEXT NOT NULL,
+	applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+)`
+	}
+	return `CREATE TABLE IF NOT EXISTS schema_migrations (
+	version INTEGER PRIMARY KEY,
+	name TEXT NOT NULL,
+	checksum TEXT NOT NULL,
+	applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+)`
+}
+
+// inTx runs a migration body and its bookkeeping statement atomically
+func (m *Migrator) inTx(ctx context.Context, conn *sql.Conn, body, bookkeeping string, args ...interface{}) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, body); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, bookkeeping, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (m *Migrator) withConn(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return fn(conn)
+}
+
+// withLock runs fn while holding the migration advisory lock. Advisory locks
+// belong to a session, so everything runs on one pooled connection.
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	return m.withConn(ctx, func(conn *sql.Conn) error {
+		if m.dialect != DialectPostgres {
+			return fn(conn)
+		}
+
+		if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockKey); err != nil {
+			return fmt.Errorf("acquiring migration lock: %w", err)
+		}
+		defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockKey)
+		return fn(conn)
+	})
+}
+
+// CreateMigration writes an empty up/down pair with the next free version
+// into every dialect directory under dir and returns the created paths
+func CreateMigration(dir, name string) ([]string, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	name = regexp.MustCompile(`[^a-z0-9]+`).ReplaceAllString(name, "_")
+	name = strings.Trim(name, "_")
+	if name == "" {
+		return nil, errors.New("migration name is required")
+	}
+
+	dialects := []string{DialectPostgres, DialectSQLite}
+	next := 1
+	for _, dialect := range dialects {
+		migrations, err := LoadMigrations(os.DirFS(filepath.Join(dir, dialect)))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		if n := len(migrations); n > 0 && migrations[n-1].Version >= next {
+			next = migrations[n-1].Version + 1
+		}
+	}
+
+	var created []string
+	for _, dialect := range dialects {
+		if err := os.MkdirAll(filepath.Join(dir, dialect), 0o755); err != nil {
+			return created, err
+		}
+		for _, direction := range []string{"up", "down"} {
+			file := filepath.Join(dir, dialect, fmt.Sprintf("%04d_%s.%s.sql", next, name, direction))
+			body := fmt.Sprintf("-- %04d_%s (%s, %s)\n", next, name, dialect, direction)
+			if err := os.WriteFile(file, []byte(body), 0o644); err != nil {
+				return created, err
+			}
+			created = append(created, file)
+		}
+	}
+	return created, nil
+}
@@ -0,0 +1,192 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// openSQLiteMigrator returns a migrator of the embedded SQLite migrations
+// for a fresh database
+func openSQLiteMigrator(t *testing.T) *Migrator {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "todo.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	m, err := NewMigrator(db, DialectSQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestMigrateUpDown(t *testing.T) {
+	ctx := context.Background()
+	m := openSQLiteMigrator(t)
+	all := len(m.migrations)
+
+	if done, err := m.Up(ctx); err != nil || len(done) != all {
+		t.Fatalf("first Up applied %d of %d: %v", len(done), all, err)
+	}
+	if done, err := m.Up(ctx); err != nil || len(done) != 0 {
+		t.Fatalf("second Up applied %d: %v", len(done), err)
+	}
+
+	done, err := m.Down(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(done) != 2 || done[0].Version != m.migrations[all-1].Version || done[1].Version != m.migrations[all-2].Version {
+		t.Fatalf("Down(2) reverted %+v, want the newest two, newest first", done)
+	}
+	pending, err := m.Pending(ctx)
+	if err != nil || len(pending) != 2 {
+		t.Fatalf("pending after Down(2): %d, %v", len(pending), err)
+	}
+
+	// Every down migration reverts its up migration, so the schema can be
+	// taken down to nothing and built again
+	if done, err := m.Down(ctx, all); err != nil || len(done) != all-2 {
+		t.Fatalf("Down(all) reverted %d: %v", len(done), err)
+	}
+	if done, err := m.Up(ctx); err != nil || len(done) != all {
+		t.Fatalf("Up after Down(all) applied %d of %d: %v", len(done), all, err)
+	}
+}
+
+func TestMigrateRefusesModified(t *testing.T) {
+	ctx := context.Background()
+	m := openSQLiteMigrator(t)
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	edited := &Migrator{db: m.db, dialect: m.dialect, migrations: append([]Migration{}, m.migrations...)}
+	edited.migrations[0].Checksum = "edited"
+	for name, run := range map[string]func() error{
+		"up":   func() error { _, err := edited.Up(ctx); return err },
+		"down": func() error { _, err := edited.Down(ctx, 1); return err },
+	} {
+		if err := run(); err == nil || !strings.Contains(err.Error(), "was modified after it was applied") {
+			t.Errorf("%s: got %v, want the modified migration refused", name, err)
+		}
+	}
+
+	statuses, err := edited.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !statuses[0].Modified || statuses[1].Modified {
+		t.Errorf("modified flags: %v, %v", statuses[0].Modified, statuses[1].Modified)
+	}
+	// Nothing was reverted
+	if pending, err := m.Pending(ctx); err != nil || len(pending) != 0 {
+		t.Errorf("pending: %d, %v", len(pending), err)
+	}
+}
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := LoadMigrations(fstest.MapFS{
+		"0002_second.up.sql":   {Data: []byte("up 2")},
+		"0001_first.up.sql":    {Data: []byte("up 1")},
+		"0001_first.down.sql":  {Data: []byte("down 1")},
+		"README.md":            {Data: []byte("ignored")},
+		"0003_Invalid.up.sql":  {Data: []byte("ignored")},
+		"0002_second.down.sql": {Data: []byte("down 2")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) != 2 || migrations[0].Name != "first" || migrations[1].Down != "down 2" {
+		t.Fatalf("loaded %+v", migrations)
+	}
+	if migrations[0].Checksum == migrations[1].Checksum {
+		t.Error("migrations share a checksum")
+	}
+
+	for name, fsys := range map[string]fstest.MapFS{
+		"two names": {"0001_a.up.sql": {}, "0001_b.down.sql": {}},
+		"no up":     {"0001_a.down.sql": {Data: []byte("down")}},
+	} {
+		if _, err := LoadMigrations(fsys); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
+
+func TestCreateMigration(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, DialectSQLite), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, DialectSQLite, "0007_old.up.sql"), []byte("up"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	created, err := CreateMigration(dir, "Add Things!")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(created) != 4 || filepath.Base(created[0]) != "0008_add_things.up.sql" || filepath.Dir(created[0]) != filepath.Join(dir, DialectPostgres) {
+		t.Errorf("created %q", created)
+	}
+	if _, err := CreateMigration(dir, " -- "); err == nil {
+		t.Error("created a migration without a name")
+	}
+}
+
+// TestMigrateLocked holds the migration lock on another session, as a
+// replica migrating at the same time would, and checks that Up waits for it
+func TestMigrateLocked(t *testing.T) {
+	url := os.Getenv("TODO_TEST_DATABASE_WORKER_URL")
+	if url == "" {
+		t.Skip("TODO_TEST_DATABASE_WORKER_URL is not set")
+	}
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+	m, err := NewMigrator(db, DialectPostgres)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockKey); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := m.Up(ctx)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		t.Fatalf("Up ran while another session held the lock: %v", err)
+	case <-time.After(200 * time.Millisecond):
+	}
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", migrationLockKey); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(30 * time.Second):
+		t.Fatal("Up still waiting after the lock was released")
+	}
+}
@@ -0,0 +1,8 @@
+CREATE TABLE todos (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    title TEXT NOT NULL,
+    completed BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+CREATE INDEX todos_user_id_idx ON todos (user_id);
@@ -0,0 +1,12 @@
+ALTER TABLE todos ADD COLUMN created_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+-- Keyset pagination orders by (sort key, id) within one user's todos
+DROP INDEX todos_user_id_idx;
+CREATE INDEX todos_user_id_idx ON todos (user_id, id);
+CREATE INDEX todos_user_title_idx ON todos (user_id, title, id);
+CREATE INDEX todos_user_created_at_idx ON todos (user_id, created_at, id);
+CREATE INDEX todos_user_completed_idx ON todos (user_id, completed, id);
+
+-- Trigram index so title substring search (ILIKE '%q%') avoids a full scan
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+CREATE INDEX todos_title_trgm_idx ON todos USING gin (title gin_trgm_ops);
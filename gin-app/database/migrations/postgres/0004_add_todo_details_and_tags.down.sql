@@ -0,0 +1,13 @@
+DROP TABLE todo_tags;
+DROP TABLE tags;
+
+DROP INDEX todos_user_overdue_idx;
+DROP INDEX todos_user_due_at_idx;
+DROP INDEX todos_user_priority_idx;
+
+ALTER TABLE todos
+    DROP COLUMN completed_at,
+    DROP COLUMN updated_at,
+    DROP COLUMN due_at,
+    DROP COLUMN priority,
+    DROP COLUMN description;
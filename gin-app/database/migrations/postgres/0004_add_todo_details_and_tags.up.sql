@@ -0,0 +1,28 @@
+ALTER TABLE todos
+    ADD COLUMN description TEXT NOT NULL DEFAULT '',
+    ADD COLUMN priority SMALLINT NOT NULL DEFAULT 0 CHECK (priority BETWEEN 0 AND 3),
+    ADD COLUMN due_at TIMESTAMPTZ,
+    ADD COLUMN updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    ADD COLUMN completed_at TIMESTAMPTZ;
+
+-- The real completion time of existing rows is unknown; creation is the best bound
+UPDATE todos SET updated_at = created_at, completed_at = CASE WHEN completed THEN created_at END;
+
+CREATE INDEX todos_user_priority_idx ON todos (user_id, priority, id);
+CREATE INDEX todos_user_due_at_idx ON todos (user_id, due_at) WHERE due_at IS NOT NULL;
+CREATE INDEX todos_user_overdue_idx ON todos (user_id, due_at) WHERE NOT completed AND due_at IS NOT NULL;
+
+CREATE TABLE tags (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    UNIQUE (user_id, name)
+);
+
+CREATE TABLE todo_tags (
+    todo_id INTEGER NOT NULL REFERENCES todos (id) ON DELETE CASCADE,
+    tag_id INTEGER NOT NULL REFERENCES tags (id) ON DELETE CASCADE,
+    PRIMARY KEY (todo_id, tag_id)
+);
+
+CREATE INDEX todo_tags_tag_id_idx ON todo_tags (tag_id);
@@ -0,0 +1,8 @@
+DROP INDEX todos_series_occurrence_idx;
+
+ALTER TABLE todos
+    DROP COLUMN occurrence_at,
+    DROP COLUMN series_id,
+    DROP COLUMN recurrence;
+
+ALTER TABLE users DROP COLUMN timezone;
@@ -0,0 +1,11 @@
+ALTER TABLE users ADD COLUMN timezone TEXT NOT NULL DEFAULT 'UTC';
+
+-- series_id is the ID of the first todo of a recurring series. It is not a
+-- foreign key: the series lives on after that todo is deleted.
+ALTER TABLE todos
+    ADD COLUMN recurrence TEXT NOT NULL DEFAULT '',
+    ADD COLUMN series_id INTEGER,
+    ADD COLUMN occurrence_at TIMESTAMPTZ;
+
+-- Makes materializing an occurrence idempotent across restarts and instances
+CREATE UNIQUE INDEX todos_series_occurrence_idx ON todos (series_id, occurrence_at);
@@ -0,0 +1,3 @@
+-- Incremented by every write to a todo; exposed as its ETag for optimistic
+-- concurrency control
+ALTER TABLE todos ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
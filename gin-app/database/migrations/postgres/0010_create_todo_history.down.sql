@@ -0,0 +1,2 @@
+DROP TABLE todo_history;
+DROP FUNCTION todo_history_append_only();
@@ -0,0 +1,25 @@
+-- One row per change made to a todo through the API. todo_id is not a
+-- foreign key so that the record outlives a purged todo, and rows can be
+-- inserted and deleted but never changed.
+CREATE TABLE todo_history (
+    id BIGSERIAL PRIMARY KEY,
+    todo_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    actor_id INTEGER NOT NULL,
+    operation TEXT NOT NULL,
+    version INTEGER NOT NULL,
+    changes TEXT NOT NULL, -- JSON object of field -> {"before", "after"}
+    snapshot TEXT NOT NULL, -- JSON of the todo after the change
+    created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX todo_history_todo_id_idx ON todo_history (todo_id, id);
+
+CREATE FUNCTION todo_history_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'todo_history is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER todo_history_append_only BEFORE UPDATE ON todo_history
+    FOR EACH ROW EXECUTE FUNCTION todo_history_append_only();
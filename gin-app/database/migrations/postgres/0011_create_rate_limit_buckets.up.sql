@@ -0,0 +1,9 @@
+-- Token buckets of the Postgres rate limit store, keyed by route group and
+-- client. Rows of clients that have gone quiet are swept.
+CREATE UNLOGGED TABLE rate_limit_buckets (
+    key TEXT PRIMARY KEY,
+    tokens DOUBLE PRECISION NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX rate_limit_buckets_updated_at_idx ON rate_limit_buckets (updated_at);
@@ -0,0 +1,31 @@
+-- Without tenant_id the data of other tenants could not be told apart from
+-- the default tenant's, so the rollback refuses while there are any. Their
+-- data has to be exported and deleted first.
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM tenants WHERE id <> 1) THEN
+        RAISE EXCEPTION 'tenants other than the default one exist; delete them and their data before rolling back';
+    END IF;
+END
+$$;
+
+ALTER TABLE users
+    DROP CONSTRAINT users_tenant_email_key,
+    ADD CONSTRAINT users_email_key UNIQUE (email);
+
+DO $$
+DECLARE
+    t TEXT;
+BEGIN
+    FOREACH t IN ARRAY ARRAY['users', 'todos', 'tags', 'todo_tags', 'todo_dependencies', 'webhooks',
+        'webhook_deliveries', 'todo_history', 'lists', 'list_members', 'list_invites', 'idempotency_keys'] LOOP
+        EXECUTE format('DROP POLICY tenant_isolation ON %I', t);
+        EXECUTE format('ALTER TABLE %I NO FORCE ROW LEVEL SECURITY', t);
+        EXECUTE format('ALTER TABLE %I DISABLE ROW LEVEL SECURITY', t);
+        EXECUTE format('ALTER TABLE %I DROP COLUMN tenant_id', t);
+    END LOOP;
+END
+$$;
+
+DROP FUNCTION current_tenant_id();
+DROP TABLE tenants;
@@ -0,0 +1,46 @@
+-- Tenants are the organizations sharing the deployment. The rows that
+-- predate them belong to the default tenant.
+CREATE TABLE tenants (
+    id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE,
+    suspended_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL
+);
+
+INSERT INTO tenants (id, name, created_at) VALUES (1, 'default', now());
+SELECT setval('tenants_id_seq', 1);
+
+-- The tenant the session acts for, from the app.tenant_id setting the
+-- application keeps on every connection, or NULL when it acts for none or
+-- for all of them
+CREATE FUNCTION current_tenant_id() RETURNS INTEGER
+LANGUAGE sql STABLE
+AS $$
+    SELECT CASE WHEN current_setting('app.tenant_id', true) ~ '^[0-9]+$'
+        THEN current_setting('app.tenant_id', true)::INTEGER END
+$$;
+
+-- Every table of tenant data gets a tenant_id that defaults to the
+-- session's tenant, and a policy that shows and accepts only the rows of
+-- that tenant, or of all of them when app.tenant_id is 'all'. Policies are
+-- forced on the table owner too; only superusers and roles with BYPASSRLS
+-- get around them.
+DO $$
+DECLARE
+    t TEXT;
+BEGIN
+    FOREACH t IN ARRAY ARRAY['users', 'todos', 'tags', 'todo_tags', 'todo_dependencies', 'webhooks',
+        'webhook_deliveries', 'todo_history', 'lists', 'list_members', 'list_invites', 'idempotency_keys'] LOOP
+        EXECUTE format('ALTER TABLE %I ADD COLUMN tenant_id INTEGER NOT NULL DEFAULT 1 REFERENCES tenants (id)', t);
+        EXECUTE format('ALTER TABLE %I ALTER COLUMN tenant_id SET DEFAULT current_tenant_id()', t);
+        EXECUTE format('ALTER TABLE %I ENABLE ROW LEVEL SECURITY', t);
+        EXECUTE format('ALTER TABLE %I FORCE ROW LEVEL SECURITY', t);
+        EXECUTE format('CREATE POLICY tenant_isolation ON %I USING (tenant_id = current_tenant_id() OR current_setting(''app.tenant_id'', true) = ''all'')', t);
+    END LOOP;
+END
+$$;
+
+-- Emails are unique within a tenant
+ALTER TABLE users
+    DROP CONSTRAINT users_email_key,
+    ADD CONSTRAINT users_tenant_email_key UNIQUE (tenant_id, email);
@@ -0,0 +1,11 @@
+DO $$
+DECLARE
+    t TEXT;
+BEGIN
+    FOREACH t IN ARRAY ARRAY['users', 'todos', 'tags', 'todo_tags', 'todo_dependencies', 'webhooks',
+        'webhook_deliveries', 'todo_history', 'lists', 'list_members', 'list_invites', 'idempotency_keys'] LOOP
+        EXECUTE format('DROP POLICY tenant_isolation ON %I', t);
+        EXECUTE format('CREATE POLICY tenant_isolation ON %I USING (tenant_id = current_tenant_id() OR current_setting(''app.tenant_id'', true) = ''all'')', t);
+    END LOOP;
+END
+$$;
@@ -0,0 +1,16 @@
+-- Sessions that act for every tenant no longer see past the policies. Only
+-- the rows of the session's own tenant are shown and accepted; migrations
+-- and background workers connect as a role with BYPASSRLS instead. That
+-- role owns the tables, and the role that serves requests is granted access
+-- to them but bypasses nothing.
+DO $$
+DECLARE
+    t TEXT;
+BEGIN
+    FOREACH t IN ARRAY ARRAY['users', 'todos', 'tags', 'todo_tags', 'todo_dependencies', 'webhooks',
+        'webhook_deliveries', 'todo_history', 'lists', 'list_members', 'list_invites', 'idempotency_keys'] LOOP
+        EXECUTE format('DROP POLICY tenant_isolation ON %I', t);
+        EXECUTE format('CREATE POLICY tenant_isolation ON %I USING (tenant_id = current_tenant_id())', t);
+    END LOOP;
+END
+$$;
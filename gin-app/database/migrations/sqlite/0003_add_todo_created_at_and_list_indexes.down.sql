@@ -0,0 +1,7 @@
+DROP INDEX todos_user_completed_idx;
+DROP INDEX todos_user_created_at_idx;
+DROP INDEX todos_user_title_idx;
+DROP INDEX todos_user_id_idx;
+CREATE INDEX todos_user_id_idx ON todos (user_id);
+
+ALTER TABLE todos DROP COLUMN created_at;
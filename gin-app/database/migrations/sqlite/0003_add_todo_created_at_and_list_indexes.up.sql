@@ -0,0 +1,9 @@
+-- SQLite cannot add a column with a non-constant default, so backfill instead
+ALTER TABLE todos ADD COLUMN created_at TIMESTAMP NOT NULL DEFAULT '1970-01-01 00:00:00+00:00';
+UPDATE todos SET created_at = strftime('%Y-%m-%d %H:%M:%S+00:00', 'now');
+
+DROP INDEX todos_user_id_idx;
+CREATE INDEX todos_user_id_idx ON todos (user_id, id);
+CREATE INDEX todos_user_title_idx ON todos (user_id, title, id);
+CREATE INDEX todos_user_created_at_idx ON todos (user_id, created_at, id);
+CREATE INDEX todos_user_completed_idx ON todos (user_id, completed, id);
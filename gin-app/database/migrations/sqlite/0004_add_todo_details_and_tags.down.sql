@@ -0,0 +1,12 @@
+DROP TABLE todo_tags;
+DROP TABLE tags;
+
+DROP INDEX todos_user_overdue_idx;
+DROP INDEX todos_user_due_at_idx;
+DROP INDEX todos_user_priority_idx;
+
+ALTER TABLE todos DROP COLUMN completed_at;
+ALTER TABLE todos DROP COLUMN updated_at;
+ALTER TABLE todos DROP COLUMN due_at;
+ALTER TABLE todos DROP COLUMN priority;
+ALTER TABLE todos DROP COLUMN description;
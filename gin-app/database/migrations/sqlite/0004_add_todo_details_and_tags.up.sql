@@ -0,0 +1,27 @@
+ALTER TABLE todos ADD COLUMN description TEXT NOT NULL DEFAULT '';
+ALTER TABLE todos ADD COLUMN priority INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE todos ADD COLUMN due_at TIMESTAMP;
+ALTER TABLE todos ADD COLUMN updated_at TIMESTAMP NOT NULL DEFAULT '1970-01-01 00:00:00+00:00';
+ALTER TABLE todos ADD COLUMN completed_at TIMESTAMP;
+
+-- The real completion time of existing rows is unknown; creation is the best bound
+UPDATE todos SET updated_at = created_at, completed_at = CASE WHEN completed THEN created_at END;
+
+CREATE INDEX todos_user_priority_idx ON todos (user_id, priority, id);
+CREATE INDEX todos_user_due_at_idx ON todos (user_id, due_at) WHERE due_at IS NOT NULL;
+CREATE INDEX todos_user_overdue_idx ON todos (user_id, due_at) WHERE NOT completed AND due_at IS NOT NULL;
+
+CREATE TABLE tags (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    UNIQUE (user_id, name)
+);
+
+CREATE TABLE todo_tags (
+    todo_id INTEGER NOT NULL REFERENCES todos (id) ON DELETE CASCADE,
+    tag_id INTEGER NOT NULL REFERENCES tags (id) ON DELETE CASCADE,
+    PRIMARY KEY (todo_id, tag_id)
+);
+
+CREATE INDEX todo_tags_tag_id_idx ON todo_tags (tag_id);
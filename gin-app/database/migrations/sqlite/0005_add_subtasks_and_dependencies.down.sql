@@ -0,0 +1,5 @@
+DROP TABLE todo_dependencies;
+
+DROP INDEX todos_parent_id_idx;
+
+ALTER TABLE todos DROP COLUMN parent_id;
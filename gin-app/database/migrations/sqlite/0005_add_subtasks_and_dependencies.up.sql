@@ -0,0 +1,14 @@
+-- No REFERENCES clause: SQLite cannot drop a column used by a foreign key.
+-- The repository checks parents itself and deletes subtasks explicitly.
+ALTER TABLE todos ADD COLUMN parent_id INTEGER;
+
+CREATE INDEX todos_parent_id_idx ON todos (parent_id) WHERE parent_id IS NOT NULL;
+
+CREATE TABLE todo_dependencies (
+    todo_id INTEGER NOT NULL REFERENCES todos (id) ON DELETE CASCADE,
+    blocked_by_id INTEGER NOT NULL REFERENCES todos (id) ON DELETE CASCADE,
+    PRIMARY KEY (todo_id, blocked_by_id),
+    CHECK (todo_id <> blocked_by_id)
+);
+
+CREATE INDEX todo_dependencies_blocked_by_id_idx ON todo_dependencies (blocked_by_id);
@@ -0,0 +1,7 @@
+DROP INDEX todos_series_occurrence_idx;
+
+ALTER TABLE todos DROP COLUMN occurrence_at;
+ALTER TABLE todos DROP COLUMN series_id;
+ALTER TABLE todos DROP COLUMN recurrence;
+
+ALTER TABLE users DROP COLUMN timezone;
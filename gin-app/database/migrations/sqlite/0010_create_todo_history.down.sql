@@ -0,0 +1 @@
+DROP TABLE todo_history;
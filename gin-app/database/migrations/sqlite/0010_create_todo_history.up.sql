@@ -0,0 +1,21 @@
+-- One row per change made to a todo through the API. todo_id is not a
+-- foreign key so that the record outlives a purged todo, and rows can be
+-- inserted and deleted but never changed.
+CREATE TABLE todo_history (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    todo_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    actor_id INTEGER NOT NULL,
+    operation TEXT NOT NULL,
+    version INTEGER NOT NULL,
+    changes TEXT NOT NULL, -- JSON object of field -> {"before", "after"}
+    snapshot TEXT NOT NULL, -- JSON of the todo after the change
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX todo_history_todo_id_idx ON todo_history (todo_id, id);
+
+CREATE TRIGGER todo_history_append_only BEFORE UPDATE ON todo_history
+BEGIN
+    SELECT RAISE(ABORT, 'todo_history is append-only');
+END;
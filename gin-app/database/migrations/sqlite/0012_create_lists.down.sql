@@ -0,0 +1,7 @@
+DROP INDEX todos_list_id_idx;
+
+ALTER TABLE todos DROP COLUMN list_id;
+
+DROP TABLE list_invites;
+DROP TABLE list_members;
+DROP TABLE lists;
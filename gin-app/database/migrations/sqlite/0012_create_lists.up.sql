@@ -0,0 +1,41 @@
+-- Lists group todos. The todos of a list are stored under its owner's
+-- account; members reach them through their role on the list.
+CREATE TABLE lists (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    owner_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX lists_owner_id_idx ON lists (owner_id);
+
+-- Members other than the owner, as viewer, editor or owner
+CREATE TABLE list_members (
+    list_id INTEGER NOT NULL REFERENCES lists (id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    role TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (list_id, user_id)
+);
+
+CREATE INDEX list_members_user_id_idx ON list_members (user_id);
+
+-- Pending invitations, addressed by email so that people can be invited
+-- before they register
+CREATE TABLE list_invites (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    list_id INTEGER NOT NULL REFERENCES lists (id) ON DELETE CASCADE,
+    email TEXT NOT NULL,
+    role TEXT NOT NULL,
+    invited_by INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL,
+    UNIQUE (list_id, email)
+);
+
+CREATE INDEX list_invites_email_idx ON list_invites (email);
+
+-- No REFERENCES clause, as with parent_id; the repository takes todos out
+-- of a list before deleting it
+ALTER TABLE todos ADD COLUMN list_id INTEGER;
+
+CREATE INDEX todos_list_id_idx ON todos (list_id) WHERE list_id IS NOT NULL;
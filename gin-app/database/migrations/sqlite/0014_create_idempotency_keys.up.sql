@@ -0,0 +1,16 @@
+-- Requests sent with an Idempotency-Key and, once they have finished, their
+-- responses, replayed to retries until expires_at. The primary key lets only
+-- one of several concurrent requests with a key claim it.
+CREATE TABLE idempotency_keys (
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    key TEXT NOT NULL,
+    fingerprint TEXT NOT NULL,
+    status INTEGER,
+    header TEXT,
+    body BLOB,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, key)
+);
+
+CREATE INDEX idempotency_keys_expires_at_idx ON idempotency_keys (expires_at);
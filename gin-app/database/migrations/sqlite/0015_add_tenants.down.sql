@@ -0,0 +1,15 @@
+-- SQLite only ever holds the default tenant, so no data is lost
+ALTER TABLE users DROP COLUMN tenant_id;
+ALTER TABLE todos DROP COLUMN tenant_id;
+ALTER TABLE tags DROP COLUMN tenant_id;
+ALTER TABLE todo_tags DROP COLUMN tenant_id;
+ALTER TABLE todo_dependencies DROP COLUMN tenant_id;
+ALTER TABLE webhooks DROP COLUMN tenant_id;
+ALTER TABLE webhook_deliveries DROP COLUMN tenant_id;
+ALTER TABLE todo_history DROP COLUMN tenant_id;
+ALTER TABLE lists DROP COLUMN tenant_id;
+ALTER TABLE list_members DROP COLUMN tenant_id;
+ALTER TABLE list_invites DROP COLUMN tenant_id;
+ALTER TABLE idempotency_keys DROP COLUMN tenant_id;
+
+DROP TABLE tenants;
@@ -0,0 +1,23 @@
+-- SQLite has no row-level security, so it serves the default tenant only.
+-- The tenant_id columns keep its schema in line with Postgres.
+CREATE TABLE tenants (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL UNIQUE,
+    suspended_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL
+);
+
+INSERT INTO tenants (id, name, created_at) VALUES (1, 'default', CURRENT_TIMESTAMP);
+
+ALTER TABLE users ADD COLUMN tenant_id INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE todos ADD COLUMN tenant_id INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE tags ADD COLUMN tenant_id INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE todo_tags ADD COLUMN tenant_id INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE todo_dependencies ADD COLUMN tenant_id INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE webhooks ADD COLUMN tenant_id INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE webhook_deliveries ADD COLUMN tenant_id INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE todo_history ADD COLUMN tenant_id INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE lists ADD COLUMN tenant_id INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE list_members ADD COLUMN tenant_id INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE list_invites ADD COLUMN tenant_id INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE idempotency_keys ADD COLUMN tenant_id INTEGER NOT NULL DEFAULT 1;
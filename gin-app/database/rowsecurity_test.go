@@ -0,0 +1,133 @@
+package database_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"gin-app/config"
+	"gin-app/database"
+	"gin-app/models"
+	"gin-app/repository"
+	"gin-app/tenant"
+)
+
+// postgresConfig connects to the Postgres database of the tests, as a role
+// bound by row-level security and as a worker role with BYPASSRLS. Tests
+// that need one are skipped unless both are set.
+func postgresConfig(t *testing.T) config.DatabaseConfig {
+	url, workerURL := os.Getenv("TODO_TEST_DATABASE_URL"), os.Getenv("TODO_TEST_DATABASE_WORKER_URL")
+	if url == "" || workerURL == "" {
+		t.Skip("TODO_TEST_DATABASE_URL and TODO_TEST_DATABASE_WORKER_URL are not set")
+	}
+	return config.DatabaseConfig{Driver: database.DialectPostgres, URL: url, WorkerURL: workerURL}
+}
+
+func TestCheckRowSecurity(t *testing.T) {
+	cfg := postgresConfig(t)
+	ctx := context.Background()
+	for name, c := range map[string]config.DatabaseConfig{
+		"requests bypassing": {Driver: cfg.Driver, URL: cfg.WorkerURL, WorkerURL: cfg.WorkerURL},
+		"workers bound":      {Driver: cfg.Driver, URL: cfg.URL, WorkerURL: cfg.URL},
+	} {
+		if err := database.InitDB(c); err != nil {
+			t.Fatal(err)
+		}
+		if err := database.CheckRowSecurity(ctx); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+		database.Close()
+	}
+
+	if err := database.InitDB(cfg); err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+	if err := database.CheckRowSecurity(ctx); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTenantsIsolated(t *testing.T) {
+	if err := database.InitDB(postgresConfig(t)); err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+	if err := database.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	store := repository.NewPostgres(database.GetDB())
+	ctx := context.Background()
+
+	// Each tenant gets an admin with a todo and a list
+	type data struct {
+		ctx   context.Context
+		admin models.User
+		todo  models.Todo
+		list  models.List
+	}
+	var tenants [2]data
+	suffix := strconv.FormatInt(time.Now().UnixNano(), 36)
+	for i := range tenants {
+		d := &tenants[i]
+		tn := models.Tenant{Name: "isolated-" + strconv.Itoa(i) + "-" + suffix}
+		d.admin = models.User{Email: "admin@example.com", Timezone: "UTC", Role: models.AccountAdmin}
+		if err := store.Tenants.Create(tenant.All(ctx), &tn, &d.admin); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			worker := tenant.All(ctx)
+			database.GetWorkerDB().ExecContext(worker, "DELETE FROM users WHERE tenant_id = $1", tn.ID)
+			database.GetWorkerDB().ExecContext(worker, "DELETE FROM tenants WHERE id = $1", tn.ID)
+		})
+
+		d.ctx = tenant.With(ctx, tn.ID)
+		d.list = models.List{OwnerID: d.admin.ID, Name: "Shared"}
+		if err := store.Lists.Create(d.ctx, &d.list); err != nil {
+			t.Fatal(err)
+		}
+		d.todo = models.Todo{UserID: d.admin.ID, Title: "Secret", ListID: &d.list.ID}
+		if err := store.Todos.Create(d.ctx, &d.todo); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	a, b := tenants[0], tenants[1]
+	if _, err := store.Users.Get(a.ctx, b.admin.ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("tenant A got tenant B's user: %v", err)
+	}
+	if _, err := store.Todos.Get(a.ctx, b.admin.ID, b.todo.ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("tenant A got tenant B's todo: %v", err)
+	}
+	if _, err := store.Lists.Get(a.ctx, b.admin.ID, b.list.ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("tenant A got tenant B's list: %v", err)
+	}
+
+	// The policies, not the queries of the store, keep the rows apart:
+	// asking for tenant B's rows outright gets none of them, whether acting
+	// for tenant A or for every tenant. Only the worker role sees them.
+	for _, table := range []string{"users", "todos", "lists"} {
+		for name, c := range map[string]context.Context{"tenant A": a.ctx, "every tenant": tenant.All(ctx)} {
+			var n int
+			err := database.GetDB().QueryRowContext(c, "SELECT count(*) FROM "+table+" WHERE tenant_id = $1", b.admin.TenantID).Scan(&n)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != 0 {
+				t.Errorf("%s sees %d of tenant B's %s", name, n, table)
+			}
+		}
+	}
+	var n int
+	err := database.GetWorkerDB().QueryRowContext(tenant.All(ctx), "SELECT count(*) FROM todos WHERE tenant_id = $1", b.admin.TenantID).Scan(&n)
+	if err != nil || n != 1 {
+		t.Errorf("the worker role sees %d of tenant B's todos: %v", n, err)
+	}
+	_, err = database.GetDB().ExecContext(a.ctx, "INSERT INTO todos (tenant_id, user_id, title) VALUES ($1, $2, 'Planted')", b.admin.TenantID, b.admin.ID)
+	if err == nil {
+		t.Error("tenant A added a todo to tenant B")
+	}
+}
@@ -0,0 +1,68 @@
+// Package events carries todo lifecycle events from the controllers to the
+// parts of the application that react to them, such as webhooks.
+package events
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"gin-app/logging"
+	"gin-app/models"
+)
+
+// Todo lifecycle event types
+const (
+	TodoCreated   = "todo.created"
+	TodoUpdated   = "todo.updated"
+	TodoCompleted = "todo.completed"
+	TodoDeleted   = "todo.deleted"
+	TodoRestored  = "todo.restored"
+)
+
+// Event is something that happened to one of a user's todos
+type Event struct {
+	Type       string      `json:"event"`
+	UserID     int         `json:"user_id"`
+	Todo       models.Todo `json:"todo"`
+	OccurredAt time.Time   `json:"occurred_at"`
+}
+
+// New returns an event of the given type for todo, stamped with the current time
+func New(eventType string, todo models.Todo) Event {
+	return Event{Type: eventType, UserID: todo.UserID, Todo: todo, OccurredAt: time.Now().UTC()}
+}
+
+// Handler reacts to an event. It runs on the publishing goroutine, so slow
+// work belongs in a queue.
+type Handler func(ctx context.Context, event Event) error
+
+// Bus delivers every published event to every subscribed handler
+type Bus struct {
+	mu       sync.RWMutex
+	handlers []Handler
+}
+
+func NewBus() *Bus {
+	return &Bus{}
+}
+
+func (b *Bus) Subscribe(handler Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers = append(b.handlers, handler)
+}
+
+// Publish calls the handlers in order. Their errors are logged rather than
+// returned: the change the event describes has already been made.
+func (b *Bus) Publish(ctx context.Context, event Event) {
+	b.mu.RLock()
+	handlers := b.handlers
+	b.mu.RUnlock()
+
+	for _, handler := range handlers {
+		if err := handler(ctx, event); err != nil {
+			logging.FromContext(ctx).ErrorContext(ctx, "Error handling event", "event", event.Type, "todo_id", event.Todo.ID, "error", err)
+		}
+	}
+}
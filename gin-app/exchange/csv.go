@@ -0,0 +1,209 @@
+package exchange
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"gin-app/models"
+)
+
+// CSV files start with a header naming their columns, in any order; only
+// title is required and unknown columns are ignored. Lists are separated by
+// semicolons. The timestamps other than due_at are exported for reference
+// and not imported.
+var csvColumns = []string{"id", "title", "description", "completed", "priority", "due_at", "tags", "parent_id", "blocked_by", "recurrence", "created_at", "updated_at", "completed_at"}
+
+const csvListSeparator = ";"
+
+// Spreadsheets evaluate cells starting with one of csvFormulaPrefixes as
+// formulas, so such cells are exported behind a csvEscape, which spreadsheets
+// hide and imports strip again.
+const (
+	csvFormulaPrefixes = "=+-@\t\r"
+	csvEscape          = '\''
+)
+
+// csvNeedsEscape reports whether a cell must be escaped. Cells that already
+// start with an escape before such a cell are escaped once more, so that
+// decoding gives back exactly what was encoded.
+func csvNeedsEscape(cell string) bool {
+	for len(cell) > 0 && cell[0] == csvEscape {
+		cell = cell[1:]
+	}
+	return cell != "" && strings.IndexByte(csvFormulaPrefixes, cell[0]) >= 0
+}
+
+func escapeCSV(cell string) string {
+	if csvNeedsEscape(cell) {
+		return string(csvEscape) + cell
+	}
+	return cell
+}
+
+func unescapeCSV(cell string) string {
+	if cell != "" && cell[0] == csvEscape && csvNeedsEscape(cell[1:]) {
+		return cell[1:]
+	}
+	return cell
+}
+
+func encodeCSV(w io.Writer, todos []models.Todo) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvColumns); err != nil {
+		return err
+	}
+	for _, todo := range todos {
+		blockedBy := make([]string, len(todo.BlockedBy))
+		for i, id := range todo.BlockedBy {
+			blockedBy[i] = strconv.Itoa(id)
+		}
+		record := []string{
+			strconv.Itoa(todo.ID),
+			todo.Title,
+			todo.Description,
+			strconv.FormatBool(todo.Completed),
+			strconv.Itoa(todo.Priority),
+			formatTime(todo.DueAt),
+			strings.Join(todo.Tags, csvListSeparator),
+			"",
+			strings.Join(blockedBy, csvListSeparator),
+			todo.Recurrence,
+			formatTime(&todo.CreatedAt),
+			formatTime(&todo.UpdatedAt),
+			formatTime(todo.CompletedAt),
+		}
+		if todo.ParentID != nil {
+			record[7] = strconv.Itoa(*todo.ParentID)
+		}
+		for i := range record {
+			record[i] = escapeCSV(record[i])
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func decodeCSV(data []byte) ([]Row, error) {
+	cr := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\ufeff"))))
+	cr.FieldsPerRecord = -1
+
+	header, err := cr.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, errors.New("missing CSV header")
+	}
+	if err != nil {
+		return nil, err
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["title"]; !ok {
+		return nil, errors.New("CSV header has no title column")
+	}
+
+	rows := []Row{}
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return rows, nil
+		}
+		// A malformed record only fails its row. An unterminated quote
+		// runs to the end of the file, so its row is the last one.
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			rows = append(rows, Row{Line: parseErr.StartLine, Err: parseErr})
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := cr.FieldPos(0)
+		if len(record) != len(header) {
+			rows = append(rows, Row{Line: line, Err: fmt.Errorf("has %d fields, the header %d", len(record), len(header))})
+			continue
+		}
+		field := func(name string) string {
+			if i, ok := columns[name]; ok {
+				return strings.TrimSpace(unescapeCSV(record[i]))
+			}
+			return ""
+		}
+		row := Row{Line: line}
+		row.Todo, row.Err = csvTodo(field)
+		rows = append(rows, row)
+	}
+}
+
+// csvTodo reads a todo from the fields of a record
+func csvTodo(field func(name string) string) (models.Todo, error) {
+	todo := models.Todo{
+		Title:       field("title"),
+		Description: field("description"),
+		Recurrence:  field("recurrence"),
+		Tags:        splitList(field("tags")),
+	}
+	var err error
+	if v := field("id"); v != "" {
+		if todo.ID, err = strconv.Atoi(v); err != nil {
+			return todo, fmt.Errorf("invalid id %q", v)
+		}
+	}
+	if v := field("completed"); v != "" {
+		if todo.Completed, err = strconv.ParseBool(v); err != nil {
+			return todo, fmt.Errorf("invalid completed %q", v)
+		}
+	}
+	if todo.Priority, err = parsePriority(field("priority")); err != nil {
+		return todo, err
+	}
+	if v := field("due_at"); v != "" {
+		dueAt, err := parseTime(v)
+		if err != nil {
+			return todo, fmt.Errorf("due_at: %w", err)
+		}
+		todo.DueAt = &dueAt
+	}
+	if v := field("parent_id"); v != "" {
+		parentID, err := strconv.Atoi(v)
+		if err != nil {
+			return todo, fmt.Errorf("invalid parent_id %q", v)
+		}
+		todo.ParentID = &parentID
+	}
+	for _, v := range splitList(field("blocked_by")) {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			return todo, fmt.Errorf("invalid blocked_by %q", v)
+		}
+		todo.BlockedBy = append(todo.BlockedBy, id)
+	}
+	return todo, nil
+}
+
+// splitList splits a semicolon-separated list, dropping empty items
+func splitList(value string) []string {
+	items := []string{}
+	for _, item := range strings.Split(value, csvListSeparator) {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
@@ -0,0 +1,61 @@
+package exchange
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strings"
+	"testing"
+
+	"gin-app/models"
+)
+
+func TestCSVFormulasEscaped(t *testing.T) {
+	titles := []string{"=SUM(A1:A2)", "+1", "-1", "@here", "\tTab", "'=quoted", "''+twice", "'plain", "plain"}
+	todos := make([]models.Todo, len(titles))
+	for i, title := range titles {
+		todos[i] = models.Todo{ID: i + 1, Title: title, Description: title}
+	}
+	var buf bytes.Buffer
+	if err := encodeCSV(&buf, todos); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(bytes.NewReader(buf.Bytes())).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, record := range records[1:] {
+		for _, cell := range record {
+			if cell != "" && strings.IndexByte(csvFormulaPrefixes, cell[0]) >= 0 {
+				t.Errorf("cell %q not escaped", cell)
+			}
+		}
+	}
+
+	rows, err := decodeCSV(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, row := range rows {
+		// Imports trim whitespace
+		want := strings.TrimSpace(titles[i])
+		if row.Err != nil || row.Todo.Title != want || row.Todo.Description != want {
+			t.Errorf("row %d: %q %q %v, want %q", i, row.Todo.Title, row.Todo.Description, row.Err, want)
+		}
+	}
+}
+
+func TestCSVMalformedRow(t *testing.T) {
+	rows, err := decodeCSV([]byte("title,priority\nfirst,1\nbad \"quote,2\nlast,3\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("got %d rows, want 3", len(rows))
+	}
+	if rows[0].Err != nil || rows[2].Err != nil || rows[2].Todo.Title != "last" {
+		t.Errorf("rows around the malformed one: %+v %+v", rows[0], rows[2])
+	}
+	if rows[1].Err == nil || rows[1].Line != 3 {
+		t.Errorf("malformed row: %+v", rows[1])
+	}
+}
@@ -0,0 +1,231 @@
+// Package exchange reads and writes todos in file formats shared with other
+// tools: JSON, CSV, iCalendar VTODO and todo.txt.
+package exchange
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"gin-app/models"
+	"gin-app/repository"
+)
+
+// Row is one todo read from a file. Its ID, ParentID and BlockedBy are the
+// identifiers the file uses, not those of stored todos; ID is zero when the
+// file gives the todo none.
+type Row struct {
+	// Line is the line of the file on which the todo starts
+	Line int
+	Todo models.Todo
+	Err  error
+}
+
+// Format encodes and decodes one file format. Decode fails only when the
+// file as a whole cannot be read; problems with single todos are reported
+// through the Err of their rows.
+type Format struct {
+	Name        string
+	ContentType string
+	Extension   string
+	Encode      func(w io.Writer, todos []models.Todo) error
+	Decode      func(data []byte) ([]Row, error)
+}
+
+var formats = []Format{
+	{Name: "json", ContentType: "application/json", Extension: "json", Encode: encodeJSON, Decode: decodeJSON},
+	{Name: "csv", ContentType: "text/csv; charset=utf-8", Extension: "csv", Encode: encodeCSV, Decode: decodeCSV},
+	{Name: "ical", ContentType: "text/calendar; charset=utf-8", Extension: "ics", Encode: encodeICal, Decode: decodeICal},
+	{Name: "todotxt", ContentType: "text/plain; charset=utf-8", Extension: "txt", Encode: encodeTodoTxt, Decode: decodeTodoTxt},
+}
+
+// Lookup returns the format with the given name
+func Lookup(name string) (Format, bool) {
+	for _, format := range formats {
+		if format.Name == name {
+			return format, true
+		}
+	}
+	return Format{}, false
+}
+
+// Names lists the supported formats
+func Names() []string {
+	names := make([]string, len(formats))
+	for i, format := range formats {
+		names[i] = format.Name
+	}
+	return names
+}
+
+// Plan turns the valid rows into the batch operations that create them:
+// every todo, parents before their subtasks, then the blocker links between
+// them. It first checks the file's references, failing rows with a
+// duplicate ID, a parent or blocker that is not a valid row of the file, or
+// links that form a cycle. rowOf maps each operation to its row.
+func Plan(rows []Row) (ops []repository.BatchOp, rowOf []int) {
+	byID := map[int]int{}
+	for i, row := range rows {
+		if row.Todo.ID == 0 {
+			continue
+		}
+		if first, ok := byID[row.Todo.ID]; ok {
+			if row.Err == nil {
+				rows[i].Err = fmt.Errorf("id %d is already used on line %d", row.Todo.ID, rows[first].Line)
+			}
+			continue
+		}
+		byID[row.Todo.ID] = i
+	}
+
+	// A row fails with the rows it refers to, which may in turn fail later
+	// rows, so repeat until nothing changes
+	ref := func(id int) error {
+		i, ok := byID[id]
+		if !ok {
+			return fmt.Errorf("todo %d is not in the file", id)
+		}
+		if rows[i].Err != nil {
+			return fmt.Errorf("todo %d on line %d is invalid", id, rows[i].Line)
+		}
+		return nil
+	}
+	for changed := true; changed; {
+		changed = false
+		for i := range rows {
+			if rows[i].Err != nil {
+				continue
+			}
+			todo := rows[i].Todo
+			if todo.ParentID != nil {
+				if err := ref(*todo.ParentID); err != nil {
+					rows[i].Err, changed = fmt.Errorf("parent: %w", err), true
+					continue
+				}
+			}
+			for _, id := range todo.BlockedBy {
+				if err := ref(id); err != nil {
+					rows[i].Err, changed = fmt.Errorf("blocked_by: %w", err), true
+					break
+				}
+			}
+		}
+		if !changed {
+			changed = failCycles(rows, byID)
+		}
+	}
+
+	// Create level by level, so that the subtasks of one level can be
+	// inserted together
+	depth := make([]int, len(rows))
+	var depthOf func(i int) int
+	depthOf = func(i int) int {
+		if depth[i] == 0 {
+			depth[i] = 1
+			if parentID := rows[i].Todo.ParentID; parentID != nil {
+				depth[i] = depthOf(byID[*parentID]) + 1
+			}
+		}
+		return depth[i]
+	}
+	for i := range rows {
+		if rows[i].Err == nil {
+			rowOf = append(rowOf, i)
+		}
+	}
+	sort.SliceStable(rowOf, func(a, b int) bool { return depthOf(rowOf[a]) < depthOf(rowOf[b]) })
+
+	opOf := map[int]int{}
+	for k, i := range rowOf {
+		opOf[i] = k
+		op := repository.BatchOp{Op: repository.BatchCreate, Todo: rows[i].Todo}
+		op.Todo.ID, op.Todo.ParentID, op.Todo.BlockedBy = 0, nil, nil
+		if parentID := rows[i].Todo.ParentID; parentID != nil {
+			parentOp := opOf[byID[*parentID]]
+			op.ParentOp = &parentOp
+		}
+		ops = append(ops, op)
+	}
+	for _, i := range rowOf[:len(ops)] {
+		for _, id := range rows[i].Todo.BlockedBy {
+			todoOp, blockerOp := opOf[i], opOf[byID[id]]
+			ops = append(ops, repository.BatchOp{Op: repository.BatchAddBlocker, TodoOp: &todoOp, BlockerOp: &blockerOp})
+			rowOf = append(rowOf, i)
+		}
+	}
+	return ops, rowOf
+}
+
+// errCycle fails the row that closes a loop of parent or blocker links
+var errCycle = errors.New("parent or blocked_by links form a cycle")
+
+// failCycles fails a row on every loop of links between valid rows and
+// reports whether there was one; the rest of the loop then fails with it.
+// Callers have checked that all links of valid rows lead to rows of the file.
+func failCycles(rows []Row, byID map[int]int) bool {
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make([]int, len(rows))
+	found := false
+	var visit func(i int)
+	visit = func(i int) {
+		state[i] = visiting
+		links := append([]int{}, rows[i].Todo.BlockedBy...)
+		if rows[i].Todo.ParentID != nil {
+			links = append(links, *rows[i].Todo.ParentID)
+		}
+		for _, id := range links {
+			next := byID[id]
+			if rows[next].Err != nil {
+				continue
+			}
+			switch state[next] {
+			case visiting:
+				rows[i].Err, found = errCycle, true
+			case unvisited:
+				visit(next)
+			}
+		}
+		state[i] = done
+	}
+	for i := range rows {
+		if rows[i].Err == nil && state[i] == unvisited {
+			visit(i)
+		}
+	}
+	return found
+}
+
+// parseTime reads an RFC 3339 timestamp or a plain date, which is taken as
+// midnight UTC
+func parseTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.UTC(), nil
+	}
+	t, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return t, fmt.Errorf("invalid time %q", value)
+	}
+	return t, nil
+}
+
+// parsePriority reads a priority as a number or a name
+func parsePriority(value string) (int, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", "0", "none":
+		return models.PriorityNone, nil
+	case "1", "low":
+		return models.PriorityLow, nil
+	case "2", "medium":
+		return models.PriorityMedium, nil
+	case "3", "high":
+		return models.PriorityHigh, nil
+	}
+	return 0, fmt.Errorf("invalid priority %q", value)
+}
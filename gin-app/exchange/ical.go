@@ -0,0 +1,359 @@
+package exchange
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gin-app/models"
+)
+
+// iCalendar files hold one VTODO per todo (RFC 5545). Parents and blockers
+// are RELATED-TO properties with RELTYPE=PARENT and RELTYPE=DEPENDS-ON
+// (RFC 9253). Priorities map to 1, 5 and 9, the high, medium and low
+// values the RFC suggests.
+
+const (
+	icalTime = "20060102T150405Z"
+	icalDate = "20060102"
+	// icalLineLength is the octet limit of a content line before folding
+	icalLineLength = 75
+)
+
+var icalPriorities = map[int]int{models.PriorityHigh: 1, models.PriorityMedium: 5, models.PriorityLow: 9}
+
+func encodeICal(w io.Writer, todos []models.Todo) error {
+	bw := bufio.NewWriter(w)
+	line := func(name, value string) {
+		writeFolded(bw, name+":"+value)
+	}
+	uid := func(id int) string {
+		return "todo-" + strconv.Itoa(id) + "@gin-app"
+	}
+
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", "-//gin-app//todos//EN")
+	for _, todo := range todos {
+		line("BEGIN", "VTODO")
+		line("UID", uid(todo.ID))
+		line("DTSTAMP", todo.UpdatedAt.UTC().Format(icalTime))
+		line("CREATED", todo.CreatedAt.UTC().Format(icalTime))
+		line("LAST-MODIFIED", todo.UpdatedAt.UTC().Format(icalTime))
+		line("SUMMARY", icalEscape(todo.Title))
+		if todo.Description != "" {
+			line("DESCRIPTION", icalEscape(todo.Description))
+		}
+		if todo.Completed {
+			line("STATUS", "COMPLETED")
+		} else {
+			line("STATUS", "NEEDS-ACTION")
+		}
+		if todo.CompletedAt != nil {
+			line("COMPLETED", todo.CompletedAt.UTC().Format(icalTime))
+		}
+		if priority, ok := icalPriorities[todo.Priority]; ok {
+			line("PRIORITY", strconv.Itoa(priority))
+		}
+		if todo.DueAt != nil {
+			line("DUE", todo.DueAt.UTC().Format(icalTime))
+		}
+		if len(todo.Tags) > 0 {
+			tags := make([]string, len(todo.Tags))
+			for i, tag := range todo.Tags {
+				tags[i] = icalEscape(tag)
+			}
+			line("CATEGORIES", strings.Join(tags, ","))
+		}
+		if todo.Recurrence != "" {
+			line("RRULE", todo.Recurrence)
+		}
+		if todo.ParentID != nil {
+			line("RELATED-TO;RELTYPE=PARENT", uid(*todo.ParentID))
+		}
+		for _, id := range todo.BlockedBy {
+			line("RELATED-TO;RELTYPE=DEPENDS-ON", uid(id))
+		}
+		line("END", "VTODO")
+	}
+	line("END", "VCALENDAR")
+	return bw.Flush()
+}
+
+// writeFolded writes a content line, folding it into lines of at most
+// icalLineLength octets without splitting a character
+func writeFolded(w *bufio.Writer, line string) {
+	limit := icalLineLength
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		w.WriteString(line[:cut] + "\r\n ")
+		line = line[cut:]
+		// The leading space of a continuation counts towards its length
+		limit = icalLineLength - 1
+	}
+	w.WriteString(line + "\r\n")
+}
+
+var icalEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`, "\r", "")
+
+func icalEscape(text string) string {
+	return icalEscaper.Replace(text)
+}
+
+// icalProperty is a content line split into its parts
+type icalProperty struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+// vtodo collects the properties of one VTODO as they are read
+type vtodo struct {
+	line  int
+	props []icalProperty
+}
+
+func decodeICal(data []byte) ([]Row, error) {
+	var (
+		todos    []*vtodo
+		current  *vtodo
+		depth    int // nesting inside the VTODO, for components such as VALARM
+		calendar bool
+	)
+	for _, line := range unfold(data) {
+		prop, err := parseICalLine(line.text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line.number, err)
+		}
+		value := strings.ToUpper(prop.value)
+		switch {
+		case prop.name == "BEGIN" && value == "VCALENDAR":
+			calendar = true
+		case prop.name == "BEGIN" && value == "VTODO" && current == nil:
+			current = &vtodo{line: line.number}
+		case current == nil:
+			// Properties of the calendar and of other components
+		case prop.name == "BEGIN":
+			depth++
+		case prop.name == "END" && depth > 0:
+			depth--
+		case prop.name == "END" && value == "VTODO":
+			todos = append(todos, current)
+			current = nil
+		case depth == 0:
+			current.props = append(current.props, prop)
+		}
+	}
+	if !calendar {
+		return nil, errors.New("not an iCalendar file")
+	}
+	if current != nil {
+		return nil, fmt.Errorf("line %d: VTODO is not closed", current.line)
+	}
+
+	// UIDs are strings, so rows are numbered to link them
+	ids := map[string]int{}
+	for i, todo := range todos {
+		for _, prop := range todo.props {
+			if prop.name == "UID" {
+				ids[prop.value] = i + 1
+			}
+		}
+	}
+	rows := make([]Row, len(todos))
+	for i, todo := range todos {
+		rows[i].Line = todo.line
+		rows[i].Todo, rows[i].Err = icalTodo(todo.props, ids)
+		rows[i].Todo.ID = i + 1
+	}
+	return rows, nil
+}
+
+// icalTodo reads a todo from the properties of a VTODO
+func icalTodo(props []icalProperty, ids map[string]int) (models.Todo, error) {
+	var todo models.Todo
+	for _, prop := range props {
+		switch prop.name {
+		case "SUMMARY":
+			todo.Title = icalUnescape(prop.value)
+		case "DESCRIPTION":
+			todo.Description = icalUnescape(prop.value)
+		case "STATUS":
+			todo.Completed = strings.EqualFold(prop.value, "COMPLETED")
+		case "COMPLETED":
+			todo.Completed = true
+		case "PRIORITY":
+			priority, err := strconv.Atoi(prop.value)
+			if err != nil || priority < 0 || priority > 9 {
+				return todo, fmt.Errorf("invalid PRIORITY %q", prop.value)
+			}
+			switch {
+			case priority == 0:
+				todo.Priority = models.PriorityNone
+			case priority < 5:
+				todo.Priority = models.PriorityHigh
+			case priority == 5:
+				todo.Priority = models.PriorityMedium
+			default:
+				todo.Priority = models.PriorityLow
+			}
+		case "DUE":
+			dueAt, err := parseICalTime(prop)
+			if err != nil {
+				return todo, err
+			}
+			todo.DueAt = &dueAt
+		case "CATEGORIES":
+			for _, tag := range splitEscaped(prop.value, ',') {
+				if tag = strings.TrimSpace(icalUnescape(tag)); tag != "" {
+					todo.Tags = append(todo.Tags, tag)
+				}
+			}
+		case "RRULE":
+			todo.Recurrence = prop.value
+		case "RELATED-TO":
+			// Other relations, such as siblings, have no counterpart
+			reltype := strings.ToUpper(prop.params["RELTYPE"])
+			if reltype != "" && reltype != "PARENT" && reltype != "DEPENDS-ON" {
+				continue
+			}
+			id, ok := ids[prop.value]
+			if !ok {
+				return todo, fmt.Errorf("RELATED-TO %s is not in the file", prop.value)
+			}
+			if reltype == "DEPENDS-ON" {
+				todo.BlockedBy = append(todo.BlockedBy, id)
+			} else {
+				todo.ParentID = &id
+			}
+		}
+	}
+	return todo, nil
+}
+
+// parseICalTime reads a DATE or DATE-TIME value, in UTC, in the zone named
+// by TZID, or floating, which is taken as UTC
+func parseICalTime(prop icalProperty) (time.Time, error) {
+	if prop.params["VALUE"] == "DATE" || len(prop.value) == len(icalDate) {
+		t, err := time.Parse(icalDate, prop.value)
+		if err != nil {
+			return t, fmt.Errorf("invalid %s %q", prop.name, prop.value)
+		}
+		return t, nil
+	}
+
+	if strings.HasSuffix(prop.value, "Z") {
+		t, err := time.Parse(icalTime, prop.value)
+		if err != nil {
+			return t, fmt.Errorf("invalid %s %q", prop.name, prop.value)
+		}
+		return t, nil
+	}
+	loc := time.UTC
+	if tzid := prop.params["TZID"]; tzid != "" {
+		var err error
+		if loc, err = time.LoadLocation(tzid); err != nil {
+			return time.Time{}, fmt.Errorf("unknown TZID %q", tzid)
+		}
+	}
+	t, err := time.ParseInLocation("20060102T150405", prop.value, loc)
+	if err != nil {
+		return t, fmt.Errorf("invalid %s %q", prop.name, prop.value)
+	}
+	return t.UTC(), nil
+}
+
+type icalLine struct {
+	number int
+	text   string
+}
+
+// unfold joins folded lines, keeping the number of the line each starts on
+func unfold(data []byte) []icalLine {
+	var lines []icalLine
+	for i, text := range strings.Split(string(data), "\n") {
+		text = strings.TrimSuffix(text, "\r")
+		if (strings.HasPrefix(text, " ") || strings.HasPrefix(text, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1].text += text[1:]
+			continue
+		}
+		if text != "" {
+			lines = append(lines, icalLine{number: i + 1, text: text})
+		}
+	}
+	return lines
+}
+
+// parseICalLine splits a content line into name, parameters and value.
+// Parameter values may be quoted, so the first colon outside quotes ends
+// them.
+func parseICalLine(line string) (icalProperty, error) {
+	prop := icalProperty{params: map[string]string{}}
+	quoted := false
+	colon := -1
+	for i := 0; i < len(line) && colon < 0; i++ {
+		switch line[i] {
+		case '"':
+			quoted = !quoted
+		case ':':
+			if !quoted {
+				colon = i
+			}
+		}
+	}
+	if colon < 0 {
+		return prop, fmt.Errorf("malformed content line %q", line)
+	}
+
+	parts := strings.Split(line[:colon], ";")
+	prop.name = strings.ToUpper(parts[0])
+	prop.value = line[colon+1:]
+	for _, param := range parts[1:] {
+		name, value, _ := strings.Cut(param, "=")
+		prop.params[strings.ToUpper(name)] = strings.Trim(value, `"`)
+	}
+	return prop, nil
+}
+
+// splitEscaped splits a text list at unescaped separators
+func splitEscaped(value string, sep byte) []string {
+	var items []string
+	start := 0
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case '\\':
+			i++
+		case sep:
+			items = append(items, value[start:i])
+			start = i + 1
+		}
+	}
+	return append(items, value[start:])
+}
+
+func icalUnescape(text string) string {
+	var b bytes.Buffer
+	for i := 0; i < len(text); i++ {
+		if text[i] != '\\' || i+1 == len(text) {
+			b.WriteByte(text[i])
+			continue
+		}
+		i++
+		switch text[i] {
+		case 'n', 'N':
+			b.WriteByte('\n')
+		default:
+			b.WriteByte(text[i])
+		}
+	}
+	return b.String()
+}
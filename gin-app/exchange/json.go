@@ -0,0 +1,61 @@
+package exchange
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+
+	"gin-app/models"
+)
+
+// JSON files are an array of todos as the API returns them. Only the fields
+// a client may set are imported; id, parent_id and blocked_by link todos
+// within the file.
+
+func encodeJSON(w io.Writer, todos []models.Todo) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(todos)
+}
+
+func decodeJSON(data []byte) ([]Row, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if token, err := dec.Token(); err != nil || token != json.Delim('[') {
+		return nil, errors.New("expected a JSON array of todos")
+	}
+
+	rows := []Row{}
+	for dec.More() {
+		start := int(dec.InputOffset())
+		for start < len(data) && bytes.IndexByte([]byte(" \t\r\n,"), data[start]) >= 0 {
+			start++
+		}
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return nil, err
+		}
+
+		row := Row{Line: 1 + bytes.Count(data[:start], []byte("\n"))}
+		var todo models.Todo
+		if row.Err = json.Unmarshal(raw, &todo); row.Err == nil {
+			row.Todo = models.Todo{
+				ID:          todo.ID,
+				Title:       todo.Title,
+				Description: todo.Description,
+				Completed:   todo.Completed,
+				Priority:    todo.Priority,
+				DueAt:       todo.DueAt,
+				Tags:        todo.Tags,
+				ParentID:    todo.ParentID,
+				BlockedBy:   todo.BlockedBy,
+				Recurrence:  todo.Recurrence,
+			}
+		}
+		rows = append(rows, row)
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
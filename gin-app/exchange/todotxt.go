@@ -0,0 +1,194 @@
+package exchange
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"gin-app/models"
+)
+
+// todo.txt files hold one todo per line (github.com/todotxt/todo.txt).
+// Priorities high, medium and low are (A), (B) and (C), kept as pri: on
+// completed todos; tags are +projects, and @contexts are read as tags too.
+// Other fields are key:value extensions: due:, rrule:, id:, parent: and dep:
+// for the blockers. Descriptions have no place in the format and are lost.
+
+var todoTxtPriorities = map[int]string{models.PriorityHigh: "A", models.PriorityMedium: "B", models.PriorityLow: "C"}
+
+func encodeTodoTxt(w io.Writer, todos []models.Todo) error {
+	bw := bufio.NewWriter(w)
+	for _, todo := range todos {
+		var words []string
+		priority, hasPriority := todoTxtPriorities[todo.Priority]
+		switch {
+		case todo.Completed && todo.CompletedAt != nil:
+			words = append(words, "x", todo.CompletedAt.UTC().Format(time.DateOnly))
+		case todo.Completed:
+			words = append(words, "x")
+		case hasPriority:
+			words = append(words, "("+priority+")")
+		}
+		words = append(words, todo.CreatedAt.UTC().Format(time.DateOnly), strings.Join(strings.Fields(todo.Title), " "))
+
+		for _, tag := range todo.Tags {
+			words = append(words, "+"+strings.Join(strings.Fields(tag), "_"))
+		}
+		if todo.DueAt != nil {
+			words = append(words, "due:"+formatTodoTxtDate(*todo.DueAt))
+		}
+		if todo.Recurrence != "" {
+			words = append(words, "rrule:"+todo.Recurrence)
+		}
+		if todo.Completed && hasPriority {
+			words = append(words, "pri:"+priority)
+		}
+		words = append(words, "id:"+strconv.Itoa(todo.ID))
+		if todo.ParentID != nil {
+			words = append(words, "parent:"+strconv.Itoa(*todo.ParentID))
+		}
+		if len(todo.BlockedBy) > 0 {
+			deps := make([]string, len(todo.BlockedBy))
+			for i, id := range todo.BlockedBy {
+				deps[i] = strconv.Itoa(id)
+			}
+			words = append(words, "dep:"+strings.Join(deps, ","))
+		}
+		bw.WriteString(strings.Join(words, " ") + "\n")
+	}
+	return bw.Flush()
+}
+
+// formatTodoTxtDate writes a due date as a plain date when it is midnight
+// UTC, as todo.txt tools expect, and as RFC 3339 otherwise
+func formatTodoTxtDate(t time.Time) string {
+	t = t.UTC()
+	if t.Equal(t.Truncate(24 * time.Hour)) {
+		return t.Format(time.DateOnly)
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+func decodeTodoTxt(data []byte) ([]Row, error) {
+	rows := []Row{}
+	for i, line := range strings.Split(string(data), "\n") {
+		words := strings.Fields(line)
+		if len(words) == 0 {
+			continue
+		}
+		row := Row{Line: i + 1}
+		row.Todo, row.Err = todoTxtTodo(words)
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// todoTxtTodo reads a todo from the words of a line
+func todoTxtTodo(words []string) (models.Todo, error) {
+	var todo models.Todo
+	isDate := func(word string) bool {
+		_, err := time.Parse(time.DateOnly, word)
+		return err == nil
+	}
+
+	// Completion mark, priority and dates lead the line; the dates are set
+	// by the server
+	if words[0] == "x" {
+		todo.Completed = true
+		words = words[1:]
+		for n := 0; n < 2 && len(words) > 0 && isDate(words[0]); n++ {
+			words = words[1:]
+		}
+	} else {
+		if priority, ok := todoTxtPriority(words[0]); ok {
+			todo.Priority = priority
+			words = words[1:]
+		}
+		if len(words) > 0 && isDate(words[0]) {
+			words = words[1:]
+		}
+	}
+
+	var title []string
+	for _, word := range words {
+		key, value, _ := strings.Cut(word, ":")
+		var err error
+		switch {
+		case value == "":
+			title = append(title, word)
+		case key == "due":
+			var dueAt time.Time
+			if dueAt, err = parseTime(value); err != nil {
+				err = fmt.Errorf("due: %w", err)
+			}
+			todo.DueAt = &dueAt
+		case key == "rrule":
+			todo.Recurrence = value
+		case key == "pri":
+			var ok bool
+			if todo.Priority, ok = todoTxtPriority("(" + value + ")"); !ok {
+				err = fmt.Errorf("invalid pri %q", value)
+			}
+		case key == "id":
+			if todo.ID, err = strconv.Atoi(value); err != nil {
+				err = fmt.Errorf("invalid id %q", value)
+			}
+		case key == "parent":
+			var parentID int
+			if parentID, err = strconv.Atoi(value); err != nil {
+				err = fmt.Errorf("invalid parent %q", value)
+			}
+			todo.ParentID = &parentID
+		case key == "dep":
+			for _, v := range strings.Split(value, ",") {
+				id, convErr := strconv.Atoi(v)
+				if convErr != nil {
+					err = fmt.Errorf("invalid dep %q", value)
+					break
+				}
+				todo.BlockedBy = append(todo.BlockedBy, id)
+			}
+		default:
+			// Another tool's extension, or just a word with a colon
+			title = append(title, word)
+		}
+		if err != nil {
+			return todo, err
+		}
+	}
+
+	// Projects and contexts anywhere in the line are tags, and those that
+	// trail the text are not part of the title
+	for _, word := range title {
+		if isTodoTxtTag(word) {
+			todo.Tags = append(todo.Tags, word[1:])
+		}
+	}
+	for len(title) > 0 && isTodoTxtTag(title[len(title)-1]) {
+		title = title[:len(title)-1]
+	}
+	todo.Title = strings.Join(title, " ")
+	return todo, nil
+}
+
+func isTodoTxtTag(word string) bool {
+	return len(word) > 1 && (word[0] == '+' || word[0] == '@')
+}
+
+// todoTxtPriority reads a priority such as "(A)". Letters after C are low.
+func todoTxtPriority(word string) (int, bool) {
+	if len(word) != 3 || word[0] != '(' || word[2] != ')' || word[1] < 'A' || word[1] > 'Z' {
+		return 0, false
+	}
+	switch word[1] {
+	case 'A':
+		return models.PriorityHigh, true
+	case 'B':
+		return models.PriorityMedium, true
+	default:
+		return models.PriorityLow, true
+	}
+}
@@ -0,0 +1,94 @@
+// Package idempotency remembers the responses to requests sent with an
+// Idempotency-Key, so that a client retrying one gets the original response
+// instead of repeating its effect.
+package idempotency
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// sweepInterval is how often expired keys are deleted
+const sweepInterval = time.Minute
+
+// Replayed are the response headers stored along with the body
+var Replayed = []string{"Content-Type", "ETag", "Location"}
+
+// Response is a stored response
+type Response struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// Record is what is known of a key: the fingerprint of the request that
+// claimed it, when it was claimed and, once that request has finished, its
+// response
+type Record struct {
+	Fingerprint string
+	// ClaimedAt tells claims of the same key apart, so that a request whose
+	// claim was taken over cannot save or release the key of the request
+	// that took it over
+	ClaimedAt time.Time
+	Response  *Response
+}
+
+// ErrClaimLost is returned when saving the response of a request whose
+// claim on its key expired and was taken over
+var ErrClaimLost = errors.New("idempotency key claimed by another request")
+
+// Store keeps the keys of each user until they expire
+type Store interface {
+	// Claim records the key for a request with fingerprint and returns true.
+	// The claim expires after deadline, when another request may take the
+	// key over. When the key is claimed already and has not expired it
+	// returns the existing record and false instead.
+	Claim(ctx context.Context, userID int, key, fingerprint string, deadline time.Duration) (Record, bool, error)
+	// Save stores the response of the request that made claim, kept until
+	// ttl from now. It returns ErrClaimLost when the claim was taken over.
+	Save(ctx context.Context, userID int, key string, claim Record, response Response, ttl time.Duration) error
+	// Release forgets a key, so that the request can be retried, unless the
+	// claim was taken over
+	Release(ctx context.Context, userID int, key string, claim Record) error
+	// Sweep deletes the keys that expired before now
+	Sweep(ctx context.Context, now time.Time) error
+}
+
+// Fingerprint identifies a request by its method, URI and body
+func Fingerprint(method, uri string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(method + " " + uri + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Sweeper keeps a store from growing with expired keys
+type Sweeper struct {
+	Store Store
+}
+
+func NewSweeper(store Store) *Sweeper {
+	return &Sweeper{Store: store}
+}
+
+// Run sweeps the store every minute until ctx is cancelled
+func (s *Sweeper) Run(ctx context.Context) {
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := s.Store.Sweep(ctx, time.Now()); err != nil && ctx.Err() == nil {
+			slog.Error("Error sweeping idempotency keys", "error", err)
+		}
+	}
+}
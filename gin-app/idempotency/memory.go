@@ -0,0 +1,77 @@
+package idempotency
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps keys in this process, for the memory store
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[entryKey]*entry
+}
+
+type entryKey struct {
+	userID int
+	key    string
+}
+
+type entry struct {
+	record  Record
+	expires time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: map[entryKey]*entry{}}
+}
+
+func (s *MemoryStore) Claim(_ context.Context, userID int, key, fingerprint string, deadline time.Duration) (Record, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	k := entryKey{userID, key}
+	if e, ok := s.entries[k]; ok && e.expires.After(now) {
+		return e.record, false, nil
+	}
+	record := Record{Fingerprint: fingerprint, ClaimedAt: now}
+	s.entries[k] = &entry{record: record, expires: now.Add(deadline)}
+	return record, true, nil
+}
+
+func (s *MemoryStore) Save(_ context.Context, userID int, key string, claim Record, response Response, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[entryKey{userID, key}]
+	if !ok || !e.record.ClaimedAt.Equal(claim.ClaimedAt) {
+		return ErrClaimLost
+	}
+	e.record.Response = &response
+	e.expires = time.Now().Add(ttl)
+	return nil
+}
+
+func (s *MemoryStore) Release(_ context.Context, userID int, key string, claim Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k := entryKey{userID, key}
+	if e, ok := s.entries[k]; ok && e.record.ClaimedAt.Equal(claim.ClaimedAt) {
+		delete(s.entries, k)
+	}
+	return nil
+}
+
+func (s *MemoryStore) Sweep(_ context.Context, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for k, e := range s.entries {
+		if !e.expires.After(now) {
+			delete(s.entries, k)
+		}
+	}
+	return nil
+}
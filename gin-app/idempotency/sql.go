@@ -0,0 +1,99 @@
+package idempotency
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// SQLStore keeps keys in the idempotency_keys table of Postgres or SQLite.
+// Its primary key lets only one of several concurrent requests with the
+// same key claim it.
+type SQLStore struct {
+	db *sql.DB
+}
+
+func NewSQLStore(db *sql.DB) *SQLStore {
+	return &SQLStore{db: db}
+}
+
+func (s *SQLStore) Claim(ctx context.Context, userID int, key, fingerprint string, deadline time.Duration) (Record, bool, error) {
+	now := time.Now().UTC().Truncate(time.Microsecond)
+
+	// An expired key, or the claim of a request that ran past its deadline,
+	// is free to claim again
+	_, err := s.db.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE user_id = $1 AND key = $2 AND expires_at <= $3", userID, key, now)
+	if err != nil {
+		return Record{}, false, err
+	}
+
+	result, err := s.db.ExecContext(ctx, `INSERT INTO idempotency_keys (user_id, key, fingerprint, created_at, expires_at) VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (user_id, key) DO NOTHING`, userID, key, fingerprint, now, now.Add(deadline))
+	if err != nil {
+		return Record{}, false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return Record{}, false, err
+	}
+	if n == 1 {
+		return Record{Fingerprint: fingerprint, ClaimedAt: now}, true, nil
+	}
+
+	record, err := s.get(ctx, userID, key)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Released since the insert, so try again
+		return s.Claim(ctx, userID, key, fingerprint, deadline)
+	}
+	return record, false, err
+}
+
+func (s *SQLStore) get(ctx context.Context, userID int, key string) (Record, error) {
+	var record Record
+	var status sql.NullInt64
+	var header sql.NullString
+	var body []byte
+	err := s.db.QueryRowContext(ctx, "SELECT fingerprint, created_at, status, header, body FROM idempotency_keys WHERE user_id = $1 AND key = $2", userID, key).
+		Scan(&record.Fingerprint, &record.ClaimedAt, &status, &header, &body)
+	if err != nil || !status.Valid {
+		return record, err
+	}
+
+	record.Response = &Response{Status: int(status.Int64), Header: http.Header{}, Body: body}
+	if header.Valid {
+		err = json.Unmarshal([]byte(header.String), &record.Response.Header)
+	}
+	return record, err
+}
+
+func (s *SQLStore) Save(ctx context.Context, userID int, key string, claim Record, response Response, ttl time.Duration) error {
+	header, err := json.Marshal(response.Header)
+	if err != nil {
+		return err
+	}
+	expires := time.Now().UTC().Truncate(time.Microsecond).Add(ttl)
+	result, err := s.db.ExecContext(ctx, `UPDATE idempotency_keys SET status = $1, header = $2, body = $3, expires_at = $4
+WHERE user_id = $5 AND key = $6 AND created_at = $7`,
+		response.Status, string(header), response.Body, expires, userID, key, claim.ClaimedAt)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err == nil && n == 0 {
+		err = ErrClaimLost
+	}
+	return err
+}
+
+func (s *SQLStore) Release(ctx context.Context, userID int, key string, claim Record) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE user_id = $1 AND key = $2 AND created_at = $3", userID, key, claim.ClaimedAt)
+	return err
+}
+
+func (s *SQLStore) Sweep(ctx context.Context, now time.Time) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE expires_at <= $1", now.UTC())
+	return err
+}
@@ -0,0 +1,62 @@
+// Package lifecycle runs the background workers of the application and stops
+// them in order when it shuts down.
+package lifecycle
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+)
+
+// Worker is a background job that runs until its context is cancelled
+type Worker interface {
+	Run(ctx context.Context)
+}
+
+// Group runs workers and stops them in the order they were started
+type Group struct {
+	ctx     context.Context
+	workers []*worker
+}
+
+type worker struct {
+	name   string
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewGroup returns a group whose workers run with contexts derived from ctx
+func NewGroup(ctx context.Context) *Group {
+	return &Group{ctx: ctx}
+}
+
+// Go runs w in the background until the group is stopped
+func (g *Group) Go(name string, w Worker) {
+	ctx, cancel := context.WithCancel(g.ctx)
+	running := &worker{name: name, cancel: cancel, done: make(chan struct{})}
+	g.workers = append(g.workers, running)
+
+	go func() {
+		defer close(running.done)
+		w.Run(ctx)
+	}()
+}
+
+// Stop cancels the workers one at a time, waiting for each to return before
+// cancelling the next. Once ctx is done the rest are cancelled without
+// waiting.
+func (g *Group) Stop(ctx context.Context) error {
+	for i, w := range g.workers {
+		w.cancel()
+		select {
+		case <-w.done:
+			slog.Info("Stopped worker", "worker", w.name)
+		case <-ctx.Done():
+			for _, rest := range g.workers[i+1:] {
+				rest.cancel()
+			}
+			return fmt.Errorf("stopping %s: %w", w.name, ctx.Err())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+// Package logging sets up the structured logger and carries a logger per
+// request through contexts, so that everything logged while serving a
+// request shares its request ID, route and user.
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+
+	"gin-app/config"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// New returns a logger writing to w in the configured format and level.
+// Records logged with the context of a span carry its trace and span IDs.
+func New(w io.Writer, cfg config.LogConfig) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: cfg.Level}
+	if cfg.Format == "text" {
+		return slog.New(traceHandler{slog.NewTextHandler(w, opts)})
+	}
+	return slog.New(traceHandler{slog.NewJSONHandler(w, opts)})
+}
+
+// traceHandler adds the IDs of the current span to records
+type traceHandler struct {
+	slog.Handler
+}
+
+func (h traceHandler) Handle(ctx context.Context, record slog.Record) error {
+	if span := trace.SpanContextFromContext(ctx); span.IsValid() {
+		record.AddAttrs(
+			slog.String("trace_id", span.TraceID().String()),
+			slog.String("span_id", span.SpanID().String()),
+		)
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h traceHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return traceHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h traceHandler) WithGroup(name string) slog.Handler {
+	return traceHandler{h.Handler.WithGroup(name)}
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying logger
+func NewContext(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// FromContext returns the logger carried by ctx, or the default logger
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(contextKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// With returns a copy of ctx whose logger adds the given attributes
+func With(ctx context.Context, args ...any) context.Context {
+	return NewContext(ctx, FromContext(ctx).With(args...))
+}
@@ -1,21 +1,197 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"gin-app/config"
 	"gin-app/database"
+	"gin-app/events"
+	"gin-app/idempotency"
+	"gin-app/lifecycle"
+	"gin-app/logging"
+	"gin-app/metrics"
+	"gin-app/openapi"
+	"gin-app/ratelimit"
+	"gin-app/recurrence"
+	"gin-app/repository"
 	"gin-app/routes"
-	"log"
+	"gin-app/stream"
+	"gin-app/tenant"
+	"gin-app/tracing"
+	"gin-app/trash"
+	"gin-app/webhooks"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/gin-gonic/gin"
 )
 
 func main() {
-	// Initialize the database
-	database.InitDB()
-	defer database.GetDB().Close()
+	// Load defaults, config file, environment and flags, in that order
+	cfg, args, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		fatal("Error loading configuration", err)
+	}
+
+	// Log structured records to stderr, and through the standard logger too
+	slog.SetDefault(logging.New(os.Stderr, cfg.Log))
+	slog.Info("Configuration", "config", cfg.String())
+
+	// Trace requests and their SQL statements
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		fatal("Error setting up tracing", err)
+	}
+
+	// "gin-app migrate ..." manages the schema instead of serving
+	if len(args) > 0 && args[0] == "migrate" {
+		os.Exit(runMigrate(cfg.Database, args[1:]))
+	}
+
+	store, workerStore, closeStore := openStore(cfg.Database)
+
+	// Background workers, started in the order they are stopped at shutdown.
+	// They work for every tenant, through the worker store.
+	workers := lifecycle.NewGroup(tenant.All(context.Background()))
+
+	// Count requests, connections and todo activity for Prometheus
+	m := metrics.New()
+	if cfg.Database.Driver != "memory" {
+		m.WatchDB(database.GetDB(), cfg.Database.Driver)
+	}
+
+	// Queue todo events for webhooks and deliver them in the background
+	bus := events.NewBus()
+	bus.Subscribe(m.Handle)
+	dispatcher := webhooks.NewDispatcher(workerStore.Webhooks, cfg.Webhooks)
+	bus.Subscribe(dispatcher.Handle)
+	workers.Go("webhook dispatcher", dispatcher)
+
+	// Push todo events to stream clients, through Postgres when several
+	// instances may share the database
+	hub := stream.NewHub(cfg.Stream.ReplaySize, cfg.Stream.ReplayWindow)
+	if cfg.Database.Driver == database.DialectPostgres {
+		fanout := stream.NewPostgresFanout(hub, database.GetDB(), cfg.Database.PostgresDSN())
+		bus.Subscribe(fanout.Handle)
+		workers.Go("stream fanout", fanout)
+	} else {
+		bus.Subscribe(hub.Handle)
+	}
+
+	// Keep recurring todos materialized in the background, once everything
+	// its events go to listens. Requests advance the series of their own
+	// tenant through the request store.
+	scheduler := recurrence.NewScheduler(store, bus, cfg.Scheduler)
+	workers.Go("scheduler", recurrence.NewScheduler(workerStore, bus, cfg.Scheduler))
+
+	// Empty the trash of todos deleted longer ago than the retention period
+	workers.Go("trash retention", trash.NewRetention(workerStore.Todos, cfg.Trash))
+
+	doc, err := openapi.Load()
+	if err != nil {
+		fatal("Error loading the OpenAPI document", err)
+	}
+
+	// Rate limit buckets, shared through Postgres when asked to
+	var limits ratelimit.Store = ratelimit.NewMemoryStore()
+	if cfg.RateLimit.Store == "postgres" {
+		limits = ratelimit.NewPostgresStore(database.GetDB())
+	}
+	workers.Go("rate limit sweeper", ratelimit.NewSweeper(limits, cfg.RateLimit.LongestPeriod()))
 
-	// Set up the Gin router using the routes package
-	r := routes.SetupRouter()
+	// Responses to requests with an Idempotency-Key, kept with the data
+	var keys idempotency.Store = idempotency.NewMemoryStore()
+	expiredKeys := keys
+	if cfg.Database.Driver != "memory" {
+		keys = idempotency.NewSQLStore(database.GetDB())
+		expiredKeys = idempotency.NewSQLStore(database.GetWorkerDB())
+	}
+	workers.Go("idempotency key sweeper", idempotency.NewSweeper(expiredKeys))
+
+	// Set up the Gin router using the routes package. Requests are logged
+	// by the router, so gin's own debug output is off unless GIN_MODE asks.
+	if os.Getenv(gin.EnvGinMode) == "" {
+		gin.SetMode(gin.ReleaseMode)
+	}
+	r := routes.SetupRouter(cfg, store, scheduler, bus, hub, doc, limits, keys, m)
+
+	// Serve until SIGINT or SIGTERM. Streams are ended as soon as shutdown
+	// begins, since they would otherwise hold it up until the timeout.
+	srv := &http.Server{Addr: cfg.Server.Addr, Handler: r}
+	srv.RegisterOnShutdown(hub.Close)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	served := make(chan error, 1)
+	go func() { served <- srv.ListenAndServe() }()
+	slog.Info("Listening", "addr", cfg.Server.Addr)
+	select {
+	case err := <-served:
+		fatal("Failed to start server", err)
+	case <-ctx.Done():
+		stop()
+	}
+
+	// Drain in-flight requests, then stop the workers, then release the
+	// database and flush spans, all within the drain timeout
+	slog.Info("Shutting down", "drain_timeout", cfg.Server.DrainTimeout.String())
+	drain, cancel := context.WithTimeout(context.Background(), cfg.Server.DrainTimeout)
+	defer cancel()
+	if err := srv.Shutdown(drain); err != nil {
+		slog.Error("Error draining requests", "error", err)
+		srv.Close()
+	}
+	if err := workers.Stop(drain); err != nil {
+		slog.Error("Error stopping workers", "error", err)
+	}
+	closeStore()
+	if err := shutdownTracing(drain); err != nil {
+		slog.Error("Error flushing spans", "error", err)
+	}
+	slog.Info("Stopped")
+}
+
+// fatal logs an error that stops the server from running and exits
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+// openStore builds the repository stores for the configured engine, one for
+// requests and one for background workers, and returns a function that
+// releases their resources
+func openStore(cfg config.DatabaseConfig) (*repository.Store, *repository.Store, func()) {
+	if cfg.Driver == "memory" {
+		store := repository.NewMemory()
+		return store, store, func() {}
+	}
+
+	if err := database.InitDB(cfg); err != nil {
+		fatal("Error connecting to the database", err)
+	}
+	if cfg.AutoMigrate {
+		if err := database.Migrate(); err != nil {
+			fatal("Error migrating database", err)
+		}
+	}
+
+	// Tenants are isolated by row-level security, which only the worker
+	// role may bypass
+	if err := database.CheckRowSecurity(context.Background()); err != nil {
+		fatal("Refusing to serve tenants", err)
+	}
 
-	// Start the server
-	if err := r.Run(":8080"); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	closeDB := func() { database.Close() }
+	if cfg.Driver == database.DialectSQLite {
+		store := repository.NewSQLite(database.GetDB())
+		return store, store, closeDB
 	}
+	return repository.NewPostgres(database.GetDB()), repository.NewPostgres(database.GetWorkerDB()), closeDB
 }
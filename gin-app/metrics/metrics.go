@@ -0,0 +1,106 @@
+// Package metrics exposes the API's traffic, its connection pool and counts
+// of todo activity to Prometheus.
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"time"
+
+	"gin-app/events"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// unmatchedRoute labels requests that matched no route, so that probes of
+// arbitrary paths share one series
+const unmatchedRoute = "unmatched"
+
+// Metrics holds the collectors of one registry. Requests are labelled by
+// route template rather than path, which keeps the number of series bounded.
+type Metrics struct {
+	Registry *prometheus.Registry
+
+	requests       *prometheus.CounterVec
+	latency        *prometheus.HistogramVec
+	inFlight       prometheus.Gauge
+	todosCreated   prometheus.Counter
+	todosCompleted prometheus.Counter
+}
+
+func New() *Metrics {
+	m := &Metrics{
+		Registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_requests_total",
+			Help: "HTTP requests served, by method, route template and status.",
+		}, []string{"method", "route", "status"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "Time taken to serve HTTP requests, by method, route template and status.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		inFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "http_requests_in_flight",
+			Help: "HTTP requests being served.",
+		}),
+		todosCreated: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "todos_created_total",
+			Help: "Todos created by clients, including batches and imports.",
+		}),
+		todosCompleted: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "todos_completed_total",
+			Help: "Todos marked as completed.",
+		}),
+	}
+	m.Registry.MustRegister(
+		m.requests, m.latency, m.inFlight, m.todosCreated, m.todosCompleted,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return m
+}
+
+// WatchDB reports the connection pool statistics of db
+func (m *Metrics) WatchDB(db *sql.DB, name string) {
+	m.Registry.MustRegister(collectors.NewDBStatsCollector(db, name))
+}
+
+// Middleware counts and times every request
+func (m *Metrics) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		m.inFlight.Inc()
+		defer m.inFlight.Dec()
+
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+		status := strconv.Itoa(c.Writer.Status())
+		m.requests.WithLabelValues(c.Request.Method, route, status).Inc()
+		m.latency.WithLabelValues(c.Request.Method, route, status).Observe(time.Since(start).Seconds())
+	}
+}
+
+// Handler serves the registry in the Prometheus text format
+func (m *Metrics) Handler() gin.HandlerFunc {
+	return gin.WrapH(promhttp.HandlerFor(m.Registry, promhttp.HandlerOpts{}))
+}
+
+// Handle counts todo events; subscribe it to the event bus
+func (m *Metrics) Handle(_ context.Context, event events.Event) error {
+	switch event.Type {
+	case events.TodoCreated:
+		m.todosCreated.Inc()
+	case events.TodoCompleted:
+		m.todosCompleted.Inc()
+	}
+	return nil
+}
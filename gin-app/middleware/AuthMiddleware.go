@@ -1,31 +1,159 @@
 package middleware
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"gin-app/audit"
+	"gin-app/config"
+	"gin-app/logging"
+	"gin-app/models"
+	"gin-app/repository"
+	"gin-app/tenant"
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/gin-gonic/gin"
 )
 
-func AuthMiddleware() gin.HandlerFunc {
+// UserIDKey is the gin context key holding the authenticated user's ID
+const UserIDKey = "userID"
+
+// RoleKey is the gin context key holding the account role of the user
+const RoleKey = "role"
+
+// TenantIDKey is the gin context key holding the tenant of the token
+const TenantIDKey = "tenantID"
+
+// claims are those of the tokens issued here. The role is the account's
+// role when the token was issued; requests are authorized with the role the
+// account has at the time, so a change of role applies at once.
+type claims struct {
+	Role   string `json:"role,omitempty"`
+	Tenant int    `json:"tenant,omitempty"`
+	jwt.StandardClaims
+}
+
+// GenerateToken issues a signed JWT whose subject is the user's ID and
+// which carries their role and tenant
+func GenerateToken(cfg config.AuthConfig, user models.User) (string, error) {
+	now := time.Now()
+	claims := claims{
+		Role:   user.Role,
+		Tenant: user.TenantID,
+		StandardClaims: jwt.StandardClaims{
+			Subject:   strconv.Itoa(user.ID),
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(cfg.TokenTTL).Unix(),
+		},
+	}
+
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(cfg.JWTSecret))
+}
+
+// AuthMiddleware accepts the tokens of accounts that still exist, in tenants
+// that are not suspended, and authorizes requests with the account's current
+// role rather than the one in the token. The request context acts for the
+// tenant of the token, so that the database only shows that tenant's rows.
+func AuthMiddleware(cfg config.AuthConfig, tenants repository.TenantRepository, users repository.UserRepository) gin.HandlerFunc {
+	secret := []byte(cfg.JWTSecret)
+
 	return func(c *gin.Context) {
-		tokenString := c.GetHeader("Authorization")
-		if tokenString == "" {
+		id, ok := authenticate(secret, c.GetHeader("Authorization"))
+		if !ok {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 			c.Abort()
 			return
 		}
 
-		// Validate the token
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			return []byte("your-secret-key"), nil
-		})
-		if err != nil || !token.Valid {
+		t, err := tenants.Get(c.Request.Context(), id.tenantID)
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			c.Abort()
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			c.Abort()
+			return
+		}
+		if t.SuspendedAt != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Tenant is suspended"})
+			c.Abort()
+			return
+		}
+
+		ctx := tenant.With(c.Request.Context(), id.tenantID)
+		user, err := users.Get(ctx, id.userID)
+		if errors.Is(err, repository.ErrNotFound) || (err == nil && user.TenantID != id.tenantID) {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 			c.Abort()
 			return
 		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			c.Abort()
+			return
+		}
 
+		c.Set(UserIDKey, id.userID)
+		c.Set(RoleKey, user.Role)
+		c.Set(TenantIDKey, id.tenantID)
+		ctx = logging.With(ctx, "user_id", id.userID, "tenant_id", id.tenantID)
+		c.Request = c.Request.WithContext(audit.WithActor(ctx, id.userID))
+		c.Next()
+	}
+}
+
+// identity is what a valid token says of its bearer
+type identity struct {
+	userID   int
+	tenantID int
+}
+
+// authenticate returns the identity of a valid bearer token in an
+// Authorization header. Tokens issued before tenants are the default
+// tenant's.
+func authenticate(secret []byte, header string) (identity, bool) {
+	tokenString := strings.TrimPrefix(header, "Bearer ")
+	if tokenString == "" {
+		return identity{}, false
+	}
+
+	// Validate the token
+	claims := &claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+		}
+		return secret, nil
+	})
+	if err != nil || !token.Valid {
+		return identity{}, false
+	}
+
+	userID, err := strconv.Atoi(claims.Subject)
+	if err != nil || userID <= 0 || claims.Tenant < 0 {
+		return identity{}, false
+	}
+	id := identity{userID: userID, tenantID: claims.Tenant}
+	if id.tenantID == 0 {
+		id.tenantID = tenant.Default
+	}
+	return id, true
+}
+
+// TokenFromQuery lets clients that cannot set headers, such as browser
+// EventSource and WebSocket, pass their token as ?access_token=. It must run
+// before AuthMiddleware.
+func TokenFromQuery() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token := c.Query("access_token"); token != "" && c.GetHeader("Authorization") == "" {
+			c.Request.Header.Set("Authorization", "Bearer "+token)
+		}
 		c.Next()
 	}
 }
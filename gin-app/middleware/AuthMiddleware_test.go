@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gin-app/config"
+	"gin-app/models"
+	"gin-app/repository"
+	"gin-app/tenant"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestAuthUsesCurrentRole checks that a token is authorized with the role
+// its account has now, and refused once the account is gone
+func TestAuthUsesCurrentRole(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := tenant.With(context.Background(), tenant.Default)
+	store := repository.NewMemory()
+	cfg := config.AuthConfig{JWTSecret: strings.Repeat("k", 32), TokenTTL: time.Hour}
+	r := gin.New()
+	r.GET("/role", AuthMiddleware(cfg, store.Tenants, store.Users), func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetString(RoleKey))
+	})
+	get := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/role", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	admin := models.User{TenantID: tenant.Default, Email: "admin@example.com", Timezone: "UTC", Role: models.AccountAdmin}
+	if err := store.Users.Create(ctx, &admin); err != nil {
+		t.Fatal(err)
+	}
+	token, err := GenerateToken(cfg, admin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := get(token); w.Code != http.StatusOK || w.Body.String() != models.AccountAdmin {
+		t.Fatalf("before the demotion: %d %s", w.Code, w.Body)
+	}
+	if err := store.Users.SetRole(ctx, admin.ID, models.AccountMember); err != nil {
+		t.Fatal(err)
+	}
+	if w := get(token); w.Code != http.StatusOK || w.Body.String() != models.AccountMember {
+		t.Errorf("after the demotion: %d %s", w.Code, w.Body)
+	}
+
+	removed, err := GenerateToken(cfg, models.User{ID: admin.ID + 1, TenantID: tenant.Default, Role: models.AccountAdmin})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := get(removed); w.Code != http.StatusUnauthorized {
+		t.Errorf("token of a missing account: got %d", w.Code)
+	}
+}
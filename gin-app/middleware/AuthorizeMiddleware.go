@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"gin-app/authz"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Authorize lets a request through when the role set by AuthMiddleware
+// grants the permission policy requires of its route, and answers 403 with
+// the reason otherwise. Routes the policy does not cover are refused, so
+// that a new route cannot be left open by mistake.
+func Authorize(policy authz.Policy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		need, ok := policy.Required(c.Request.Method, c.FullPath())
+		if !ok {
+			c.JSON(http.StatusForbidden, gin.H{"error": "No authorization policy covers this route"})
+			c.Abort()
+			return
+		}
+
+		role := c.GetString(RoleKey)
+		if !authz.Allows(role, need) {
+			c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("Requires the %s permission, which the %s role does not have", need, role)})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
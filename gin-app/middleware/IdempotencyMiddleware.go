@@ -0,0 +1,147 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"gin-app/idempotency"
+	"gin-app/logging"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// maxIdempotencyKey bounds the length of an Idempotency-Key
+	maxIdempotencyKey = 255
+	// maxIdempotentBody bounds the body read to fingerprint a request; it
+	// is above the limits of the handlers, so that theirs apply
+	maxIdempotentBody = 8 << 20
+)
+
+// Idempotency makes POST requests sent with an Idempotency-Key safe to
+// retry. The first request with a key runs and its response is kept for
+// ttl; retries with the same method, URI and body get that response again,
+// marked with Idempotent-Replayed. A key reused for a different request
+// gets 422, and one whose first request is still running gets 409. The
+// first request is cancelled after timeout, when a retry takes its key
+// over, so a request that hangs or whose server dies does not hold the key
+// until ttl. Server errors are not kept, so that they can be retried. It
+// must run after AuthMiddleware, since keys belong to users.
+func Idempotency(store idempotency.Store, timeout, ttl time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader("Idempotency-Key")
+		if key == "" || c.Request.Method != http.MethodPost {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKey {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key must be at most 255 characters"})
+			c.Abort()
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxIdempotentBody+1))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			c.Abort()
+			return
+		}
+		if len(body) > maxIdempotentBody {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("Requests with an Idempotency-Key are limited to %d bytes", maxIdempotentBody)})
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		ctx := c.Request.Context()
+		userID := c.GetInt(UserIDKey)
+		fingerprint := idempotency.Fingerprint(c.Request.Method, c.Request.URL.RequestURI(), body)
+		record, claimed, err := store.Claim(ctx, userID, key, fingerprint, timeout)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			c.Abort()
+			return
+		}
+		if !claimed {
+			replay(c, fingerprint, record)
+			return
+		}
+
+		// The handler must finish before its claim may be taken over
+		handlerCtx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		c.Request = c.Request.WithContext(handlerCtx)
+
+		// The key is released unless the response is kept, panics included.
+		// Neither depends on the client waiting for the response.
+		ctx = context.WithoutCancel(ctx)
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		kept := false
+		defer func() {
+			if kept {
+				return
+			}
+			if err := store.Release(ctx, userID, key, record); err != nil {
+				logging.FromContext(ctx).ErrorContext(ctx, "Error releasing idempotency key", "error", err)
+			}
+		}()
+
+		c.Next()
+
+		if recorder.Status() >= http.StatusInternalServerError {
+			return
+		}
+		response := idempotency.Response{Status: recorder.Status(), Header: http.Header{}, Body: recorder.body.Bytes()}
+		for _, name := range idempotency.Replayed {
+			if value := recorder.Header().Get(name); value != "" {
+				response.Header.Set(name, value)
+			}
+		}
+		if err := store.Save(ctx, userID, key, record, response, ttl); err != nil {
+			logging.FromContext(ctx).ErrorContext(ctx, "Error saving idempotent response", "error", err)
+			return
+		}
+		kept = true
+	}
+}
+
+// replay answers a request whose key was claimed before
+func replay(c *gin.Context, fingerprint string, record idempotency.Record) {
+	switch {
+	case record.Fingerprint != fingerprint:
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Idempotency-Key was already used for a different request"})
+	case record.Response == nil:
+		c.JSON(http.StatusConflict, gin.H{"error": "A request with this Idempotency-Key is still in progress"})
+	default:
+		for name, values := range record.Response.Header {
+			for _, value := range values {
+				c.Writer.Header().Add(name, value)
+			}
+		}
+		c.Header("Idempotent-Replayed", "true")
+		c.Status(record.Response.Status)
+		c.Writer.Write(record.Response.Body)
+	}
+	c.Abort()
+}
+
+// responseRecorder keeps a copy of the body written through it
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *responseRecorder) WriteString(s string) (int, error) {
+	r.body.WriteString(s)
+	return r.ResponseWriter.WriteString(s)
+}
@@ -0,0 +1,172 @@
+package middleware
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gin-app/database"
+	"gin-app/idempotency"
+	"gin-app/models"
+	"gin-app/repository"
+	"gin-app/tenant"
+
+	"github.com/gin-gonic/gin"
+)
+
+// idempotencyStores opens each store of keys, the SQL one on SQLite with
+// user 1 in it
+var idempotencyStores = map[string]func(t *testing.T) idempotency.Store{
+	"memory": func(t *testing.T) idempotency.Store { return idempotency.NewMemoryStore() },
+	"sqlite": func(t *testing.T) idempotency.Store {
+		db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "todo.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+		db.SetMaxOpenConns(1)
+		migrator, err := database.NewMigrator(db, database.DialectSQLite)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := migrator.Up(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		user := models.User{TenantID: tenant.Default, Email: "user@example.com", Timezone: "UTC"}
+		if err := repository.NewSQLite(db).Users.Create(tenant.With(context.Background(), tenant.Default), &user); err != nil {
+			t.Fatal(err)
+		}
+		return idempotency.NewSQLStore(db)
+	},
+}
+
+// idempotentServer serves POST /todos behind Idempotency as user 1. The
+// handler answers 201 with its body and how many times it ran, its first
+// run only once wait is closed when it is set; a body of "fail" gets 500.
+type idempotentServer struct {
+	router *gin.Engine
+	runs   atomic.Int32
+	wait   chan struct{}
+}
+
+func newIdempotentServer(store idempotency.Store, timeout time.Duration) *idempotentServer {
+	gin.SetMode(gin.TestMode)
+	s := &idempotentServer{router: gin.New()}
+	s.router.POST("/todos", func(c *gin.Context) {
+		c.Set(UserIDKey, 1)
+	}, Idempotency(store, timeout, time.Hour), func(c *gin.Context) {
+		run := s.runs.Add(1)
+		if run == 1 && s.wait != nil {
+			<-s.wait
+		}
+		body, _ := c.GetRawData()
+		if string(body) == "fail" {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed"})
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{"body": string(body), "run": run})
+	})
+	return s
+}
+
+func (s *idempotentServer) post(key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/todos", strings.NewReader(body))
+	req.Header.Set("Idempotency-Key", key)
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	return w
+}
+
+func TestIdempotency(t *testing.T) {
+	for name, open := range idempotencyStores {
+		t.Run(name, func(t *testing.T) {
+			s := newIdempotentServer(open(t), time.Minute)
+
+			first := s.post("a", "one")
+			replayed := s.post("a", "one")
+			if first.Code != http.StatusCreated || replayed.Code != http.StatusCreated || replayed.Body.String() != first.Body.String() {
+				t.Errorf("got %d %s, then %d %s", first.Code, first.Body, replayed.Code, replayed.Body)
+			}
+			if replayed.Header().Get("Idempotent-Replayed") != "true" || replayed.Header().Get("Content-Type") == "" {
+				t.Errorf("replay headers %v", replayed.Header())
+			}
+			if w := s.post("a", "two"); w.Code != http.StatusUnprocessableEntity {
+				t.Errorf("key reused for another body: got %d", w.Code)
+			}
+
+			// Server errors are forgotten so that they can be retried
+			if w := s.post("b", "fail"); w.Code != http.StatusInternalServerError {
+				t.Errorf("failing request: got %d", w.Code)
+			}
+			if w := s.post("b", "fail"); w.Header().Get("Idempotent-Replayed") != "" {
+				t.Error("server error replayed")
+			}
+			if w := s.post("c", "three"); !strings.Contains(w.Body.String(), `"run":4`) {
+				t.Errorf("ran %s, want run 4", w.Body)
+			}
+		})
+	}
+}
+
+func TestIdempotencyConcurrentClaim(t *testing.T) {
+	for name, open := range idempotencyStores {
+		t.Run(name, func(t *testing.T) {
+			s := newIdempotentServer(open(t), time.Minute)
+			s.wait = make(chan struct{})
+			done := make(chan *httptest.ResponseRecorder)
+			go func() { done <- s.post("a", "one") }()
+			for s.runs.Load() == 0 {
+				time.Sleep(time.Millisecond)
+			}
+
+			if w := s.post("a", "one"); w.Code != http.StatusConflict {
+				t.Errorf("request while the first runs: got %d", w.Code)
+			}
+			close(s.wait)
+			if w := <-done; w.Code != http.StatusCreated {
+				t.Errorf("first request: got %d", w.Code)
+			}
+			if w := s.post("a", "one"); w.Header().Get("Idempotent-Replayed") != "true" {
+				t.Errorf("request after the first: got %d %s", w.Code, w.Body)
+			}
+			if runs := s.runs.Load(); runs != 1 {
+				t.Errorf("handler ran %d times, want 1", runs)
+			}
+		})
+	}
+}
+
+// TestIdempotencyClaimTakenOver has the first request run past its deadline,
+// so that a retry takes its key over; the first one then cannot keep its
+// response or release the retry's key
+func TestIdempotencyClaimTakenOver(t *testing.T) {
+	for name, open := range idempotencyStores {
+		t.Run(name, func(t *testing.T) {
+			s := newIdempotentServer(open(t), 20*time.Millisecond)
+			s.wait = make(chan struct{})
+			done := make(chan *httptest.ResponseRecorder)
+			go func() { done <- s.post("a", "one") }()
+			for s.runs.Load() == 0 {
+				time.Sleep(time.Millisecond)
+			}
+			time.Sleep(40 * time.Millisecond)
+
+			retry := s.post("a", "one")
+			if retry.Code != http.StatusCreated || !strings.Contains(retry.Body.String(), `"run":2`) {
+				t.Fatalf("retry after the deadline: got %d %s", retry.Code, retry.Body)
+			}
+			close(s.wait)
+			<-done
+
+			if w := s.post("a", "one"); w.Header().Get("Idempotent-Replayed") != "true" || w.Body.String() != retry.Body.String() {
+				t.Errorf("got %d %s, want the retry's response replayed", w.Code, w.Body)
+			}
+		})
+	}
+}
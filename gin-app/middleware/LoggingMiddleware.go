@@ -0,0 +1,102 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"gin-app/logging"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestIDHeader carries the ID that correlates a request across services
+const RequestIDHeader = "X-Request-ID"
+
+// RequestIDKey is the gin context key holding the request's ID
+const RequestIDKey = "requestID"
+
+// maxRequestIDLength bounds the IDs taken from clients
+const maxRequestIDLength = 128
+
+// RequestID gives every request an ID, the client's X-Request-ID when it is
+// sensible and otherwise a new one, and echoes it in the response. The
+// request's logger carries it from here on.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		c.Set(RequestIDKey, id)
+		c.Header(RequestIDHeader, id)
+		c.Request = c.Request.WithContext(logging.With(c.Request.Context(), "request_id", id))
+		c.Next()
+	}
+}
+
+// validRequestID accepts IDs of printable ASCII without spaces, which can be
+// logged and echoed safely
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// RequestLogger adds the method and route to the request's logger, so that
+// everything logged while serving it names them, and logs each request once
+// it is served with its status and latency. AuthMiddleware adds the user.
+func RequestLogger() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Request = c.Request.WithContext(logging.With(c.Request.Context(),
+			"method", c.Request.Method,
+			"route", c.FullPath(),
+		))
+
+		c.Next()
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		if status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		attrs := []any{
+			"path", c.Request.URL.Path,
+			"status", status,
+			"latency_ms", float64(time.Since(start).Microseconds()) / 1000,
+			"bytes", c.Writer.Size(),
+			"client_ip", c.ClientIP(),
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, "errors", c.Errors.String())
+		}
+		ctx := c.Request.Context()
+		logging.FromContext(ctx).Log(ctx, level, "Request", attrs...)
+	}
+}
+
+// Recovery answers 500 to requests whose handler panicked and logs the panic
+// with its stack
+func Recovery() gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(nil, func(c *gin.Context, err any) {
+		ctx := c.Request.Context()
+		logging.FromContext(ctx).ErrorContext(ctx, "Panic serving request", "error", err, "stack", string(debug.Stack()))
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+	})
+}
@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"gin-app/authz"
+	"gin-app/config"
+	"gin-app/logging"
+	"gin-app/tenant"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OperatorAuth accepts the operator token of cfg in place of AuthMiddleware.
+// Its requests have the operator role and act for every tenant. Without a
+// configured token every request is refused.
+func OperatorAuth(cfg config.AuthConfig) gin.HandlerFunc {
+	expected := []byte(cfg.OperatorToken)
+
+	return func(c *gin.Context) {
+		token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if len(expected) == 0 || subtle.ConstantTimeCompare([]byte(token), expected) != 1 {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			c.Abort()
+			return
+		}
+
+		c.Set(RoleKey, authz.RoleOperator)
+		ctx := logging.With(c.Request.Context(), "operator", true)
+		c.Request = c.Request.WithContext(tenant.All(ctx))
+		c.Next()
+	}
+}
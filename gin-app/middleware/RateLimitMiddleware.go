@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"gin-app/config"
+	"gin-app/logging"
+	"gin-app/ratelimit"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RateLimit gives every client a token bucket for the routes of a group and
+// answers 429 once it is empty. Clients are told apart by the subject of a
+// valid token, or else by IP, so it can run before AuthMiddleware. Responses
+// carry the RateLimit-* headers of the bucket, and 429s Retry-After. When
+// the store fails, requests are let through.
+func RateLimit(cfg config.AuthConfig, store ratelimit.Store, group string, limit ratelimit.Limit) gin.HandlerFunc {
+	if limit.IsZero() {
+		return func(c *gin.Context) { c.Next() }
+	}
+	secret := []byte(cfg.JWTSecret)
+	policy := fmt.Sprintf("%d;w=%d", limit.Requests, int(math.Ceil(limit.Period.Seconds())))
+
+	return func(c *gin.Context) {
+		key := group + ":ip:" + c.ClientIP()
+		if id, ok := authenticate(secret, c.GetHeader("Authorization")); ok {
+			key = group + ":user:" + strconv.Itoa(id.userID)
+		}
+
+		ctx := c.Request.Context()
+		res, err := store.Take(ctx, key, limit)
+		if err != nil {
+			logging.FromContext(ctx).ErrorContext(ctx, "Error taking from rate limit bucket", "key", key, "error", err)
+			c.Next()
+			return
+		}
+
+		c.Header("RateLimit-Policy", policy)
+		c.Header("RateLimit-Limit", strconv.Itoa(limit.Requests))
+		c.Header("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		c.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+		if !res.Allowed {
+			retryAfter := max(ceilSeconds(res.RetryAfter), 1)
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": fmt.Sprintf("Too many requests; retry in %d seconds", retryAfter)})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
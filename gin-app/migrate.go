@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+
+	"gin-app/config"
+	"gin-app/database"
+)
+
+const migrateUsage = `usage: gin-app [flags] migrate <command>
+
+commands:
+  up              apply all pending migrations
+  down [N]        roll back the last N migrations (default 1)
+  status          list migrations and whether they are applied
+  create <name>   add an empty up/down migration pair under -dir
+`
+
+// runMigrate implements the "migrate" subcommand and returns the exit code
+func runMigrate(cfg config.DatabaseConfig, args []string) int {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	dir := flags.String("dir", "database/migrations", "migration source directory used by create")
+	flags.Usage = func() { fmt.Fprint(os.Stderr, migrateUsage); flags.PrintDefaults() }
+	if err := flags.Parse(args); err != nil || flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	command, rest := flags.Arg(0), flags.Args()[1:]
+	if command == "create" {
+		if len(rest) != 1 {
+			flags.Usage()
+			return 2
+		}
+		files, err := database.CreateMigration(*dir, rest[0])
+		for _, f := range files {
+			fmt.Println("Created", f)
+		}
+		return exitOnError(err)
+	}
+
+	if cfg.Driver == "memory" {
+		fmt.Fprintln(os.Stderr, "The memory store has no schema to migrate")
+		return 1
+	}
+	if err := database.InitDB(cfg); err != nil {
+		return exitOnError(err)
+	}
+	defer database.Close()
+
+	migrator, err := database.NewMigrator(database.GetWorkerDB(), database.GetDialect())
+	if err != nil {
+		return exitOnError(err)
+	}
+	ctx := context.Background()
+
+	switch command {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		for _, m := range applied {
+			fmt.Printf("Applied %04d_%s\n", m.Version, m.Name)
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Println("Already up to date")
+		}
+		return exitOnError(err)
+	case "down":
+		steps := 1
+		if len(rest) > 0 {
+			if steps, err = strconv.Atoi(rest[0]); err != nil || steps < 1 {
+				fmt.Fprintf(os.Stderr, "Invalid step count %q\n", rest[0])
+				return 2
+			}
+		}
+		reverted, err := migrator.Down(ctx, steps)
+		for _, m := range reverted {
+			fmt.Printf("Reverted %04d_%s\n", m.Version, m.Name)
+		}
+		return exitOnError(err)
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return exitOnError(err)
+		}
+		for _, s := range statuses {
+			state := "pending"
+			switch {
+			case s.Missing:
+				state = "applied, missing from binary"
+			case s.Modified:
+				state = "applied, MODIFIED since"
+			case s.Applied:
+				state = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d  %-30s %s\n", s.Version, s.Name, state)
+		}
+		return 0
+	default:
+		flags.Usage()
+		return 2
+	}
+}
+
+func exitOnError(err error) int {
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 1
+	}
+	return 0
+}
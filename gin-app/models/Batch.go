@@ -0,0 +1,35 @@
+package models
+
+// Batch modes: an atomic batch applies all of its operations or none, a
+// best-effort one reports the outcome of each
+const (
+	BatchAtomic     = "atomic"
+	BatchBestEffort = "best_effort"
+)
+
+// Batch is the payload of POST /todos:batch. Mode defaults to atomic.
+type Batch struct {
+	Mode       string           `json:"mode" binding:"omitempty,oneof=atomic best_effort"`
+	Operations []BatchOperation `json:"operations" binding:"required,min=1,max=1000,dive"`
+}
+
+// BatchOperation creates a todo, or updates or deletes todo ID. Version
+// plays the part of If-Match and Children of the children parameter of
+// PUT /todos/:id.
+type BatchOperation struct {
+	Op       string `json:"op" binding:"required,oneof=create update delete"`
+	ID       int    `json:"id"`
+	Version  int    `json:"version"`
+	Children string `json:"children" binding:"omitempty,oneof=refuse complete"`
+	Todo     *Todo  `json:"todo"`
+}
+
+// BatchResult is the outcome of one operation, with the status code it
+// would have had as a request of its own
+type BatchResult struct {
+	Index  int    `json:"index"`
+	Op     string `json:"op"`
+	Status int    `json:"status"`
+	Todo   *Todo  `json:"todo,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
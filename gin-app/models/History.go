@@ -0,0 +1,44 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// History operations, one per kind of change made through the API
+const (
+	HistoryCreate        = "create"
+	HistoryUpdate        = "update"
+	HistoryDelete        = "delete"
+	HistoryRestore       = "restore"
+	HistoryPurge         = "purge"
+	HistoryAddBlocker    = "add_blocker"
+	HistoryRemoveBlocker = "remove_blocker"
+	HistoryRevert        = "revert"
+	HistoryMove          = "move"
+)
+
+// HistoryEntry records one change to a todo. Version is the todo's version
+// after the change and Snapshot the todo at that version.
+type HistoryEntry struct {
+	ID        int                    `json:"id"`
+	TodoID    int                    `json:"todo_id"`
+	UserID    int                    `json:"-"`
+	ActorID   int                    `json:"actor_id"`
+	Operation string                 `json:"operation"`
+	Version   int                    `json:"version"`
+	Changes   map[string]FieldChange `json:"changes"`
+	Snapshot  Todo                   `json:"-"`
+	CreatedAt time.Time              `json:"created_at"`
+}
+
+// FieldChange is the JSON value of a field before and after a change
+type FieldChange struct {
+	Before json.RawMessage `json:"before"`
+	After  json.RawMessage `json:"after"`
+}
+
+// Revert is the payload of POST /todos/:id/revert
+type Revert struct {
+	Version int `json:"version" binding:"required,min=1"`
+}
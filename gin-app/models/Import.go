@@ -0,0 +1,9 @@
+package models
+
+// ImportRow reports one todo of a file given to POST /todos/import: the
+// todo as it would be created, with the file's own IDs, or why it cannot be
+type ImportRow struct {
+	Line  int    `json:"line"`
+	Todo  *Todo  `json:"todo,omitempty"`
+	Error string `json:"error,omitempty"`
+}
@@ -0,0 +1,62 @@
+package models
+
+import "time"
+
+// List roles, from least to most privileged. Viewers read the todos of a
+// list, editors also change them, and owners also manage the list and its
+// members.
+const (
+	RoleViewer = "viewer"
+	RoleEditor = "editor"
+	RoleOwner  = "owner"
+)
+
+// List is a named project grouping todos. Its todos belong to the account
+// of OwnerID whoever creates them; Role is the caller's role on the list.
+type List struct {
+	ID        int       `json:"id"`
+	OwnerID   int       `json:"owner_id"`
+	Name      string    `json:"name"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ListInput is the payload of POST /lists and PUT /lists/:id
+type ListInput struct {
+	Name string `json:"name" binding:"required,max=100"`
+}
+
+// ListMember is someone with access to a list, the owner's account included
+type ListMember struct {
+	UserID int    `json:"user_id"`
+	Email  string `json:"email"`
+	Role   string `json:"role"`
+}
+
+// MemberRole is the payload of PUT /lists/:id/members/:user_id
+type MemberRole struct {
+	Role string `json:"role" binding:"required,oneof=viewer editor owner"`
+}
+
+// ListInvite is a pending invitation to join a list
+type ListInvite struct {
+	ID        int       `json:"id"`
+	ListID    int       `json:"list_id"`
+	ListName  string    `json:"list_name"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	InvitedBy int       `json:"invited_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Invitation is the payload of POST /lists/:id/invites
+type Invitation struct {
+	Email string `json:"email" binding:"required,email"`
+	Role  string `json:"role" binding:"required,oneof=viewer editor owner"`
+}
+
+// Move is the payload of POST /todos/:id/move. A null list_id takes the
+// todo out of its list.
+type Move struct {
+	ListID *int `json:"list_id"`
+}
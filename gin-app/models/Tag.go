@@ -0,0 +1,18 @@
+package models
+
+// Tag is a label a user attaches to any number of their todos
+type Tag struct {
+	ID        int    `json:"id"`
+	Name      string `json:"name"`
+	TodoCount int    `json:"todo_count"`
+}
+
+// TagRename is the payload of PUT /tags/:id
+type TagRename struct {
+	Name string `json:"name" binding:"required,max=64"`
+}
+
+// TagMerge is the payload of POST /tags/:id/merge
+type TagMerge struct {
+	Into int `json:"into" binding:"required"`
+}
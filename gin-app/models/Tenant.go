@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// DefaultTenant names the tenant of accounts registered without one
+const DefaultTenant = "default"
+
+// Tenant is an organization sharing the deployment. Its accounts and their
+// data are isolated from those of other tenants. The accounts of a
+// suspended tenant cannot log in or use their tokens.
+type Tenant struct {
+	ID          int        `json:"id"`
+	Name        string     `json:"name"`
+	SuspendedAt *time.Time `json:"suspended_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// TenantInput is the payload of POST /tenants: the tenant and its first
+// account, which is made an admin
+type TenantInput struct {
+	Name          string `json:"name" binding:"required,max=63"`
+	AdminEmail    string `json:"admin_email" binding:"required,email"`
+	AdminPassword string `json:"admin_password" binding:"required,min=8,max=72"`
+}
@@ -1,8 +1,55 @@
 package models
 
+import "time"
+
+// Todo priorities, from least to most urgent
+const (
+	PriorityNone = iota
+	PriorityLow
+	PriorityMedium
+	PriorityHigh
+)
+
 // Todo represents a To-Do item
 type Todo struct {
-	ID        int    `json:"id"`
-	Title     string `json:"title"`
-	Completed bool   `json:"completed"`
+	ID          int        `json:"id"`
+	UserID      int        `json:"user_id"`
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	Completed   bool       `json:"completed"`
+	Priority    int        `json:"priority" binding:"min=0,max=3"`
+	DueAt       *time.Time `json:"due_at"`
+	Tags        []string   `json:"tags" binding:"max=20,dive,max=64"`
+	ParentID    *int       `json:"parent_id"`
+	// ListID is the list holding the todo, if any. Subtasks are always in
+	// their parent's list, and POST /todos/:id/move changes it.
+	ListID *int `json:"list_id"`
+	// BlockedBy lists the todos that must be done first; Blocked is set
+	// while any of them is still open
+	BlockedBy []int `json:"blocked_by"`
+	Blocked   bool  `json:"blocked"`
+	// Recurrence is an iCalendar RRULE such as "FREQ=WEEKLY;BYDAY=MO",
+	// evaluated in the owner's timezone from OccurrenceAt. SeriesID and
+	// OccurrenceAt are set by the server.
+	Recurrence   string     `json:"recurrence" binding:"max=512"`
+	SeriesID     *int       `json:"series_id"`
+	OccurrenceAt *time.Time `json:"occurrence_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+	CompletedAt  *time.Time `json:"completed_at"`
+	// DeletedAt is set while the todo is in the trash
+	DeletedAt *time.Time `json:"deleted_at"`
+	// Version is incremented by every change and is the todo's ETag
+	Version int `json:"version"`
+}
+
+// TodoNode is a todo together with its subtasks, as returned by GET /todos/:id/subtree
+type TodoNode struct {
+	Todo
+	Children []*TodoNode `json:"children"`
+}
+
+// Blocker is the payload of POST /todos/:id/blockers
+type Blocker struct {
+	BlockedBy int `json:"blocked_by" binding:"required"`
 }
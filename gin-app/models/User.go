@@ -0,0 +1,49 @@
+package models
+
+// Account roles. Read-only accounts can read but not change todos, lists,
+// tags or webhooks; members can; admins can also manage accounts and read
+// every account's todos.
+const (
+	AccountReadOnly = "readonly"
+	AccountMember   = "member"
+	AccountAdmin    = "admin"
+)
+
+// User represents an account that owns To-Do items
+type User struct {
+	ID           int    `json:"id"`
+	TenantID     int    `json:"tenant_id"`
+	Email        string `json:"email"`
+	PasswordHash string `json:"-"`
+	// Timezone is an IANA zone name; recurring todos repeat on its wall clock
+	Timezone string `json:"timezone"`
+	Role     string `json:"role"`
+}
+
+// Credentials is the payload accepted by the register and login endpoints.
+// Tenant names the tenant of the account, the default one when empty. Only
+// the default tenant is open to registration; the accounts of others are
+// added by their admins.
+type Credentials struct {
+	Email    string `json:"email" binding:"required,email"`
+	Password string `json:"password" binding:"required,min=8,max=72"`
+	Tenant   string `json:"tenant,omitempty" binding:"max=63"`
+}
+
+// Profile is the payload of PUT /users/me
+type Profile struct {
+	Timezone string `json:"timezone" binding:"required,max=64"`
+}
+
+// UserRole is the payload of PUT /admin/users/:id
+type UserRole struct {
+	Role string `json:"role" binding:"required,oneof=readonly member admin"`
+}
+
+// NewUser is the payload of POST /admin/users, which adds an account to the
+// admin's tenant
+type NewUser struct {
+	Email    string `json:"email" binding:"required,email"`
+	Password string `json:"password" binding:"required,min=8,max=72"`
+	Role     string `json:"role,omitempty" binding:"omitempty,oneof=readonly member admin"`
+}
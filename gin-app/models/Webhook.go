@@ -0,0 +1,56 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Delivery states. A pending delivery is retried with backoff until it is
+// delivered or runs out of attempts and becomes dead.
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead"
+)
+
+// Webhook is a subscription that receives todo events by HTTP POST
+type Webhook struct {
+	ID     int      `json:"id"`
+	UserID int      `json:"user_id"`
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	// Secret signs every payload. It is only returned when the webhook is created.
+	Secret    string    `json:"secret,omitempty"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// WebhookInput is the payload of POST /webhooks and PUT /webhooks/:id. Events
+// may contain "*" for every event. An empty secret is generated on create and
+// left unchanged on update.
+type WebhookInput struct {
+	URL    string   `json:"url" binding:"required,url,max=2048"`
+	Events []string `json:"events" binding:"required,min=1,dive,oneof=* todo.created todo.updated todo.completed todo.deleted todo.restored"`
+	Secret string   `json:"secret" binding:"omitempty,min=16,max=128"`
+	Active *bool    `json:"active"`
+}
+
+// WebhookDelivery is one event queued for one webhook, with the outcome of
+// its latest attempt
+type WebhookDelivery struct {
+	ID             int             `json:"id"`
+	WebhookID      int             `json:"webhook_id"`
+	Event          string          `json:"event"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at"`
+	LastStatusCode *int            `json:"last_status_code"`
+	LastError      string          `json:"last_error"`
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+
+	// URL and Secret of the webhook, filled in for the dispatcher only
+	URL    string `json:"-"`
+	Secret string `json:"-"`
+}
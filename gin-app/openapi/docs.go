@@ -0,0 +1,182 @@
+package openapi
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"html/template"
+	"net/http"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/gin-gonic/gin"
+)
+
+//go:embed docs.html
+var docsHTML string
+
+var docsTemplate = template.Must(template.New("docs").Funcs(template.FuncMap{
+	"typeOf":      typeOf,
+	"constraints": constraints,
+	"lower":       strings.ToLower,
+	"required":    func(schema *openapi3.Schema, name string) bool { return slices.Contains(schema.Required, name) },
+	"public":      func(op *openapi3.Operation) bool { return op.Security != nil && len(*op.Security) == 0 },
+	"deref":       func(s *string) string { return *s },
+}).Parse(docsHTML))
+
+// methodOrder lists the methods of a path in the order they are shown
+var methodOrder = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+type docsOperation struct {
+	Method     string
+	Path       string
+	Operation  *openapi3.Operation
+	Parameters openapi3.Parameters
+}
+
+type docsTag struct {
+	Name       string
+	Operations []docsOperation
+}
+
+// Docs serves a reference page rendered from the document. It is self
+// contained, so it works without access to a CDN.
+func Docs(doc *openapi3.T) gin.HandlerFunc {
+	var body bytes.Buffer
+	err := docsTemplate.Execute(&body, gin.H{
+		"Info":    doc.Info,
+		"Tags":    docsTags(doc),
+		"Schemas": doc.Components.Schemas,
+	})
+	return func(c *gin.Context) {
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.Data(http.StatusOK, "text/html; charset=utf-8", body.Bytes())
+	}
+}
+
+// docsTags groups the operations by their first tag, in the order the
+// document lists its tags
+func docsTags(doc *openapi3.T) []docsTag {
+	tags := make([]docsTag, len(doc.Tags))
+	index := map[string]int{}
+	for i, tag := range doc.Tags {
+		tags[i].Name = tag.Name
+		index[tag.Name] = i
+	}
+
+	paths := doc.Paths.Map()
+	for _, p := range sortedKeys(paths) {
+		item := paths[p]
+		for _, method := range methodOrder {
+			operation := item.GetOperation(method)
+			if operation == nil {
+				continue
+			}
+			i, ok := 0, false
+			if len(operation.Tags) > 0 {
+				i, ok = index[operation.Tags[0]]
+			}
+			if !ok {
+				i = len(tags)
+				tags = append(tags, docsTag{Name: "other"})
+				index["other"] = i
+			}
+			tags[i].Operations = append(tags[i].Operations, docsOperation{
+				Method:     method,
+				Path:       p,
+				Operation:  operation,
+				Parameters: append(append(openapi3.Parameters{}, item.Parameters...), operation.Parameters...),
+			})
+		}
+	}
+	return tags
+}
+
+// typeOf describes the type of a schema, linking to components
+func typeOf(ref *openapi3.SchemaRef) template.HTML {
+	if ref == nil {
+		return "any"
+	}
+	if ref.Ref != "" {
+		name := template.HTMLEscapeString(path.Base(ref.Ref))
+		return template.HTML(fmt.Sprintf(`<a href="#schema-%s">%s</a>`, name, name))
+	}
+
+	schema := ref.Value
+	var desc template.HTML
+	switch {
+	case len(schema.AllOf) == 1:
+		desc = typeOf(schema.AllOf[0])
+	case schema.Type.Is(openapi3.TypeArray):
+		desc = "array of " + typeOf(schema.Items)
+	case schema.Type.Is(openapi3.TypeObject) && schema.AdditionalProperties.Schema != nil:
+		desc = "map of " + typeOf(schema.AdditionalProperties.Schema)
+	case schema.Type == nil || len(schema.Type.Slice()) == 0:
+		desc = "any"
+	default:
+		desc = template.HTML(template.HTMLEscapeString(strings.Join(schema.Type.Slice(), " or ")))
+		if schema.Format != "" {
+			desc += template.HTML(" (" + template.HTMLEscapeString(schema.Format) + ")")
+		}
+	}
+	if schema.Nullable {
+		desc += " or null"
+	}
+	return desc
+}
+
+// constraints summarizes the limits a schema puts on values
+func constraints(ref *openapi3.SchemaRef) string {
+	if ref == nil || ref.Ref != "" || ref.Value == nil {
+		return ""
+	}
+	schema := ref.Value
+	var parts []string
+	if len(schema.Enum) > 0 {
+		values := make([]string, len(schema.Enum))
+		for i, v := range schema.Enum {
+			values[i] = fmt.Sprintf("%q", v)
+		}
+		parts = append(parts, "one of "+strings.Join(values, ", "))
+	}
+	if schema.Min != nil {
+		parts = append(parts, fmt.Sprintf("at least %v", *schema.Min))
+	}
+	if schema.Max != nil {
+		parts = append(parts, fmt.Sprintf("at most %v", *schema.Max))
+	}
+	if schema.MinLength > 0 {
+		parts = append(parts, fmt.Sprintf("at least %d characters", schema.MinLength))
+	}
+	if schema.MaxLength != nil {
+		parts = append(parts, fmt.Sprintf("at most %d characters", *schema.MaxLength))
+	}
+	if schema.MinItems > 0 {
+		parts = append(parts, fmt.Sprintf("at least %d items", schema.MinItems))
+	}
+	if schema.MaxItems != nil {
+		parts = append(parts, fmt.Sprintf("at most %d items", *schema.MaxItems))
+	}
+	if schema.Default != nil {
+		parts = append(parts, fmt.Sprintf("default %v", schema.Default))
+	}
+	if items := constraints(schema.Items); items != "" {
+		parts = append(parts, "items "+items)
+	}
+	return strings.Join(parts, "; ")
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
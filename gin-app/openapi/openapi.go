@@ -0,0 +1,90 @@
+// Package openapi describes the API as an OpenAPI 3 document, serves it with
+// a docs page and validates requests against it.
+package openapi
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+
+	"gin-app/models"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/gin-gonic/gin"
+	"github.com/invopop/yaml"
+)
+
+// openapi.yaml describes the operations; the schemas of the models are
+// generated from their Go types, so the two cannot drift apart
+//
+//go:embed openapi.yaml
+var operations []byte
+
+// documented lists the models whose schemas the operations refer to. Models
+// they contain, such as BatchOperation, are added along with them.
+var documented = []interface{}{
+	models.User{},
+	models.Credentials{},
+	models.Profile{},
+	models.UserRole{},
+	models.NewUser{},
+	models.Tenant{},
+	models.TenantInput{},
+	models.Todo{},
+	models.TodoNode{},
+	models.Blocker{},
+	models.Batch{},
+	models.BatchResult{},
+	models.ImportRow{},
+	models.HistoryEntry{},
+	models.Revert{},
+	models.Tag{},
+	models.TagRename{},
+	models.TagMerge{},
+	models.Webhook{},
+	models.WebhookInput{},
+	models.WebhookDelivery{},
+	models.List{},
+	models.ListInput{},
+	models.ListMember{},
+	models.MemberRole{},
+	models.ListInvite{},
+	models.Invitation{},
+	models.Move{},
+}
+
+// Load builds and checks the OpenAPI document
+func Load() (*openapi3.T, error) {
+	doc := &openapi3.T{}
+	if err := yaml.Unmarshal(operations, doc); err != nil {
+		return nil, fmt.Errorf("openapi.yaml: %w", err)
+	}
+
+	g := generator{schemas: doc.Components.Schemas}
+	for _, model := range documented {
+		g.component(reflect.TypeOf(model))
+	}
+
+	if err := openapi3.NewLoader().ResolveRefsIn(doc, nil); err != nil {
+		return nil, err
+	}
+	if err := doc.Validate(context.Background()); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// Spec serves the document as JSON
+func Spec(doc *openapi3.T) gin.HandlerFunc {
+	body, err := json.Marshal(doc)
+	return func(c *gin.Context) {
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.Data(http.StatusOK, "application/json; charset=utf-8", body)
+	}
+}
@@ -0,0 +1,164 @@
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+// generator builds component schemas from Go structs, following their json
+// tags and reading constraints from the binding tags gin validates
+type generator struct {
+	schemas openapi3.Schemas
+}
+
+// component adds the schema of a struct to the components, named after the
+// type, and returns a reference to it
+func (g *generator) component(t reflect.Type) *openapi3.SchemaRef {
+	name := t.Name()
+	if _, ok := g.schemas[name]; !ok {
+		// Registered before its fields are read, so that types such as
+		// TodoNode can refer to themselves
+		ref := &openapi3.SchemaRef{}
+		g.schemas[name] = ref
+		ref.Value = openapi3.NewObjectSchema()
+		g.addFields(ref.Value, t)
+	}
+	return openapi3.NewSchemaRef("#/components/schemas/"+name, nil)
+}
+
+// addFields adds the JSON fields of a struct to schema. Embedded structs
+// without a JSON name add theirs, as encoding/json flattens them.
+func (g *generator) addFields(schema *openapi3.Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if !field.IsExported() || name == "-" {
+			continue
+		}
+		if field.Anonymous && name == "" {
+			g.addFields(schema, field.Type)
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		prop := g.schema(field.Type)
+		if constrain(prop, strings.Split(field.Tag.Get("binding"), ",")) {
+			schema.Required = append(schema.Required, name)
+		}
+		schema.Properties[name] = prop
+	}
+}
+
+// schema returns the schema of a Go type. Pointers, slices and maps may be
+// null, as they encode to null when nil.
+func (g *generator) schema(t reflect.Type) *openapi3.SchemaRef {
+	switch {
+	case t == timeType:
+		return openapi3.NewDateTimeSchema().NewRef()
+	case t == rawMessageType:
+		// Any JSON value
+		return openapi3.NewSchema().NewRef()
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		elem := g.schema(t.Elem())
+		if elem.Ref != "" {
+			// Siblings of $ref are ignored, so the reference is wrapped
+			return (&openapi3.Schema{Nullable: true, AllOf: openapi3.SchemaRefs{elem}}).NewRef()
+		}
+		elem.Value.Nullable = true
+		return elem
+	case reflect.Struct:
+		return g.component(t)
+	case reflect.Slice:
+		schema := openapi3.NewArraySchema().WithNullable()
+		schema.Items = g.schema(t.Elem())
+		return schema.NewRef()
+	case reflect.Map:
+		schema := openapi3.NewObjectSchema().WithNullable()
+		schema.AdditionalProperties = openapi3.AdditionalProperties{Schema: g.schema(t.Elem())}
+		return schema.NewRef()
+	case reflect.Bool:
+		return openapi3.NewBoolSchema().NewRef()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return openapi3.NewIntegerSchema().NewRef()
+	case reflect.Float32, reflect.Float64:
+		return openapi3.NewFloat64Schema().NewRef()
+	default:
+		return openapi3.NewStringSchema().NewRef()
+	}
+}
+
+// constrain applies gin binding rules to the schema of a field and reports
+// whether the field is required. Rules after dive apply to the items of an
+// array. With omitempty the zero value passes any rule, so minimums are left
+// out and enums list it.
+func constrain(ref *openapi3.SchemaRef, rules []string) bool {
+	schema := ref.Value
+	if schema == nil {
+		return false
+	}
+
+	required, omitempty := false, false
+	for i, rule := range rules {
+		name, arg, _ := strings.Cut(rule, "=")
+		switch name {
+		case "required":
+			required = true
+		case "omitempty":
+			omitempty = true
+		case "dive":
+			if schema.Items != nil {
+				constrain(schema.Items, rules[i+1:])
+			}
+			return required
+		case "min":
+			if n, err := strconv.ParseUint(arg, 10, 64); err == nil && !omitempty {
+				switch {
+				case schema.Type.Is(openapi3.TypeString):
+					schema.MinLength = n
+				case schema.Type.Is(openapi3.TypeArray):
+					schema.MinItems = n
+				default:
+					schema.Min = openapi3.Float64Ptr(float64(n))
+				}
+			}
+		case "max":
+			if n, err := strconv.ParseUint(arg, 10, 64); err == nil {
+				switch {
+				case schema.Type.Is(openapi3.TypeString):
+					schema.MaxLength = openapi3.Uint64Ptr(n)
+				case schema.Type.Is(openapi3.TypeArray):
+					schema.MaxItems = openapi3.Uint64Ptr(n)
+				default:
+					schema.Max = openapi3.Float64Ptr(float64(n))
+				}
+			}
+		case "oneof":
+			if omitempty {
+				schema.Enum = append(schema.Enum, "")
+			}
+			for _, value := range strings.Fields(arg) {
+				schema.Enum = append(schema.Enum, value)
+			}
+		case "email":
+			schema.Format = "email"
+		case "url":
+			schema.Format = "uri"
+		}
+	}
+	return required
+}
@@ -0,0 +1,150 @@
+package openapi
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/gin-gonic/gin"
+)
+
+// Validator checks the query parameters and JSON body of a request against
+// the operation of the route it matched, before the handler sees it.
+// Requests that fail get a 400, or a 415 for a body of the wrong type.
+// Routes missing from the document pass unchecked.
+func Validator(doc *openapi3.T) gin.HandlerFunc {
+	options := &openapi3filter.Options{
+		// AuthMiddleware checks tokens, and handlers apply their own defaults
+		AuthenticationFunc:  openapi3filter.NoopAuthenticationFunc,
+		SkipSettingDefaults: true,
+	}
+	bodyless := &openapi3filter.Options{
+		AuthenticationFunc:  openapi3filter.NoopAuthenticationFunc,
+		SkipSettingDefaults: true,
+		ExcludeRequestBody:  true,
+	}
+
+	return func(c *gin.Context) {
+		path := specPath(c)
+		item := doc.Paths.Value(path)
+		if item == nil {
+			c.Next()
+			return
+		}
+		operation := item.GetOperation(c.Request.Method)
+		if operation == nil {
+			c.Next()
+			return
+		}
+
+		input := &openapi3filter.RequestValidationInput{
+			Request:    c.Request,
+			PathParams: map[string]string{},
+			Route: &routers.Route{
+				Spec:      doc,
+				Path:      path,
+				PathItem:  item,
+				Method:    c.Request.Method,
+				Operation: operation,
+			},
+			Options: options,
+		}
+		for _, param := range c.Params {
+			input.PathParams[param.Key] = param.Value
+		}
+		// Bodies without a schema, such as imported files, are left to the
+		// handler, which limits their size
+		if !hasBodySchema(operation) {
+			input.Options = bodyless
+		}
+		// Clients often leave out the type of JSON bodies, which handlers
+		// accept anyway
+		if c.GetHeader("Content-Type") == "" && c.Request.ContentLength != 0 {
+			c.Request.Header.Set("Content-Type", "application/json")
+		}
+
+		if err := openapi3filter.ValidateRequest(c.Request.Context(), input); err != nil {
+			status, message := validationError(err)
+			c.JSON(status, gin.H{"error": message})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// specPath returns the path in the document of the route a request matched.
+// Parameters that make up a whole segment become templates such as {id};
+// others, like the custom method of /todos:method, take their value from
+// the request, since each custom method is an operation of its own.
+func specPath(c *gin.Context) string {
+	route := c.FullPath()
+	var b strings.Builder
+	for i := 0; i < len(route); i++ {
+		if route[i] != ':' && route[i] != '*' {
+			b.WriteByte(route[i])
+			continue
+		}
+		end := i + 1
+		for end < len(route) && route[end] != '/' {
+			end++
+		}
+		name := route[i+1 : end]
+		if i > 0 && route[i-1] == '/' {
+			b.WriteString("{" + name + "}")
+		} else {
+			b.WriteString(c.Param(name))
+		}
+		i = end - 1
+	}
+	return b.String()
+}
+
+func hasBodySchema(operation *openapi3.Operation) bool {
+	if operation.RequestBody == nil || operation.RequestBody.Value == nil {
+		return false
+	}
+	for _, media := range operation.RequestBody.Value.Content {
+		if media.Schema != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// validationError turns a validation failure into a status and a message
+// naming the parameter or body field at fault
+func validationError(err error) (int, string) {
+	var requestErr *openapi3filter.RequestError
+	if !errors.As(err, &requestErr) {
+		return http.StatusBadRequest, err.Error()
+	}
+
+	reason := requestErr.Reason
+	var schemaErr *openapi3.SchemaError
+	switch {
+	case errors.As(requestErr.Err, &schemaErr):
+		reason = schemaErr.Reason
+		if pointer := schemaErr.JSONPointer(); len(pointer) > 0 {
+			reason = strings.Join(pointer, ".") + ": " + reason
+		}
+	case requestErr.Err != nil && reason == "":
+		reason = requestErr.Err.Error()
+	case requestErr.Err != nil:
+		reason += ": " + requestErr.Err.Error()
+	}
+
+	switch {
+	case requestErr.Parameter != nil:
+		return http.StatusBadRequest, fmt.Sprintf("%s parameter %s: %s", requestErr.Parameter.In, requestErr.Parameter.Name, reason)
+	case requestErr.RequestBody != nil && strings.HasPrefix(reason, "header Content-Type"):
+		return http.StatusUnsupportedMediaType, "Content-Type must be application/json"
+	case requestErr.RequestBody != nil:
+		return http.StatusBadRequest, "request body: " + reason
+	}
+	return http.StatusBadRequest, reason
+}
@@ -0,0 +1,73 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// clock is a time that tests move by hand
+type clock struct{ t time.Time }
+
+func (c *clock) now() time.Time          { return c.t }
+func (c *clock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func TestMemoryStoreBucket(t *testing.T) {
+	ctx := context.Background()
+	c := &clock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	s := NewMemoryStore()
+	s.now = c.now
+	// One token a second, up to three
+	limit := Limit{Requests: 3, Period: 3 * time.Second}
+	take := func(key string, want Result) {
+		t.Helper()
+		got, err := s.Take(ctx, key, limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("took from %s at %v: got %+v, want %+v", key, c.t.Format(time.TimeOnly+".000"), got, want)
+		}
+	}
+
+	// A new bucket is full, and its burst is the whole limit
+	take("a", Result{Allowed: true, Remaining: 2, Reset: time.Second})
+	take("a", Result{Allowed: true, Remaining: 1, Reset: 2 * time.Second})
+	take("a", Result{Allowed: true, Remaining: 0, RetryAfter: time.Second, Reset: 3 * time.Second})
+	take("a", Result{Allowed: false, Remaining: 0, RetryAfter: time.Second, Reset: 3 * time.Second})
+	take("b", Result{Allowed: true, Remaining: 2, Reset: time.Second})
+
+	// The next token is whole after a second, and not a millisecond before
+	c.advance(999 * time.Millisecond)
+	take("a", Result{Allowed: false, Remaining: 0, RetryAfter: time.Millisecond, Reset: 2001 * time.Millisecond})
+	c.advance(time.Millisecond)
+	take("a", Result{Allowed: true, Remaining: 0, RetryAfter: time.Second, Reset: 3 * time.Second})
+
+	// Refills stop at the limit, and a clock going back adds nothing
+	c.advance(time.Hour)
+	take("a", Result{Allowed: true, Remaining: 2, Reset: time.Second})
+	c.advance(-time.Minute)
+	take("a", Result{Allowed: true, Remaining: 1, Reset: 2 * time.Second})
+}
+
+func TestMemoryStoreSweep(t *testing.T) {
+	ctx := context.Background()
+	c := &clock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	s := NewMemoryStore()
+	s.now = c.now
+	limit := Limit{Requests: 1, Period: time.Minute}
+
+	s.Take(ctx, "idle", limit)
+	c.advance(time.Minute)
+	s.Take(ctx, "recent", limit)
+	c.advance(time.Second)
+	if err := s.Sweep(ctx, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.buckets["idle"]; ok {
+		t.Error("idle bucket kept")
+	}
+	if _, ok := s.buckets["recent"]; !ok {
+		t.Error("recent bucket swept")
+	}
+}
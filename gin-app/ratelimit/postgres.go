@@ -0,0 +1,57 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// PostgresStore keeps buckets in the rate_limit_buckets table, so that every
+// instance using the database draws from the same buckets. Times come from
+// the database clock, which all instances share.
+type PostgresStore struct {
+	db *sql.DB
+}
+
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+// takeSQL refills and takes from a bucket in one statement, which holds the
+// row lock throughout. When the bucket has no token the WHERE clause skips
+// the update and no row is returned.
+const takeSQL = `
+INSERT INTO rate_limit_buckets AS b (key, tokens, updated_at)
+VALUES ($1, $2::float8 - 1, now())
+ON CONFLICT (key) DO UPDATE
+SET tokens = LEAST($2::float8, b.tokens + $3::float8 * GREATEST(EXTRACT(EPOCH FROM now() - b.updated_at)::float8, 0)) - 1,
+	updated_at = now()
+WHERE LEAST($2::float8, b.tokens + $3::float8 * GREATEST(EXTRACT(EPOCH FROM now() - b.updated_at)::float8, 0)) >= 1
+RETURNING tokens`
+
+// peekSQL returns the tokens a bucket has now, without changing it
+const peekSQL = `
+SELECT LEAST($2::float8, tokens + $3::float8 * GREATEST(EXTRACT(EPOCH FROM now() - updated_at)::float8, 0))
+FROM rate_limit_buckets WHERE key = $1`
+
+func (s *PostgresStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	var tokens float64
+	err := s.db.QueryRowContext(ctx, takeSQL, key, limit.Requests, limit.rate()).Scan(&tokens)
+	if err == nil {
+		return limit.result(tokens, true), nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return Result{}, err
+	}
+
+	if err := s.db.QueryRowContext(ctx, peekSQL, key, limit.Requests, limit.rate()).Scan(&tokens); err != nil {
+		return Result{}, err
+	}
+	return limit.result(tokens, false), nil
+}
+
+func (s *PostgresStore) Sweep(ctx context.Context, idle time.Duration) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM rate_limit_buckets WHERE updated_at < now() - make_interval(secs => $1)`, idle.Seconds())
+	return err
+}
@@ -0,0 +1,90 @@
+package ratelimit_test
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"gin-app/config"
+	"gin-app/database"
+	"gin-app/ratelimit"
+)
+
+// TestPostgresStore needs the Postgres database of the tests, as for the
+// database package
+func TestPostgresStore(t *testing.T) {
+	url, workerURL := os.Getenv("TODO_TEST_DATABASE_URL"), os.Getenv("TODO_TEST_DATABASE_WORKER_URL")
+	if url == "" || workerURL == "" {
+		t.Skip("TODO_TEST_DATABASE_URL and TODO_TEST_DATABASE_WORKER_URL are not set")
+	}
+	if err := database.InitDB(config.DatabaseConfig{Driver: database.DialectPostgres, URL: url, WorkerURL: workerURL}); err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+	if err := database.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	s := ratelimit.NewPostgresStore(database.GetDB())
+	key := "test:" + strconv.FormatInt(time.Now().UnixNano(), 36)
+	t.Cleanup(func() {
+		database.GetDB().ExecContext(ctx, "DELETE FROM rate_limit_buckets WHERE key LIKE $1", key+"%")
+	})
+
+	// A new bucket is full; the burst spends it and the next take waits for
+	// a refill of about 20 minutes
+	limit := ratelimit.Limit{Requests: 3, Period: time.Hour}
+	for i := 2; i >= 0; i-- {
+		res, err := s.Take(ctx, key, limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !res.Allowed || res.Remaining != i {
+			t.Fatalf("take %d: %+v", 3-i, res)
+		}
+	}
+	res, err := s.Take(ctx, key, limit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Allowed || res.RetryAfter < 19*time.Minute || res.RetryAfter > 20*time.Minute {
+		t.Errorf("take from an empty bucket: %+v", res)
+	}
+
+	// Concurrent takes from one bucket never spend more than it holds
+	key += ":concurrent"
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	allowed := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := s.Take(ctx, key, ratelimit.Limit{Requests: 5, Period: time.Hour})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if res.Allowed {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if allowed != 5 {
+		t.Errorf("%d concurrent takes allowed, want 5", allowed)
+	}
+
+	// Buckets used since are kept by a sweep
+	if err := s.Sweep(ctx, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if res, err := s.Take(ctx, key, ratelimit.Limit{Requests: 5, Period: time.Hour}); err != nil || res.Allowed {
+		t.Errorf("take after a sweep: %+v %v", res, err)
+	}
+}
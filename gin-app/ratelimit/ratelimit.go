@@ -0,0 +1,149 @@
+// Package ratelimit limits request rates with token buckets, kept in memory
+// or in Postgres so that instances sharing a database share their limits.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limit allows Requests per Period. A bucket holds up to Requests tokens and
+// refills steadily over Period, so a client that has been quiet may spend a
+// whole Period's worth at once. The zero Limit is no limit.
+type Limit struct {
+	Requests int
+	Period   time.Duration
+}
+
+// ParseLimit reads a limit written as requests per period, such as "100/1m"
+// or "100/m". An empty string is no limit.
+func ParseLimit(s string) (Limit, error) {
+	if s == "" {
+		return Limit{}, nil
+	}
+	requests, period, ok := strings.Cut(s, "/")
+	n, err := strconv.Atoi(requests)
+	if !ok || err != nil || n < 1 {
+		return Limit{}, fmt.Errorf("rate limit %q is not requests/period, such as 100/1m", s)
+	}
+	if period != "" && (period[0] < '0' || period[0] > '9') {
+		period = "1" + period
+	}
+	d, err := time.ParseDuration(period)
+	if err != nil || d <= 0 {
+		return Limit{}, fmt.Errorf("rate limit %q has an invalid period", s)
+	}
+	return Limit{Requests: n, Period: d}, nil
+}
+
+// UnmarshalText lets limits be read from configuration
+func (l *Limit) UnmarshalText(text []byte) error {
+	limit, err := ParseLimit(string(text))
+	if err != nil {
+		return err
+	}
+	*l = limit
+	return nil
+}
+
+func (l Limit) String() string {
+	if l.IsZero() {
+		return ""
+	}
+	period := l.Period.String()
+	if strings.HasSuffix(period, "m0s") {
+		period = strings.TrimSuffix(period, "0s")
+	}
+	if strings.HasSuffix(period, "h0m") {
+		period = strings.TrimSuffix(period, "0m")
+	}
+	return fmt.Sprintf("%d/%s", l.Requests, period)
+}
+
+func (l Limit) IsZero() bool {
+	return l.Requests == 0
+}
+
+// rate is the number of tokens added per second
+func (l Limit) rate() float64 {
+	return float64(l.Requests) / l.Period.Seconds()
+}
+
+// refill returns the tokens of a bucket that held tokens elapsed ago
+func (l Limit) refill(tokens float64, elapsed time.Duration) float64 {
+	return math.Min(float64(l.Requests), tokens+math.Max(elapsed.Seconds(), 0)*l.rate())
+}
+
+// Result is the state of a bucket after a request tried to take a token
+type Result struct {
+	Allowed bool
+	// Remaining is the number of whole tokens left
+	Remaining int
+	// RetryAfter is how long until a token is available again
+	RetryAfter time.Duration
+	// Reset is how long until the bucket is full again
+	Reset time.Duration
+}
+
+// result describes a bucket left with tokens
+func (l Limit) result(tokens float64, allowed bool) Result {
+	seconds := func(s float64) time.Duration { return time.Duration(s * float64(time.Second)) }
+	res := Result{
+		Allowed:   allowed,
+		Remaining: int(tokens),
+		Reset:     seconds((float64(l.Requests) - tokens) / l.rate()),
+	}
+	if tokens < 1 {
+		res.RetryAfter = seconds((1 - tokens) / l.rate())
+	}
+	return res
+}
+
+// Store keeps token buckets by key
+type Store interface {
+	// Take removes a token from the bucket, if it has one, after refilling
+	// it for the time since it was last used. New buckets start full.
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+	// Sweep forgets buckets unused for longer than idle. A bucket unused for
+	// a whole period is full, just like a new one.
+	Sweep(ctx context.Context, idle time.Duration) error
+}
+
+// sweepInterval is how often idle buckets are forgotten
+const sweepInterval = time.Minute
+
+// Sweeper keeps a store from growing with the buckets of past clients
+type Sweeper struct {
+	Store Store
+	// Idle is the longest period of the limits in use
+	Idle time.Duration
+}
+
+func NewSweeper(store Store, idle time.Duration) *Sweeper {
+	return &Sweeper{Store: store, Idle: idle}
+}
+
+// Run sweeps the store every minute until ctx is cancelled
+func (s *Sweeper) Run(ctx context.Context) {
+	if s.Idle == 0 {
+		return
+	}
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := s.Store.Sweep(ctx, s.Idle); err != nil && ctx.Err() == nil {
+			slog.Error("Error sweeping rate limit buckets", "error", err)
+		}
+	}
+}
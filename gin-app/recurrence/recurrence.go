@@ -0,0 +1,59 @@
+// Package recurrence expands the iCalendar RRULEs of recurring todos and
+// materializes their occurrences ahead of time.
+package recurrence
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/teambition/rrule-go"
+
+	// Embed the zone database so owner timezones resolve on hosts without one
+	_ "time/tzdata"
+)
+
+// Parse builds the rule of a recurring todo. start is the occurrence the rule
+// counts from; it is moved to loc so that the rule repeats on the owner's
+// wall clock across daylight saving changes.
+func Parse(rule string, start time.Time, loc *time.Location) (*rrule.RRule, error) {
+	if strings.ContainsAny(rule, "\r\n") {
+		return nil, errors.New("recurrence must be a single RRULE")
+	}
+
+	opts, err := rrule.StrToROptionInLocation(strings.TrimPrefix(rule, "RRULE:"), loc)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recurrence: %w", err)
+	}
+	switch {
+	case opts.Freq == rrule.MINUTELY || opts.Freq == rrule.SECONDLY:
+		return nil, errors.New("recurrence must not repeat more often than hourly")
+	case opts.Count > 0:
+		// Occurrences are counted from the latest one, so COUNT would restart
+		return nil, errors.New("recurrence must use UNTIL instead of COUNT")
+	case !opts.Dtstart.IsZero():
+		return nil, errors.New("recurrence must not set DTSTART; due_at is the first occurrence")
+	}
+
+	opts.Dtstart = start.In(loc)
+	return rrule.NewRRule(*opts)
+}
+
+// Validate reports whether rule is a recurrence the scheduler accepts
+func Validate(rule string) error {
+	_, err := Parse(rule, time.Now(), time.UTC)
+	return err
+}
+
+// Location resolves an IANA timezone name, treating an empty name as UTC
+func Location(name string) (*time.Location, error) {
+	switch name {
+	case "":
+		return time.UTC, nil
+	case "Local":
+		// The server's zone says nothing about the owner's
+		return nil, errors.New("unknown time zone Local")
+	}
+	return time.LoadLocation(name)
+}
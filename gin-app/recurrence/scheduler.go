@@ -0,0 +1,134 @@
+package recurrence
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"gin-app/audit"
+	"gin-app/config"
+	"gin-app/events"
+	"gin-app/models"
+	"gin-app/repository"
+	"gin-app/tenant"
+)
+
+// maxPerRun caps the occurrences created for one series in one pass
+const maxPerRun = 100
+
+// Scheduler keeps every recurring series materialized up to Horizon ahead.
+// Occurrences are unique per series and time in the store, so any number of
+// schedulers, restarts included, never create one twice. Each occurrence is
+// announced and recorded in its history like a todo created through the API,
+// with the owner of the series as the actor.
+type Scheduler struct {
+	Todos    repository.TodoRepository
+	Users    repository.UserRepository
+	Events   *events.Bus
+	Interval time.Duration
+	Horizon  time.Duration
+}
+
+func NewScheduler(store *repository.Store, bus *events.Bus, cfg config.SchedulerConfig) *Scheduler {
+	return &Scheduler{Todos: store.Todos, Users: store.Users, Events: bus, Interval: cfg.Interval, Horizon: cfg.Horizon}
+}
+
+// Run materializes all series every Interval until ctx is cancelled
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.MaterializeAll(ctx); err != nil {
+			slog.Error("Error materializing recurring todos", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// MaterializeAll extends every active series. A series whose rule or owner
+// timezone no longer parses is logged and skipped.
+func (s *Scheduler) MaterializeAll(ctx context.Context) error {
+	latest, err := s.Todos.LatestOccurrences(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, todo := range latest {
+		if err := s.extend(ctx, todo, now); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			slog.Error("Error materializing series", "series_id", *todo.SeriesID, "error", err)
+		}
+	}
+	return nil
+}
+
+// Advance brings the series of todo up to date after it was created or
+// changed. Completing the latest occurrence always yields the next one, even
+// beyond the horizon.
+func (s *Scheduler) Advance(ctx context.Context, todo models.Todo) error {
+	if todo.SeriesID == nil {
+		return nil
+	}
+	latest, err := s.Todos.LatestOccurrence(ctx, todo.UserID, *todo.SeriesID)
+	if err != nil {
+		return err
+	}
+	return s.extend(ctx, latest, time.Now())
+}
+
+// extend creates the occurrences that follow latest up to the horizon. Of the
+// occurrences already in the past, such as those missed while the server was
+// down, only the most recent is created.
+func (s *Scheduler) extend(ctx context.Context, latest models.Todo, now time.Time) error {
+	if latest.Recurrence == "" || latest.OccurrenceAt == nil {
+		return nil
+	}
+
+	user, err := s.Users.Get(ctx, latest.UserID)
+	if err != nil {
+		return err
+	}
+	// Workers act for every tenant, but the occurrence belongs to the owner's
+	// and is recorded as made by them
+	ctx = audit.WithActor(tenant.With(ctx, user.TenantID), user.ID)
+	loc, err := Location(user.Timezone)
+	if err != nil {
+		return err
+	}
+	rule, err := Parse(latest.Recurrence, *latest.OccurrenceAt, loc)
+	if err != nil {
+		return err
+	}
+
+	times := rule.Between(*latest.OccurrenceAt, now.Add(s.Horizon), false)
+	for len(times) > 1 && times[1].Before(now) {
+		times = times[1:]
+	}
+	if len(times) == 0 && latest.Completed {
+		if next := rule.After(*latest.OccurrenceAt, false); !next.IsZero() {
+			times = append(times, next)
+		}
+	}
+	if len(times) > maxPerRun {
+		times = times[:maxPerRun]
+	}
+
+	for _, at := range times {
+		todo, created, err := s.Todos.CreateOccurrence(ctx, latest, at)
+		if err != nil {
+			return err
+		}
+		if created {
+			s.Events.Publish(ctx, events.New(events.TodoCreated, todo))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package recurrence
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gin-app/config"
+	"gin-app/events"
+	"gin-app/models"
+	"gin-app/repository"
+	"gin-app/tenant"
+)
+
+func TestOccurrencesAnnouncedAndRecorded(t *testing.T) {
+	ctx := tenant.With(context.Background(), tenant.Default)
+	store := repository.NewMemory()
+	user := models.User{TenantID: tenant.Default, Email: "user@example.com", Timezone: "UTC"}
+	if err := store.Users.Create(ctx, &user); err != nil {
+		t.Fatal(err)
+	}
+	due := time.Now().Add(time.Hour)
+	todo := models.Todo{UserID: user.ID, Title: "Water plants", DueAt: &due, Recurrence: "FREQ=DAILY"}
+	if err := store.Todos.Create(ctx, &todo); err != nil {
+		t.Fatal(err)
+	}
+
+	bus := events.NewBus()
+	var created []events.Event
+	bus.Subscribe(func(ctx context.Context, event events.Event) error {
+		created = append(created, event)
+		return nil
+	})
+	s := NewScheduler(store, bus, config.SchedulerConfig{Interval: time.Minute, Horizon: 3 * 24 * time.Hour})
+	if err := s.Advance(ctx, todo); err != nil {
+		t.Fatal(err)
+	}
+	// The occurrences a day and two days after the first fall within the
+	// horizon; running again creates nothing more
+	if err := s.MaterializeAll(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(created) != 2 {
+		t.Fatalf("got %d events, want 2", len(created))
+	}
+	for _, event := range created {
+		if event.Type != events.TodoCreated || event.Todo.ID == todo.ID || *event.Todo.SeriesID != *todo.SeriesID {
+			t.Errorf("event %s for todo %+v", event.Type, event.Todo)
+		}
+		history, err := store.History.List(ctx, user.ID, event.Todo.ID, 0, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(history) != 1 || history[0].Operation != models.HistoryCreate || history[0].ActorID != user.ID {
+			t.Errorf("history of todo %d: %+v", event.Todo.ID, history)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package repository
+
+import "fmt"
+
+// maxInsertRows bounds the rows of one multi-row INSERT, keeping its
+// parameters well within what either engine accepts: SQLite takes up to
+// 32766 and Postgres 65535
+const maxInsertRows = 500
+
+// maxInListIDs bounds the IDs of one IN list in the same way
+const maxInListIDs = 1000
+
+// resolve returns op with its references to earlier operations replaced by
+// the IDs of the todos they created. A reference to an operation that failed
+// or created nothing is ErrInvalidReference.
+func resolve(op BatchOp, index int, results []BatchResult) (BatchOp, error) {
+	created := func(ref int) (int, error) {
+		if ref < 0 || ref >= index || results[ref].Err != nil || results[ref].Todo.ID == 0 {
+			return 0, ErrInvalidReference
+		}
+		return results[ref].Todo.ID, nil
+	}
+
+	var err error
+	if op.ParentOp != nil {
+		var parentID int
+		if parentID, err = created(*op.ParentOp); err != nil {
+			return op, err
+		}
+		op.Todo.ParentID = &parentID
+	}
+	if op.TodoOp != nil {
+		if op.Todo.ID, err = created(*op.TodoOp); err != nil {
+			return op, err
+		}
+	}
+	if op.BlockerOp != nil {
+		if op.BlockerID, err = created(*op.BlockerOp); err != nil {
+			return op, err
+		}
+	}
+
+	switch op.Op {
+	case BatchCreate, BatchUpdate, BatchDelete, BatchAddBlocker:
+		return op, nil
+	}
+	return op, fmt.Errorf("unknown batch operation %q", op.Op)
+}
+
+// owner returns the account op acts on in a batch of userID
+func (op BatchOp) owner(userID int) int {
+	if op.UserID != 0 {
+		return op.UserID
+	}
+	return userID
+}
+
+// createRun returns how many creates from ops[start] on can be inserted
+// together, which insert does in statements of up to maxInsertRows. A
+// subtask starts a run of its own unless its parent was created before the
+// run, since the parent may be created just before it.
+func createRun(ops []BatchOp, start int) int {
+	n := 0
+	for i := start; i < len(ops) && ops[i].Op == BatchCreate; i++ {
+		if n > 0 {
+			if ref := ops[i].ParentOp; ref != nil && *ref >= start {
+				break
+			}
+			if ops[i].ParentOp == nil && ops[i].Todo.ParentID != nil {
+				break
+			}
+		}
+		n++
+	}
+	return n
+}
@@ -0,0 +1,21 @@
+package repository
+
+import (
+	"context"
+
+	"gin-app/audit"
+	"gin-app/models"
+)
+
+// historyEntry returns the history entry of a change to a todo, made by the
+// actor of ctx in the same transaction as the change. It reports false for
+// changes made for no one, such as the retention job's purges, and for
+// writes that left the todo at the version it was.
+func historyEntry(ctx context.Context, operation string, before, after *models.Todo) (models.HistoryEntry, bool, error) {
+	actorID, ok := audit.Actor(ctx)
+	if !ok || (before != nil && after != nil && before.Version == after.Version) {
+		return models.HistoryEntry{}, false, nil
+	}
+	entry, err := audit.Entry(actorID, operation, before, after)
+	return entry, err == nil, err
+}
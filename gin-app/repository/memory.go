@@ -0,0 +1,1556 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"gin-app/events"
+	"gin-app/models"
+	"gin-app/tenant"
+)
+
+// NewMemory returns a Store that keeps everything in process memory.
+// Data is lost on restart; it is meant for tests and local development.
+func NewMemory() *Store {
+	data := &memoryData{
+		todos:    map[int]models.Todo{},
+		tags:     map[int]memoryTag{},
+		todoTags: map[int][]int{},
+		blockers: map[int][]int{},
+		lists:    map[int]models.List{},
+		members:  map[int]map[int]string{},
+		invites:  map[int]models.ListInvite{},
+		webhooks: &memoryWebhookRepository{webhooks: map[int]models.Webhook{}, deliveries: map[int]models.WebhookDelivery{}},
+	}
+	users := &memoryUserRepository{users: map[string]models.User{}}
+	return &Store{
+		Todos:    &memoryTodoRepository{data},
+		Tags:     &memoryTagRepository{data},
+		Users:    users,
+		Webhooks: data.webhooks,
+		History:  &memoryHistoryRepository{data},
+		Lists:    &memoryListRepository{memoryData: data, users: users},
+		Tenants:  &memoryTenantRepository{tenants: []models.Tenant{{ID: tenant.Default, Name: models.DefaultTenant, CreatedAt: time.Now().UTC()}}},
+	}
+}
+
+// memoryData is shared by the todo, tag, history and list repositories, which
+// all need the todos, under one lock
+type memoryData struct {
+	mu         sync.RWMutex
+	nextTodoID int
+	todos      map[int]models.Todo // Tags is left empty; see todoTags. Includes the trash.
+	nextTagID  int
+	tags       map[int]memoryTag
+	todoTags   map[int][]int         // todo ID -> tag IDs
+	blockers   map[int][]int         // todo ID -> IDs of the todos blocking it
+	history    []models.HistoryEntry // oldest first
+	nextListID int
+	lists      map[int]models.List    // Role is left empty
+	members    map[int]map[int]string // list ID -> user ID -> role, the owner left out
+	nextInvite int
+	invites    map[int]models.ListInvite
+	webhooks   *memoryWebhookRepository // queues the events of changes to todos
+}
+
+type memoryTag struct {
+	userID int
+	name   string
+}
+
+// withTags returns todo with its tag names and blockers filled in. Callers hold d.mu.
+func (d *memoryData) withTags(todo models.Todo) models.Todo {
+	todo.Tags = []string{}
+	for _, id := range d.todoTags[todo.ID] {
+		todo.Tags = append(todo.Tags, d.tags[id].name)
+	}
+	sort.Strings(todo.Tags)
+
+	todo.Blocked = false
+	todo.BlockedBy = []int{}
+	for _, id := range d.blockers[todo.ID] {
+		if blocker := d.todos[id]; blocker.DeletedAt == nil {
+			todo.BlockedBy = append(todo.BlockedBy, id)
+			todo.Blocked = todo.Blocked || !blocker.Completed
+		}
+	}
+	sort.Ints(todo.BlockedBy)
+	return todo
+}
+
+// setTags links todoID to the named tags, creating missing ones. Callers hold d.mu.
+func (d *memoryData) setTags(userID, todoID int, names []string) {
+	ids := []int{}
+	for _, name := range normalizeTags(names) {
+		id := d.tagID(userID, name)
+		if id == 0 {
+			d.nextTagID++
+			id = d.nextTagID
+			d.tags[id] = memoryTag{userID: userID, name: name}
+		}
+		ids = append(ids, id)
+	}
+	d.todoTags[todoID] = ids
+}
+
+func (d *memoryData) tagID(userID int, name string) int {
+	for id, tag := range d.tags {
+		if tag.userID == userID && tag.name == name {
+			return id
+		}
+	}
+	return 0
+}
+
+type memoryTodoRepository struct {
+	*memoryData
+}
+
+func (r *memoryTodoRepository) List(ctx context.Context, userID int, query TodoQuery) ([]models.Todo, bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	todos := []models.Todo{}
+	for _, todo := range r.todos {
+		if (todo.UserID != userID && !query.AllUsers) || todo.DeletedAt != nil {
+			continue
+		}
+		todo = r.withTags(todo)
+		if !matchesQuery(todo, query) {
+			continue
+		}
+		if query.After != nil {
+			c := compareTodos(query.Sort, CursorFor(todo), *query.After)
+			if (!query.Desc && c <= 0) || (query.Desc && c >= 0) {
+				continue
+			}
+		}
+		todos = append(todos, todo)
+	}
+
+	sort.Slice(todos, func(i, j int) bool {
+		c := compareTodos(query.Sort, CursorFor(todos[i]), CursorFor(todos[j]))
+		if query.Desc {
+			return c > 0
+		}
+		return c < 0
+	})
+	if len(todos) > query.Limit {
+		return todos[:query.Limit], true, nil
+	}
+	return todos, false, nil
+}
+
+func (r *memoryTodoRepository) Get(ctx context.Context, userID, id int) (models.Todo, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	todo, ok := r.live(userID, id)
+	if !ok {
+		return models.Todo{}, ErrNotFound
+	}
+	return r.withTags(todo), nil
+}
+
+func (r *memoryTodoRepository) Create(ctx context.Context, todo *models.Todo) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.create(ctx, todo)
+}
+
+// create stores a new todo. Callers hold r.mu.
+func (r *memoryTodoRepository) create(ctx context.Context, todo *models.Todo) error {
+	if err := r.checkParent(todo.UserID, 0, todo.ParentID); err != nil {
+		return err
+	}
+	if todo.ParentID != nil {
+		parentList := r.todos[*todo.ParentID].ListID
+		if todo.ListID == nil {
+			todo.ListID = parentList
+		} else if !sameList(todo.ListID, parentList) {
+			return ErrListMismatch
+		}
+	}
+	if todo.ListID != nil && !r.ownsList(todo.UserID, *todo.ListID) {
+		return ErrInvalidList
+	}
+
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	r.nextTodoID++
+	todo.ID = r.nextTodoID
+	todo.CreatedAt, todo.UpdatedAt = now, now
+	todo.Version = 1
+	todo.CompletedAt = nil
+	if todo.Completed {
+		todo.CompletedAt = &now
+	}
+	todo.DueAt = utc(todo.DueAt)
+	// A recurring todo starts its own series as the first occurrence
+	todo.SeriesID, todo.OccurrenceAt = nil, nil
+	if todo.Recurrence != "" {
+		seriesID := todo.ID
+		todo.SeriesID, todo.OccurrenceAt = &seriesID, todo.DueAt
+	}
+
+	r.setTags(todo.UserID, todo.ID, todo.Tags)
+	todo.Tags = nil
+	r.todos[todo.ID] = *todo
+	*todo = r.withTags(*todo)
+	return r.record(ctx, models.HistoryCreate, nil, todo)
+}
+
+func (r *memoryTodoRepository) Update(ctx context.Context, todo *models.Todo, opts UpdateOptions) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.update(ctx, todo, opts)
+}
+
+// update replaces a todo. Callers hold r.mu.
+func (r *memoryTodoRepository) update(ctx context.Context, todo *models.Todo, opts UpdateOptions) error {
+	existing, ok := r.live(todo.UserID, todo.ID)
+	if !ok {
+		return ErrNotFound
+	}
+	if opts.Version != 0 && existing.Version != opts.Version {
+		return ErrVersionConflict
+	}
+	if err := r.checkParent(todo.UserID, todo.ID, todo.ParentID); err != nil {
+		return err
+	}
+	if todo.ParentID != nil && !sameList(existing.ListID, r.todos[*todo.ParentID].ListID) {
+		return ErrListMismatch
+	}
+
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	if todo.Completed {
+		open := []int{}
+		for _, id := range r.descendants(todo.ID) {
+			if !r.todos[id].Completed {
+				open = append(open, id)
+			}
+		}
+		if len(open) > 0 && !opts.CompleteChildren {
+			return ErrOpenChildren
+		}
+		r.journal(ctx, models.HistoryUpdate, open, func() {
+			for _, id := range open {
+				child := r.todos[id]
+				child.Completed, child.CompletedAt, child.UpdatedAt = true, &now, now
+				child.Version++
+				r.todos[id] = child
+			}
+		})
+	}
+	todo.CreatedAt, todo.UpdatedAt = existing.CreatedAt, now
+	todo.Version = existing.Version + 1
+	todo.CompletedAt = nil
+	if todo.Completed {
+		todo.CompletedAt = existing.CompletedAt
+		if todo.CompletedAt == nil {
+			todo.CompletedAt = &now
+		}
+	}
+	todo.DueAt = utc(todo.DueAt)
+	todo.SeriesID, todo.OccurrenceAt = existing.SeriesID, existing.OccurrenceAt
+	todo.ListID = existing.ListID
+	if todo.SeriesID == nil && todo.Recurrence != "" {
+		seriesID := todo.ID
+		todo.SeriesID, todo.OccurrenceAt = &seriesID, todo.DueAt
+	}
+
+	r.setTags(todo.UserID, todo.ID, todo.Tags)
+	todo.Tags = nil
+	r.todos[todo.ID] = *todo
+	*todo = r.withTags(*todo)
+
+	operation := opts.Operation
+	if operation == "" {
+		operation = models.HistoryUpdate
+	}
+	before := r.withTags(existing)
+	return r.record(ctx, operation, &before, todo)
+}
+
+func (r *memoryTodoRepository) Delete(ctx context.Context, userID, id, version int) (models.Todo, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.delete(ctx, userID, id, version)
+}
+
+// delete moves a todo and its subtasks to the trash. Callers hold r.mu.
+func (r *memoryTodoRepository) delete(ctx context.Context, userID, id, version int) (models.Todo, error) {
+	todo, ok := r.live(userID, id)
+	if !ok {
+		return models.Todo{}, ErrNotFound
+	}
+	if version != 0 && todo.Version != version {
+		return models.Todo{}, ErrVersionConflict
+	}
+
+	// Subtasks share the parent's deleted_at, which is how Restore finds them
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	ids := append([]int{id}, r.descendants(id)...)
+	err := r.journal(ctx, models.HistoryDelete, ids, func() {
+		for _, id := range ids {
+			todo := r.todos[id]
+			todo.DeletedAt = &now
+			todo.Version++
+			r.todos[id] = todo
+		}
+	})
+	return r.withTags(r.todos[id]), err
+}
+
+func (r *memoryTodoRepository) Trash(ctx context.Context, userID int) ([]models.Todo, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	todos := []models.Todo{}
+	for _, todo := range r.todos {
+		if todo.UserID == userID && todo.DeletedAt != nil {
+			todos = append(todos, r.withTags(todo))
+		}
+	}
+	sort.Slice(todos, func(i, j int) bool {
+		if !todos[i].DeletedAt.Equal(*todos[j].DeletedAt) {
+			return todos[i].DeletedAt.After(*todos[j].DeletedAt)
+		}
+		return todos[i].ID > todos[j].ID
+	})
+	return todos, nil
+}
+
+func (r *memoryTodoRepository) GetDeleted(ctx context.Context, userID, id int) (models.Todo, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	todo, ok := r.todos[id]
+	if !ok || todo.UserID != userID || todo.DeletedAt == nil {
+		return models.Todo{}, ErrNotFound
+	}
+	return r.withTags(todo), nil
+}
+
+func (r *memoryTodoRepository) Restore(ctx context.Context, userID, id int) (models.Todo, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	todo, ok := r.todos[id]
+	if !ok || todo.UserID != userID || todo.DeletedAt == nil {
+		return models.Todo{}, ErrNotFound
+	}
+	if todo.ParentID != nil {
+		if _, ok := r.live(userID, *todo.ParentID); !ok {
+			return models.Todo{}, ErrParentTrashed
+		}
+	}
+
+	// Subtasks deleted on their own earlier stay in the trash
+	deletedAt := *todo.DeletedAt
+	sameDeletion := func(t models.Todo) bool { return t.DeletedAt != nil && t.DeletedAt.Equal(deletedAt) }
+	ids := append([]int{id}, r.subtree(id, sameDeletion)...)
+	err := r.journal(ctx, models.HistoryRestore, ids, func() {
+		for _, id := range ids {
+			todo := r.todos[id]
+			todo.DeletedAt = nil
+			todo.Version++
+			r.todos[id] = todo
+		}
+	})
+	return r.withTags(r.todos[id]), err
+}
+
+func (r *memoryTodoRepository) Purge(ctx context.Context, userID, id int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	todo, ok := r.todos[id]
+	if !ok || todo.UserID != userID || todo.DeletedAt == nil {
+		return ErrNotFound
+	}
+	// Every subtask of a todo in the trash is in the trash too
+	all := func(models.Todo) bool { return true }
+	ids := append([]int{id}, r.subtree(id, all)...)
+	return r.journal(ctx, models.HistoryPurge, ids, func() { r.purge(ids) })
+}
+
+func (r *memoryTodoRepository) EmptyTrash(ctx context.Context, userID int) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ids := []int{}
+	for id, todo := range r.todos {
+		if todo.UserID == userID && todo.DeletedAt != nil {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	return len(ids), r.journal(ctx, models.HistoryPurge, ids, func() { r.purge(ids) })
+}
+
+func (r *memoryTodoRepository) PurgeDeleted(ctx context.Context, before time.Time) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ids := []int{}
+	for id, todo := range r.todos {
+		if todo.DeletedAt != nil && todo.DeletedAt.Before(before) {
+			ids = append(ids, id)
+		}
+	}
+	r.purge(ids)
+	return len(ids), nil
+}
+
+func (r *memoryTodoRepository) Subtree(ctx context.Context, userID, id int) ([]models.Todo, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	todo, ok := r.live(userID, id)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	todos := []models.Todo{r.withTags(todo)}
+	for _, id := range r.descendants(id) {
+		todos = append(todos, r.withTags(r.todos[id]))
+	}
+	return todos, nil
+}
+
+func (r *memoryTodoRepository) AddBlocker(ctx context.Context, userID, id, blockerID int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.addBlocker(ctx, userID, id, blockerID)
+}
+
+// addBlocker makes blockerID block id. Callers hold r.mu.
+func (r *memoryTodoRepository) addBlocker(ctx context.Context, userID, id, blockerID int) error {
+	if _, ok := r.live(userID, id); !ok {
+		return ErrNotFound
+	}
+	if _, ok := r.live(userID, blockerID); !ok {
+		return ErrInvalidReference
+	}
+
+	// Walk what the blocker is itself blocked by; reaching id means the new
+	// link would close a loop
+	seen := map[int]bool{}
+	queue := []int{blockerID}
+	for len(queue) > 0 {
+		next := queue[0]
+		queue = queue[1:]
+		if next == id {
+			return ErrCycle
+		}
+		if !seen[next] {
+			seen[next] = true
+			queue = append(queue, r.blockers[next]...)
+		}
+	}
+
+	for _, existing := range r.blockers[id] {
+		if existing == blockerID {
+			return nil
+		}
+	}
+	return r.journal(ctx, models.HistoryAddBlocker, []int{id}, func() {
+		r.blockers[id] = append(r.blockers[id], blockerID)
+		r.bumpVersion(id)
+	})
+}
+
+func (r *memoryTodoRepository) RemoveBlocker(ctx context.Context, userID, id, blockerID int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.live(userID, id); !ok {
+		return ErrNotFound
+	}
+	ids := r.blockers[id]
+	for i, existing := range ids {
+		if existing == blockerID {
+			return r.journal(ctx, models.HistoryRemoveBlocker, []int{id}, func() {
+				r.blockers[id] = append(ids[:i:i], ids[i+1:]...)
+				r.bumpVersion(id)
+			})
+		}
+	}
+	return ErrNotFound
+}
+
+func (r *memoryTodoRepository) LatestOccurrence(ctx context.Context, userID, seriesID int) (models.Todo, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	latest, ok := r.latest()[seriesID]
+	if !ok || latest.UserID != userID {
+		return models.Todo{}, ErrNotFound
+	}
+	return r.withTags(latest), nil
+}
+
+func (r *memoryTodoRepository) LatestOccurrences(ctx context.Context) ([]models.Todo, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	todos := []models.Todo{}
+	for _, todo := range r.latest() {
+		if todo.Recurrence != "" {
+			todos = append(todos, r.withTags(todo))
+		}
+	}
+	sort.Slice(todos, func(i, j int) bool { return todos[i].ID < todos[j].ID })
+	return todos, nil
+}
+
+func (r *memoryTodoRepository) CreateOccurrence(ctx context.Context, template models.Todo, at time.Time) (models.Todo, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	at = at.UTC()
+	for _, todo := range r.todos {
+		if todo.SeriesID != nil && template.SeriesID != nil && *todo.SeriesID == *template.SeriesID && todo.OccurrenceAt.Equal(at) {
+			return models.Todo{}, false, nil
+		}
+	}
+
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	r.nextTodoID++
+	todo := models.Todo{
+		ID:           r.nextTodoID,
+		UserID:       template.UserID,
+		Title:        template.Title,
+		Description:  template.Description,
+		Priority:     template.Priority,
+		DueAt:        &at,
+		ParentID:     template.ParentID,
+		ListID:       template.ListID,
+		Recurrence:   template.Recurrence,
+		SeriesID:     template.SeriesID,
+		OccurrenceAt: &at,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+		Version:      1,
+	}
+	r.todos[todo.ID] = todo
+	r.todoTags[todo.ID] = append([]int{}, r.todoTags[template.ID]...)
+	todo = r.withTags(todo)
+	return todo, true, r.record(ctx, models.HistoryCreate, nil, &todo)
+}
+
+func (r *memoryTodoRepository) Batch(ctx context.Context, userID int, ops []BatchOp, atomic bool) ([]BatchResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var rollback func()
+	if atomic {
+		rollback = r.snapshot()
+	}
+	results := make([]BatchResult, len(ops))
+	for i := range ops {
+		result, userID := &results[i], ops[i].owner(userID)
+		op, err := resolve(ops[i], i, results)
+		if err == nil {
+			result.Todo = op.Todo
+			result.Todo.UserID = userID
+			if op.Op != BatchCreate {
+				before, ok := r.live(userID, op.Todo.ID)
+				if !ok {
+					err = ErrNotFound
+				}
+				result.Before = r.withTags(before)
+			}
+		}
+
+		if err == nil {
+			switch op.Op {
+			case BatchCreate:
+				err = r.create(ctx, &result.Todo)
+			case BatchUpdate:
+				err = r.update(ctx, &result.Todo, op.Options)
+			case BatchDelete:
+				result.Todo, err = r.delete(ctx, userID, op.Todo.ID, op.Options.Version)
+			case BatchAddBlocker:
+				if err = r.addBlocker(ctx, userID, op.Todo.ID, op.BlockerID); err == nil {
+					result.Todo = r.withTags(r.todos[op.Todo.ID])
+				}
+			}
+		}
+		if err != nil {
+			result.Todo, result.Err = models.Todo{}, err
+			if atomic {
+				rollback()
+				return nil, &BatchError{Index: i, Err: err}
+			}
+		}
+	}
+	return results, nil
+}
+
+func (r *memoryTodoRepository) Move(ctx context.Context, userID, id int, listID *int) (models.Todo, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	todo, ok := r.live(userID, id)
+	if !ok {
+		return models.Todo{}, ErrNotFound
+	}
+	if todo.ParentID != nil {
+		return models.Todo{}, ErrListMismatch
+	}
+	if listID != nil && !r.ownsList(userID, *listID) {
+		return models.Todo{}, ErrInvalidList
+	}
+	if sameList(todo.ListID, listID) {
+		return r.withTags(todo), nil
+	}
+
+	// Subtasks in the trash move too, so that they are restored into their
+	// parent's list
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	all := func(models.Todo) bool { return true }
+	ids := append([]int{id}, r.subtree(id, all)...)
+	err := r.journal(ctx, models.HistoryMove, ids, func() {
+		for _, id := range ids {
+			todo := r.todos[id]
+			todo.ListID, todo.UpdatedAt = listID, now
+			todo.Version++
+			r.todos[id] = todo
+		}
+	})
+	return r.withTags(r.todos[id]), err
+}
+
+// snapshot copies the state batches change and returns a function that
+// restores it. Callers hold r.mu.
+func (r *memoryTodoRepository) snapshot() func() {
+	nextTodoID, nextTagID := r.nextTodoID, r.nextTagID
+	todos := make(map[int]models.Todo, len(r.todos))
+	for id, todo := range r.todos {
+		todos[id] = todo
+	}
+	tags := make(map[int]memoryTag, len(r.tags))
+	for id, tag := range r.tags {
+		tags[id] = tag
+	}
+	todoTags := make(map[int][]int, len(r.todoTags))
+	for id, tagIDs := range r.todoTags {
+		todoTags[id] = tagIDs
+	}
+	blockers := make(map[int][]int, len(r.blockers))
+	for id, blockerIDs := range r.blockers {
+		blockers[id] = blockerIDs
+	}
+	history := r.history
+	r.webhooks.mu.RLock()
+	nextDeliveryID := r.webhooks.nextDeliveryID
+	r.webhooks.mu.RUnlock()
+	return func() {
+		r.nextTodoID, r.nextTagID = nextTodoID, nextTagID
+		r.todos, r.tags, r.todoTags, r.blockers = todos, tags, todoTags, blockers
+		r.history = history
+		r.webhooks.unqueue(nextDeliveryID)
+	}
+}
+
+// journal runs write, which changes the todos ids, and records the change
+// to each of them in its history as operation. Callers hold r.mu.
+func (r *memoryTodoRepository) journal(ctx context.Context, operation string, ids []int, write func()) error {
+	before := map[int]models.Todo{}
+	for _, id := range ids {
+		if todo, ok := r.todos[id]; ok {
+			before[id] = r.withTags(todo)
+		}
+	}
+	write()
+	for _, id := range ids {
+		b, bok := before[id]
+		todo, aok := r.todos[id]
+		a := r.withTags(todo)
+		var err error
+		switch {
+		case bok && aok:
+			err = r.record(ctx, operation, &b, &a)
+		case bok:
+			err = r.record(ctx, operation, &b, nil)
+		case aok:
+			err = r.record(ctx, operation, nil, &a)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// record appends a change to a todo to its history. Callers hold d.mu.
+func (d *memoryData) record(ctx context.Context, operation string, before, after *models.Todo) error {
+	entry, ok, err := historyEntry(ctx, operation, before, after)
+	if !ok {
+		return err
+	}
+	d.appendHistory(&entry)
+	for _, event := range todoEvents(operation, before, after) {
+		if err := d.webhooks.enqueue(event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// appendHistory adds entry to the history. Callers hold d.mu.
+func (d *memoryData) appendHistory(entry *models.HistoryEntry) {
+	entry.ID = len(d.history) + 1
+	entry.CreatedAt = entry.CreatedAt.UTC().Truncate(time.Microsecond)
+	d.history = append(d.history, *entry)
+}
+
+// bumpVersion marks a todo as changed when only its links were written.
+// Callers hold r.mu.
+func (r *memoryTodoRepository) bumpVersion(id int) {
+	todo := r.todos[id]
+	todo.Version++
+	r.todos[id] = todo
+}
+
+// latest returns the newest occurrence of every series by series ID. Callers hold r.mu.
+func (r *memoryTodoRepository) latest() map[int]models.Todo {
+	latest := map[int]models.Todo{}
+	for _, todo := range r.todos {
+		if todo.SeriesID == nil || todo.DeletedAt != nil {
+			continue
+		}
+		if current, ok := latest[*todo.SeriesID]; !ok || todo.OccurrenceAt.After(*current.OccurrenceAt) {
+			latest[*todo.SeriesID] = todo
+		}
+	}
+	return latest
+}
+
+// checkParent verifies that parentID names one of the user's todos and that
+// it is neither id itself nor one of id's descendants. Callers hold r.mu.
+func (r *memoryTodoRepository) checkParent(userID, id int, parentID *int) error {
+	if parentID == nil {
+		return nil
+	}
+	if *parentID == id {
+		return ErrCycle
+	}
+	if _, ok := r.live(userID, *parentID); !ok {
+		return ErrInvalidReference
+	}
+	for _, descendant := range r.descendants(id) {
+		if descendant == *parentID {
+			return ErrCycle
+		}
+	}
+	return nil
+}
+
+// ownsList reports whether listID is one of the user's lists. Callers hold r.mu.
+func (d *memoryData) ownsList(userID, listID int) bool {
+	list, ok := d.lists[listID]
+	return ok && list.OwnerID == userID
+}
+
+// live returns the user's todo id unless it is missing or in the trash.
+// Callers hold r.mu.
+func (r *memoryTodoRepository) live(userID, id int) (models.Todo, bool) {
+	todo, ok := r.todos[id]
+	if !ok || todo.UserID != userID || todo.DeletedAt != nil {
+		return models.Todo{}, false
+	}
+	return todo, true
+}
+
+// purge permanently removes the given todos and their links. Callers hold r.mu.
+func (r *memoryTodoRepository) purge(ids []int) {
+	purged := map[int]bool{}
+	for _, id := range ids {
+		purged[id] = true
+		delete(r.todos, id)
+		delete(r.todoTags, id)
+		delete(r.blockers, id)
+	}
+	for todoID, blockers := range r.blockers {
+		kept := []int{}
+		for _, blockerID := range blockers {
+			if !purged[blockerID] {
+				kept = append(kept, blockerID)
+			}
+		}
+		r.blockers[todoID] = kept
+	}
+}
+
+// descendants returns the IDs of every subtask of id at any depth that is not
+// in the trash, parents before their children. Callers hold r.mu.
+func (r *memoryTodoRepository) descendants(id int) []int {
+	return r.subtree(id, func(todo models.Todo) bool { return todo.DeletedAt == nil })
+}
+
+// subtree returns the IDs of the subtasks of id at any depth that satisfy
+// keep, not descending below those that do not. Callers hold r.mu.
+func (r *memoryTodoRepository) subtree(id int, keep func(models.Todo) bool) []int {
+	children := map[int][]int{}
+	for _, todo := range r.todos {
+		if todo.ParentID != nil && keep(todo) {
+			children[*todo.ParentID] = append(children[*todo.ParentID], todo.ID)
+		}
+	}
+
+	ids := []int{}
+	level := []int{id}
+	for len(level) > 0 {
+		next := []int{}
+		for _, parent := range level {
+			sort.Ints(children[parent])
+			next = append(next, children[parent]...)
+		}
+		ids = append(ids, next...)
+		level = next
+	}
+	return ids
+}
+
+type memoryHistoryRepository struct {
+	*memoryData
+}
+
+func (r *memoryHistoryRepository) Append(ctx context.Context, entry *models.HistoryEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.appendHistory(entry)
+	return nil
+}
+
+func (r *memoryHistoryRepository) List(ctx context.Context, userID, todoID, beforeID, limit int) ([]models.HistoryEntry, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	entries := []models.HistoryEntry{}
+	for i := len(r.history) - 1; i >= 0 && len(entries) < limit; i-- {
+		entry := r.history[i]
+		if entry.TodoID == todoID && entry.UserID == userID && (beforeID == 0 || entry.ID < beforeID) {
+			entries = append(entries, entry)
+		}
+	}
+	if len(entries) > 0 || beforeID > 0 {
+		return entries, nil
+	}
+
+	// Todos created before history was kept have none
+	if todo, ok := r.todos[todoID]; !ok || todo.UserID != userID {
+		return nil, ErrNotFound
+	}
+	return entries, nil
+}
+
+func (r *memoryHistoryRepository) Version(ctx context.Context, userID, todoID, version int) (models.HistoryEntry, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for i := len(r.history) - 1; i >= 0; i-- {
+		entry := r.history[i]
+		if entry.TodoID == todoID && entry.UserID == userID && entry.Version == version {
+			return entry, nil
+		}
+	}
+	return models.HistoryEntry{}, ErrNotFound
+}
+
+type memoryTagRepository struct {
+	*memoryData
+}
+
+func (r *memoryTagRepository) List(ctx context.Context, userID int) ([]models.Tag, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	tags := []models.Tag{}
+	for id, tag := range r.tags {
+		if tag.userID == userID {
+			tags = append(tags, r.tag(id))
+		}
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Name < tags[j].Name })
+	return tags, nil
+}
+
+func (r *memoryTagRepository) Rename(ctx context.Context, userID, id int, name string) (models.Tag, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tag, ok := r.tags[id]
+	if !ok || tag.userID != userID {
+		return models.Tag{}, ErrNotFound
+	}
+	name = NormalizeTag(name)
+	if other := r.tagID(userID, name); other != 0 && other != id {
+		return models.Tag{}, ErrDuplicate
+	}
+	tag.name = name
+	r.tags[id] = tag
+	return r.tag(id), nil
+}
+
+func (r *memoryTagRepository) Merge(ctx context.Context, userID, sourceID, targetID int) (models.Tag, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	source, ok := r.tags[sourceID]
+	target, ok2 := r.tags[targetID]
+	if !ok || !ok2 || source.userID != userID || target.userID != userID {
+		return models.Tag{}, ErrNotFound
+	}
+
+	for todoID, ids := range r.todoTags {
+		merged := []int{}
+		for _, id := range ids {
+			if id != sourceID && id != targetID {
+				merged = append(merged, id)
+			}
+		}
+		if len(merged) != len(ids) {
+			r.todoTags[todoID] = append(merged, targetID)
+		}
+	}
+	delete(r.tags, sourceID)
+	return r.tag(targetID), nil
+}
+
+// tag builds the API view of a tag, counting its todos. Callers hold r.mu.
+func (r *memoryTagRepository) tag(id int) models.Tag {
+	tag := models.Tag{ID: id, Name: r.tags[id].name}
+	for _, ids := range r.todoTags {
+		for _, tagID := range ids {
+			if tagID == id {
+				tag.TodoCount++
+			}
+		}
+	}
+	return tag
+}
+
+// utc normalises an optional timestamp to UTC so stored instants compare
+// consistently regardless of the offset the client sent
+func utc(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	u := t.UTC()
+	return &u
+}
+
+// sameList reports whether two optional list IDs name the same list, or no list
+func sameList(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+type memoryUserRepository struct {
+	mu     sync.RWMutex
+	nextID int
+	users  map[string]models.User // keyed by email
+}
+
+func (r *memoryUserRepository) Create(ctx context.Context, user *models.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.users[user.Email]; ok {
+		return ErrDuplicate
+	}
+	r.nextID++
+	user.ID = r.nextID
+	if user.Role == "" {
+		user.Role = models.AccountMember
+	}
+	if user.TenantID == 0 {
+		user.TenantID = tenant.Default
+	}
+	r.users[user.Email] = *user
+	return nil
+}
+
+func (r *memoryUserRepository) Get(ctx context.Context, id int) (models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, user := range r.users {
+		if user.ID == id {
+			return user, nil
+		}
+	}
+	return models.User{}, ErrNotFound
+}
+
+func (r *memoryUserRepository) GetByEmail(ctx context.Context, email string) (models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	user, ok := r.users[email]
+	if !ok {
+		return models.User{}, ErrNotFound
+	}
+	return user, nil
+}
+
+func (r *memoryUserRepository) SetTimezone(ctx context.Context, id int, timezone string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for email, user := range r.users {
+		if user.ID == id {
+			user.Timezone = timezone
+			r.users[email] = user
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (r *memoryUserRepository) List(ctx context.Context) ([]models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	users := []models.User{}
+	for _, user := range r.users {
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	return users, nil
+}
+
+func (r *memoryUserRepository) SetRole(ctx context.Context, id int, role string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for email, user := range r.users {
+		if user.ID == id {
+			user.Role = role
+			r.users[email] = user
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+// memoryTenantRepository knows only the default tenant, since the memory
+// store cannot keep tenants apart
+type memoryTenantRepository struct {
+	mu      sync.RWMutex
+	tenants []models.Tenant
+}
+
+func (r *memoryTenantRepository) List(ctx context.Context) ([]models.Tenant, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return append([]models.Tenant{}, r.tenants...), nil
+}
+
+func (r *memoryTenantRepository) Get(ctx context.Context, id int) (models.Tenant, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, t := range r.tenants {
+		if t.ID == id {
+			return t, nil
+		}
+	}
+	return models.Tenant{}, ErrNotFound
+}
+
+func (r *memoryTenantRepository) GetByName(ctx context.Context, name string) (models.Tenant, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, t := range r.tenants {
+		if t.Name == name {
+			return t, nil
+		}
+	}
+	return models.Tenant{}, ErrNotFound
+}
+
+func (r *memoryTenantRepository) Create(ctx context.Context, t *models.Tenant, admin *models.User) error {
+	return ErrTenantsUnsupported
+}
+
+func (r *memoryTenantRepository) SetSuspended(ctx context.Context, id int, suspended bool) (models.Tenant, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, t := range r.tenants {
+		if t.ID != id {
+			continue
+		}
+		if !suspended {
+			t.SuspendedAt = nil
+		} else if t.SuspendedAt == nil {
+			now := time.Now().UTC()
+			t.SuspendedAt = &now
+		}
+		r.tenants[i] = t
+		return t, nil
+	}
+	return models.Tenant{}, ErrNotFound
+}
+
+type memoryWebhookRepository struct {
+	mu             sync.RWMutex
+	nextID         int
+	webhooks       map[int]models.Webhook // Secret included
+	nextDeliveryID int
+	deliveries     map[int]models.WebhookDelivery
+}
+
+func (r *memoryWebhookRepository) List(ctx context.Context, userID int) ([]models.Webhook, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	webhooks := []models.Webhook{}
+	for _, webhook := range r.webhooks {
+		if webhook.UserID == userID {
+			webhook.Secret = ""
+			webhooks = append(webhooks, webhook)
+		}
+	}
+	sort.Slice(webhooks, func(i, j int) bool { return webhooks[i].ID < webhooks[j].ID })
+	return webhooks, nil
+}
+
+func (r *memoryWebhookRepository) Get(ctx context.Context, userID, id int) (models.Webhook, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	webhook, ok := r.webhooks[id]
+	if !ok || webhook.UserID != userID {
+		return models.Webhook{}, ErrNotFound
+	}
+	webhook.Secret = ""
+	return webhook, nil
+}
+
+func (r *memoryWebhookRepository) Create(ctx context.Context, webhook *models.Webhook) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nextID++
+	webhook.ID = r.nextID
+	webhook.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+	r.webhooks[webhook.ID] = *webhook
+	return nil
+}
+
+func (r *memoryWebhookRepository) Update(ctx context.Context, webhook *models.Webhook) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing, ok := r.webhooks[webhook.ID]
+	if !ok || existing.UserID != webhook.UserID {
+		return ErrNotFound
+	}
+	existing.URL, existing.Events, existing.Active = webhook.URL, webhook.Events, webhook.Active
+	if webhook.Secret != "" {
+		existing.Secret = webhook.Secret
+	}
+	r.webhooks[webhook.ID] = existing
+
+	*webhook = existing
+	webhook.Secret = ""
+	return nil
+}
+
+func (r *memoryWebhookRepository) Delete(ctx context.Context, userID, id int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	webhook, ok := r.webhooks[id]
+	if !ok || webhook.UserID != userID {
+		return ErrNotFound
+	}
+	delete(r.webhooks, id)
+	for deliveryID, delivery := range r.deliveries {
+		if delivery.WebhookID == id {
+			delete(r.deliveries, deliveryID)
+		}
+	}
+	return nil
+}
+
+// unqueue drops the deliveries queued after the one numbered lastID, whose
+// changes were rolled back
+func (r *memoryWebhookRepository) unqueue(lastID int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id := lastID + 1; id <= r.nextDeliveryID; id++ {
+		delete(r.deliveries, id)
+	}
+	r.nextDeliveryID = lastID
+}
+
+// enqueue queues event for every active webhook of its user subscribed to it
+func (r *memoryWebhookRepository) enqueue(event events.Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	for _, webhook := range r.webhooks {
+		if webhook.UserID != event.UserID || !webhook.Active || !subscribed(webhook.Events, event.Type) {
+			continue
+		}
+		r.nextDeliveryID++
+		r.deliveries[r.nextDeliveryID] = models.WebhookDelivery{
+			ID:            r.nextDeliveryID,
+			WebhookID:     webhook.ID,
+			Event:         event.Type,
+			Payload:       payload,
+			Status:        models.DeliveryPending,
+			NextAttemptAt: &now,
+			CreatedAt:     now,
+			UpdatedAt:     now,
+		}
+	}
+	return nil
+}
+
+func (r *memoryWebhookRepository) Deliveries(ctx context.Context, userID, webhookID, beforeID, limit int) ([]models.WebhookDelivery, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if webhook, ok := r.webhooks[webhookID]; !ok || webhook.UserID != userID {
+		return nil, ErrNotFound
+	}
+	deliveries := []models.WebhookDelivery{}
+	for _, delivery := range r.deliveries {
+		if delivery.WebhookID == webhookID && (beforeID <= 0 || delivery.ID < beforeID) {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	sort.Slice(deliveries, func(i, j int) bool { return deliveries[i].ID > deliveries[j].ID })
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+	return deliveries, nil
+}
+
+func (r *memoryWebhookRepository) Redeliver(ctx context.Context, userID, webhookID, deliveryID int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delivery, ok := r.deliveries[deliveryID]
+	if webhook := r.webhooks[webhookID]; !ok || delivery.WebhookID != webhookID || webhook.UserID != userID {
+		return ErrNotFound
+	}
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	delivery.Status, delivery.Attempts, delivery.NextAttemptAt, delivery.UpdatedAt = models.DeliveryPending, 0, &now, now
+	r.deliveries[deliveryID] = delivery
+	return nil
+}
+
+func (r *memoryWebhookRepository) ClaimDue(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]models.WebhookDelivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	due := []models.WebhookDelivery{}
+	for _, delivery := range r.deliveries {
+		if delivery.Status == models.DeliveryPending && !delivery.NextAttemptAt.After(now) && r.webhooks[delivery.WebhookID].Active {
+			due = append(due, delivery)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		if !due[i].NextAttemptAt.Equal(*due[j].NextAttemptAt) {
+			return due[i].NextAttemptAt.Before(*due[j].NextAttemptAt)
+		}
+		return due[i].ID < due[j].ID
+	})
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	claimedUntil := now.Add(lease).UTC()
+	for i, delivery := range due {
+		delivery.NextAttemptAt = &claimedUntil
+		r.deliveries[delivery.ID] = delivery
+		due[i].URL, due[i].Secret = r.webhooks[delivery.WebhookID].URL, r.webhooks[delivery.WebhookID].Secret
+	}
+	return due, nil
+}
+
+func (r *memoryWebhookRepository) RecordAttempt(ctx context.Context, delivery models.WebhookDelivery) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing, ok := r.deliveries[delivery.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	existing.Status, existing.Attempts, existing.NextAttemptAt = delivery.Status, delivery.Attempts, utc(delivery.NextAttemptAt)
+	existing.LastStatusCode, existing.LastError = delivery.LastStatusCode, delivery.LastError
+	existing.UpdatedAt = time.Now().UTC().Truncate(time.Microsecond)
+	r.deliveries[delivery.ID] = existing
+	return nil
+}
+
+type memoryListRepository struct {
+	*memoryData
+	users *memoryUserRepository
+}
+
+func (r *memoryListRepository) List(ctx context.Context, userID int) ([]models.List, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	lists := []models.List{}
+	for id := range r.lists {
+		if list, ok := r.visible(userID, id); ok {
+			lists = append(lists, list)
+		}
+	}
+	sort.Slice(lists, func(i, j int) bool { return lists[i].ID < lists[j].ID })
+	return lists, nil
+}
+
+func (r *memoryListRepository) Get(ctx context.Context, userID, id int) (models.List, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	list, ok := r.visible(userID, id)
+	if !ok {
+		return models.List{}, ErrNotFound
+	}
+	return list, nil
+}
+
+func (r *memoryListRepository) Create(ctx context.Context, list *models.List) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nextListID++
+	list.ID = r.nextListID
+	list.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+	list.Role = ""
+	r.lists[list.ID] = *list
+	r.members[list.ID] = map[int]string{}
+	list.Role = models.RoleOwner
+	return nil
+}
+
+func (r *memoryListRepository) Rename(ctx context.Context, id int, name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	list, ok := r.lists[id]
+	if !ok {
+		return ErrNotFound
+	}
+	list.Name = name
+	r.lists[id] = list
+	return nil
+}
+
+func (r *memoryListRepository) Delete(ctx context.Context, id int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.lists[id]; !ok {
+		return ErrNotFound
+	}
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	for todoID, todo := range r.todos {
+		if todo.ListID != nil && *todo.ListID == id {
+			todo.ListID, todo.UpdatedAt = nil, now
+			todo.Version++
+			r.todos[todoID] = todo
+		}
+	}
+	for inviteID, invite := range r.invites {
+		if invite.ListID == id {
+			delete(r.invites, inviteID)
+		}
+	}
+	delete(r.lists, id)
+	delete(r.members, id)
+	return nil
+}
+
+func (r *memoryListRepository) Members(ctx context.Context, id int) ([]models.ListMember, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	list, ok := r.lists[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	owner, _ := r.users.Get(ctx, list.OwnerID)
+	members := []models.ListMember{{UserID: owner.ID, Email: owner.Email, Role: models.RoleOwner}}
+	others := []models.ListMember{}
+	for userID, role := range r.members[id] {
+		user, _ := r.users.Get(ctx, userID)
+		others = append(others, models.ListMember{UserID: userID, Email: user.Email, Role: role})
+	}
+	sort.Slice(others, func(i, j int) bool { return others[i].UserID < others[j].UserID })
+	return append(members, others...), nil
+}
+
+func (r *memoryListRepository) SetRole(ctx context.Context, id, userID int, role string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.members[id][userID]; !ok {
+		return ErrNotFound
+	}
+	r.members[id][userID] = role
+	return nil
+}
+
+func (r *memoryListRepository) RemoveMember(ctx context.Context, id, userID int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.members[id][userID]; !ok {
+		return ErrNotFound
+	}
+	delete(r.members[id], userID)
+	return nil
+}
+
+func (r *memoryListRepository) Invite(ctx context.Context, invite *models.ListInvite) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	list, ok := r.lists[invite.ListID]
+	if !ok {
+		return ErrNotFound
+	}
+	if user, err := r.users.GetByEmail(ctx, invite.Email); err == nil {
+		if _, member := r.members[list.ID][user.ID]; member || user.ID == list.OwnerID {
+			return ErrDuplicate
+		}
+	}
+	for _, existing := range r.invites {
+		if existing.ListID == invite.ListID && existing.Email == invite.Email {
+			return ErrDuplicate
+		}
+	}
+
+	r.nextInvite++
+	invite.ID = r.nextInvite
+	invite.ListName = list.Name
+	invite.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+	r.invites[invite.ID] = *invite
+	return nil
+}
+
+func (r *memoryListRepository) Invites(ctx context.Context, id int) ([]models.ListInvite, error) {
+	return r.filterInvites(func(invite models.ListInvite) bool { return invite.ListID == id }), nil
+}
+
+func (r *memoryListRepository) RevokeInvite(ctx context.Context, id, inviteID int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	invite, ok := r.invites[inviteID]
+	if !ok || invite.ListID != id {
+		return ErrNotFound
+	}
+	delete(r.invites, inviteID)
+	return nil
+}
+
+func (r *memoryListRepository) Invitations(ctx context.Context, email string) ([]models.ListInvite, error) {
+	return r.filterInvites(func(invite models.ListInvite) bool { return invite.Email == email }), nil
+}
+
+func (r *memoryListRepository) Accept(ctx context.Context, user models.User, inviteID int) (models.List, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	invite, ok := r.invites[inviteID]
+	if !ok || invite.Email != user.Email {
+		return models.List{}, ErrNotFound
+	}
+	// The owner's account is a member already, and accepting a second
+	// invitation changes the role
+	if r.lists[invite.ListID].OwnerID != user.ID {
+		r.members[invite.ListID][user.ID] = invite.Role
+	}
+	delete(r.invites, inviteID)
+	list, _ := r.visible(user.ID, invite.ListID)
+	return list, nil
+}
+
+func (r *memoryListRepository) Decline(ctx context.Context, email string, inviteID int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	invite, ok := r.invites[inviteID]
+	if !ok || invite.Email != email {
+		return ErrNotFound
+	}
+	delete(r.invites, inviteID)
+	return nil
+}
+
+func (r *memoryListRepository) TodoRole(ctx context.Context, userID, todoID int) (int, string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	todo, ok := r.todos[todoID]
+	if !ok {
+		return 0, "", ErrNotFound
+	}
+	if todo.UserID == userID {
+		return todo.UserID, models.RoleOwner, nil
+	}
+	if todo.ListID != nil {
+		if role, ok := r.members[*todo.ListID][userID]; ok {
+			return todo.UserID, role, nil
+		}
+	}
+	return 0, "", ErrNotFound
+}
+
+// visible returns a list with the user's role on it, unless they have none.
+// Callers hold r.mu.
+func (r *memoryListRepository) visible(userID, id int) (models.List, bool) {
+	list, ok := r.lists[id]
+	if !ok {
+		return models.List{}, false
+	}
+	if list.OwnerID == userID {
+		list.Role = models.RoleOwner
+		return list, true
+	}
+	role, ok := r.members[id][userID]
+	list.Role = role
+	return list, ok
+}
+
+func (r *memoryListRepository) filterInvites(keep func(models.ListInvite) bool) []models.ListInvite {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	invites := []models.ListInvite{}
+	for _, invite := range r.invites {
+		if keep(invite) {
+			invite.ListName = r.lists[invite.ListID].Name
+			invites = append(invites, invite)
+		}
+	}
+	sort.Slice(invites, func(i, j int) bool { return invites[i].ID < invites[j].ID })
+	return invites
+}
@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"gin-app/events"
+	"gin-app/models"
+)
+
+// todoEvents returns the events a change to a todo is announced with to
+// webhooks, which queue them in the same transaction as the change. A
+// change to a todo announces it updated, and completed too when it was
+// just completed; purges are not announced.
+func todoEvents(operation string, before, after *models.Todo) []events.Event {
+	switch operation {
+	case models.HistoryCreate:
+		return []events.Event{events.New(events.TodoCreated, *after)}
+	case models.HistoryDelete:
+		return []events.Event{events.New(events.TodoDeleted, *after)}
+	case models.HistoryRestore:
+		return []events.Event{events.New(events.TodoRestored, *after)}
+	case models.HistoryPurge:
+		return nil
+	}
+	announced := []events.Event{events.New(events.TodoUpdated, *after)}
+	if after.Completed && !before.Completed {
+		announced = append(announced, events.New(events.TodoCompleted, *after))
+	}
+	return announced
+}
+
+// enqueue queues event for every active webhook of its user subscribed to
+// it, in q
+func enqueue(ctx context.Context, q querier, event events.Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	rows, err := q.QueryContext(ctx, "SELECT id, events FROM webhooks WHERE user_id = $1 AND active ORDER BY id", event.UserID)
+	if err != nil {
+		return err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		var subscriptions string
+		if err := rows.Scan(&id, &subscriptions); err != nil {
+			rows.Close()
+			return err
+		}
+		if subscribed(strings.Split(subscriptions, ","), event.Type) {
+			ids = append(ids, id)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	for _, id := range ids {
+		_, err := q.ExecContext(ctx, `INSERT INTO webhook_deliveries (webhook_id, event, payload, status, next_attempt_at, created_at, updated_at)
+VALUES ($1, $2, $3, $4, $5, $5, $5)`, id, event.Type, string(payload), models.DeliveryPending, now)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+// NewPostgres returns a Store backed by an open lib/pq connection pool
+func NewPostgres(db *sql.DB) *Store {
+	return &Store{
+		Todos:    &sqlTodoRepository{db: db, ilike: "ILIKE", lockUser: "SELECT id FROM users WHERE id = $1 FOR UPDATE"},
+		Tags:     &sqlTagRepository{db: db, isDuplicate: isPostgresUniqueViolation},
+		Users:    &sqlUserRepository{db: db, isDuplicate: isPostgresUniqueViolation},
+		Webhooks: &sqlWebhookRepository{db: db},
+		History:  &sqlHistoryRepository{db: db},
+		Lists:    &sqlListRepository{db: db, isDuplicate: isPostgresUniqueViolation},
+		Tenants:  &sqlTenantRepository{db: db, isDuplicate: isPostgresUniqueViolation, isolated: true},
+	}
+}
+
+func isPostgresUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
@@ -0,0 +1,133 @@
+package repository
+
+import (
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"gin-app/models"
+)
+
+// Sort keys accepted by TodoQuery.Sort
+const (
+	SortID        = "id"
+	SortTitle     = "title"
+	SortCreatedAt = "created_at"
+)
+
+// TodoQuery filters, orders and pages a todo listing
+type TodoQuery struct {
+	// Completed restricts the listing to done or open todos when set
+	Completed *bool
+	// Search matches a case-insensitive substring of the title
+	Search string
+	// Tags keeps todos carrying every one of the named tags
+	Tags []string
+	// Priority restricts the listing to one priority when set
+	Priority *int
+	// DueAfter and DueBefore bound due_at (inclusive); todos without a due
+	// date are excluded when either is set
+	DueAfter  *time.Time
+	DueBefore *time.Time
+	// ListID restricts the listing to the todos of one list when set
+	ListID *int
+	// AllUsers lists the todos of every account, ignoring the user ID; it
+	// is for admins
+	AllUsers bool
+	// Overdue keeps open todos whose due date is before Now
+	Overdue bool
+	Now     time.Time
+	// Sort is one of the Sort* keys; ties are always broken by ID
+	Sort string
+	Desc bool
+	// Limit caps the page size
+	Limit int
+	// After resumes the listing after the given position
+	After *TodoCursor
+}
+
+// TodoCursor is a keyset position: the sort key and ID of the last todo on a
+// page. Only the field matching the query's sort key is consulted.
+type TodoCursor struct {
+	ID        int       `json:"id"`
+	Title     string    `json:"title,omitempty"`
+	CreatedAt time.Time `json:"created_at,omitempty"`
+}
+
+// CursorFor returns the keyset position of todo
+func CursorFor(todo models.Todo) TodoCursor {
+	return TodoCursor{ID: todo.ID, Title: todo.Title, CreatedAt: todo.CreatedAt}
+}
+
+// compareTodos orders a and b by the query's sort key, then by ID.
+// The result is negative when a sorts first in ascending order.
+func compareTodos(sortKey string, a, b TodoCursor) int {
+	c := 0
+	switch sortKey {
+	case SortTitle:
+		c = strings.Compare(a.Title, b.Title)
+	case SortCreatedAt:
+		c = a.CreatedAt.Compare(b.CreatedAt)
+	}
+	if c == 0 {
+		c = a.ID - b.ID
+	}
+	return c
+}
+
+// NormalizeTag trims and lower-cases a tag name so "Work " and "work" match
+func NormalizeTag(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// normalizeTags normalises, de-duplicates and sorts tag names, dropping empty ones
+func normalizeTags(names []string) []string {
+	seen := map[string]bool{}
+	tags := []string{}
+	for _, name := range names {
+		name = NormalizeTag(name)
+		if name != "" && !seen[name] {
+			seen[name] = true
+			tags = append(tags, name)
+		}
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// matchesQuery applies the non-keyset filters of query to todo
+func matchesQuery(todo models.Todo, query TodoQuery) bool {
+	if query.Completed != nil && todo.Completed != *query.Completed {
+		return false
+	}
+	if query.Search != "" && !strings.Contains(strings.ToLower(todo.Title), strings.ToLower(query.Search)) {
+		return false
+	}
+	if query.Priority != nil && todo.Priority != *query.Priority {
+		return false
+	}
+	if query.DueAfter != nil && (todo.DueAt == nil || todo.DueAt.Before(*query.DueAfter)) {
+		return false
+	}
+	if query.DueBefore != nil && (todo.DueAt == nil || todo.DueAt.After(*query.DueBefore)) {
+		return false
+	}
+	if query.ListID != nil && (todo.ListID == nil || *todo.ListID != *query.ListID) {
+		return false
+	}
+	if query.Overdue && (todo.Completed || todo.DueAt == nil || !todo.DueAt.Before(query.Now)) {
+		return false
+	}
+	for _, tag := range query.Tags {
+		if !slices.Contains(todo.Tags, tag) {
+			return false
+		}
+	}
+	return true
+}
+
+// escapeLike escapes LIKE wildcards so that s matches literally
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,298 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gin-app/models"
+)
+
+var (
+	// ErrNotFound is returned when a row does not exist or is not visible to the caller
+	ErrNotFound = errors.New("not found")
+	// ErrDuplicate is returned when a write violates a uniqueness constraint
+	ErrDuplicate = errors.New("duplicate")
+	// ErrInvalidReference is returned when a parent or blocker todo does not
+	// exist or belongs to someone else
+	ErrInvalidReference = errors.New("referenced todo not found")
+	// ErrCycle is returned when a parent or blocked-by link would make a todo
+	// its own ancestor or its own blocker
+	ErrCycle = errors.New("link would create a cycle")
+	// ErrOpenChildren is returned when completing a todo whose subtasks are
+	// still open without UpdateOptions.CompleteChildren
+	ErrOpenChildren = errors.New("todo has open subtasks")
+	// ErrVersionConflict is returned when a todo is no longer at the version
+	// a write was based on
+	ErrVersionConflict = errors.New("version conflict")
+	// ErrParentTrashed is returned when restoring a todo whose parent is
+	// still in the trash
+	ErrParentTrashed = errors.New("parent todo is in the trash")
+	// ErrInvalidList is returned when a todo is put in a list that does not
+	// exist or belongs to another account
+	ErrInvalidList = errors.New("list not found")
+	// ErrListMismatch is returned when a subtask would end up in another
+	// list than its parent
+	ErrListMismatch = errors.New("subtask and parent are in different lists")
+	// ErrTenantsUnsupported is returned when provisioning a tenant in a
+	// store that cannot keep tenants apart
+	ErrTenantsUnsupported = errors.New("this store serves the default tenant only")
+)
+
+// TodoRepository persists To-Do items. Every method is scoped to the owning
+// user, and apart from the trash methods only sees todos that are not in the
+// trash. Every change to a todo, subtasks changed along with their parent
+// included, is appended to its history in the same transaction, as made by
+// the actor of the context (see audit.WithActor), and the events announcing
+// it are queued for webhooks along with it. Changes made for no actor go
+// unrecorded and unannounced.
+type TodoRepository interface {
+	// List returns up to query.Limit todos and whether more follow
+	List(ctx context.Context, userID int, query TodoQuery) ([]models.Todo, bool, error)
+	Get(ctx context.Context, userID, id int) (models.Todo, error)
+	Create(ctx context.Context, todo *models.Todo) error
+	Update(ctx context.Context, todo *models.Todo, opts UpdateOptions) error
+	// Delete moves a todo together with all of its subtasks to the trash and
+	// returns it as it is there. A non-zero version must match the todo's, as
+	// with UpdateOptions.Version.
+	Delete(ctx context.Context, userID, id, version int) (models.Todo, error)
+
+	// Trash returns the user's deleted todos, most recently deleted first
+	Trash(ctx context.Context, userID int) ([]models.Todo, error)
+	// GetDeleted returns one of the user's todos in the trash
+	GetDeleted(ctx context.Context, userID, id int) (models.Todo, error)
+	// Restore takes a todo out of the trash along with the subtasks that
+	// were deleted with it
+	Restore(ctx context.Context, userID, id int) (models.Todo, error)
+	// Purge permanently removes a todo in the trash and its subtasks
+	Purge(ctx context.Context, userID, id int) error
+	// EmptyTrash permanently removes all of the user's deleted todos and
+	// returns how many there were
+	EmptyTrash(ctx context.Context, userID int) (int, error)
+	// PurgeDeleted permanently removes every todo, of any user, deleted
+	// before the given time. It exists for the retention job.
+	PurgeDeleted(ctx context.Context, before time.Time) (int, error)
+
+	// Subtree returns the todo and all of its descendants, parents first
+	Subtree(ctx context.Context, userID, id int) ([]models.Todo, error)
+	AddBlocker(ctx context.Context, userID, id, blockerID int) error
+	RemoveBlocker(ctx context.Context, userID, id, blockerID int) error
+
+	// LatestOccurrence returns the newest occurrence of a recurring series
+	LatestOccurrence(ctx context.Context, userID, seriesID int) (models.Todo, error)
+	// LatestOccurrences returns the newest occurrence of every series that
+	// still has a rule, for all users. It exists for the scheduler.
+	LatestOccurrences(ctx context.Context) ([]models.Todo, error)
+	// CreateOccurrence copies template into a new open todo of the same
+	// series due at at and returns it. It reports false when that occurrence
+	// already exists.
+	CreateOccurrence(ctx context.Context, template models.Todo, at time.Time) (models.Todo, bool, error)
+
+	// Batch applies ops to the user's todos in order, or to those of the
+	// account an operation names in UserID. An atomic batch runs
+	// in one transaction and fails with a *BatchError at the first failing
+	// operation, leaving everything unchanged; otherwise each operation
+	// succeeds or fails on its own and its result's Err says which.
+	Batch(ctx context.Context, userID int, ops []BatchOp, atomic bool) ([]BatchResult, error)
+
+	// Move puts a todo and all of its subtasks in one of the user's lists,
+	// or takes them out of their list when listID is nil. Subtasks only move
+	// with their parent and fail with ErrListMismatch.
+	Move(ctx context.Context, userID, id int, listID *int) (models.Todo, error)
+}
+
+// Operations of TodoRepository.Batch
+const (
+	BatchCreate = "create"
+	BatchUpdate = "update"
+	BatchDelete = "delete"
+	// BatchAddBlocker makes BlockerID block Todo.ID
+	BatchAddBlocker = "add_blocker"
+)
+
+// BatchOp is one operation of TodoRepository.Batch
+type BatchOp struct {
+	Op string
+	// Todo is the todo to create or the new state of the todo to update;
+	// the other operations only use its ID
+	Todo models.Todo
+	// Options apply to updates; Options.Version also guards deletes
+	Options UpdateOptions
+	// BlockerID is the todo an add_blocker makes block Todo.ID
+	BlockerID int
+	// UserID is the account the operation acts on, such as the owner of a
+	// shared list, when it is not the batch's
+	UserID int
+
+	// ParentOp, TodoOp and BlockerOp refer to todos created earlier in the
+	// same batch by the operation at that index. When set they replace
+	// Todo.ParentID, Todo.ID and BlockerID.
+	ParentOp  *int
+	TodoOp    *int
+	BlockerOp *int
+}
+
+// BatchResult is the outcome of one BatchOp
+type BatchResult struct {
+	// Todo is the todo as the operation left it; a deleted one as it is in
+	// the trash
+	Todo models.Todo
+	// Before is the todo as it was before an update, delete or add_blocker
+	Before models.Todo
+	Err    error
+}
+
+// BatchError reports the operation that failed an atomic batch
+type BatchError struct {
+	Index int
+	Err   error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("operation %d: %v", e.Index, e.Err)
+}
+
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+// UpdateOptions tunes TodoRepository.Update
+type UpdateOptions struct {
+	// CompleteChildren completes every open subtask when the todo is being
+	// completed; without it such an update fails with ErrOpenChildren
+	CompleteChildren bool
+	// Version, when non-zero, makes the update fail with ErrVersionConflict
+	// unless the todo is still at that version
+	Version int
+	// Operation is what the update is recorded as in the todo's history:
+	// models.HistoryUpdate unless set, as reverts do
+	Operation string
+}
+
+// HistoryRepository is the append-only audit log of changes to todos
+type HistoryRepository interface {
+	Append(ctx context.Context, entry *models.HistoryEntry) error
+	// List returns up to limit entries of a todo, newest first, starting
+	// below beforeID when it is non-zero. It returns ErrNotFound when the
+	// user has neither the todo, in or out of the trash, nor its history.
+	List(ctx context.Context, userID, todoID, beforeID, limit int) ([]models.HistoryEntry, error)
+	// Version returns the newest entry that left the todo at version
+	Version(ctx context.Context, userID, todoID, version int) (models.HistoryEntry, error)
+}
+
+// TagRepository manages a user's tags. Tags are created implicitly when a
+// todo is saved with a new tag name.
+type TagRepository interface {
+	List(ctx context.Context, userID int) ([]models.Tag, error)
+	Rename(ctx context.Context, userID, id int, name string) (models.Tag, error)
+	// Merge moves every todo tagged sourceID to targetID and deletes the source
+	Merge(ctx context.Context, userID, sourceID, targetID int) (models.Tag, error)
+}
+
+// WebhookRepository manages a user's webhook subscriptions and the queue of
+// deliveries to them. Deliveries are queued by the todo repository, in the
+// transaction of the change they announce, so none is lost to a crash after
+// the commit and none announces a change that was rolled back.
+type WebhookRepository interface {
+	List(ctx context.Context, userID int) ([]models.Webhook, error)
+	Get(ctx context.Context, userID, id int) (models.Webhook, error)
+	Create(ctx context.Context, webhook *models.Webhook) error
+	// Update changes URL, events and active flag, and the secret if it is set
+	Update(ctx context.Context, webhook *models.Webhook) error
+	Delete(ctx context.Context, userID, id int) error
+
+	// Deliveries returns a webhook's deliveries, newest first, with IDs below
+	// beforeID when it is positive
+	Deliveries(ctx context.Context, userID, webhookID, beforeID, limit int) ([]models.WebhookDelivery, error)
+	// Redeliver puts a delivery back in the queue with a fresh set of attempts
+	Redeliver(ctx context.Context, userID, webhookID, deliveryID int) error
+
+	// ClaimDue returns up to limit pending deliveries of active webhooks due
+	// at now, across all users, and hides them from other claims until now+lease
+	ClaimDue(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]models.WebhookDelivery, error)
+	// RecordAttempt stores the outcome of an attempt to deliver delivery.ID:
+	// its Status, Attempts, NextAttemptAt, LastStatusCode and LastError
+	RecordAttempt(ctx context.Context, delivery models.WebhookDelivery) error
+}
+
+// ListRepository manages lists, their members and invitations. The owner
+// of a list is implicitly a member with the owner role; other members may
+// be made owners too, but the list stays with the owner's account.
+type ListRepository interface {
+	// List returns the lists the user owns or is a member of, with the
+	// user's role on each
+	List(ctx context.Context, userID int) ([]models.List, error)
+	// Get returns a list with the user's role on it, or ErrNotFound when the
+	// user is not a member
+	Get(ctx context.Context, userID, id int) (models.List, error)
+	Create(ctx context.Context, list *models.List) error
+	Rename(ctx context.Context, id int, name string) error
+	// Delete removes a list, its members and invitations. Its todos stay
+	// with the owner outside of any list.
+	Delete(ctx context.Context, id int) error
+
+	// Members returns the owner and the members of a list
+	Members(ctx context.Context, id int) ([]models.ListMember, error)
+	// SetRole changes the role of a member, or fails with ErrNotFound
+	SetRole(ctx context.Context, id, userID int, role string) error
+	RemoveMember(ctx context.Context, id, userID int) error
+
+	// Invite records an invitation, or fails with ErrDuplicate when the
+	// email already has one to the list or belongs to a member
+	Invite(ctx context.Context, invite *models.ListInvite) error
+	// Invites returns the pending invitations to a list
+	Invites(ctx context.Context, id int) ([]models.ListInvite, error)
+	RevokeInvite(ctx context.Context, id, inviteID int) error
+	// Invitations returns the pending invitations addressed to email
+	Invitations(ctx context.Context, email string) ([]models.ListInvite, error)
+	// Accept makes the user a member of the list with the role they were
+	// invited as and removes the invitation. It fails with ErrNotFound
+	// unless the invitation is addressed to the user's email.
+	Accept(ctx context.Context, user models.User, inviteID int) (models.List, error)
+	// Decline removes an invitation addressed to email
+	Decline(ctx context.Context, email string, inviteID int) error
+
+	// TodoRole returns the account owning a todo, in or out of the trash,
+	// and the user's role on it: owner of their own todos and their role on
+	// the list of anyone else's. It returns ErrNotFound when the user cannot
+	// see the todo.
+	TodoRole(ctx context.Context, userID, todoID int) (int, string, error)
+}
+
+// UserRepository persists user accounts. Postgres only sees the accounts
+// of the tenant of the context.
+type UserRepository interface {
+	// Create adds an account to its TenantID, where emails are unique
+	Create(ctx context.Context, user *models.User) error
+	Get(ctx context.Context, id int) (models.User, error)
+	GetByEmail(ctx context.Context, email string) (models.User, error)
+	SetTimezone(ctx context.Context, id int, timezone string) error
+	// List returns every account, for admins
+	List(ctx context.Context) ([]models.User, error)
+	SetRole(ctx context.Context, id int, role string) error
+}
+
+// TenantRepository persists tenants, which every tenant sees
+type TenantRepository interface {
+	List(ctx context.Context) ([]models.Tenant, error)
+	Get(ctx context.Context, id int) (models.Tenant, error)
+	GetByName(ctx context.Context, name string) (models.Tenant, error)
+	// Create adds a tenant along with its first account, or fails with
+	// ErrDuplicate when the name is taken and ErrTenantsUnsupported when
+	// the store has no row-level security
+	Create(ctx context.Context, tenant *models.Tenant, admin *models.User) error
+	// SetSuspended suspends or resumes a tenant and returns it
+	SetSuspended(ctx context.Context, id int, suspended bool) (models.Tenant, error)
+}
+
+// Store groups the repositories backed by a single storage engine
+type Store struct {
+	Todos    TodoRepository
+	Tags     TagRepository
+	Users    UserRepository
+	Webhooks WebhookRepository
+	History  HistoryRepository
+	Lists    ListRepository
+	Tenants  TenantRepository
+}
@@ -0,0 +1,157 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+
+	"gin-app/models"
+	"gin-app/tenant"
+)
+
+// The Postgres and SQLite stores share one set of queries: both engines accept
+// $N placeholders, RETURNING, ON CONFLICT, recursive CTEs and row-value
+// comparisons. Dialect differences are injected by NewPostgres and NewSQLite.
+
+// querier is satisfied by both *sql.DB and *sql.Tx
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+type sqlUserRepository struct {
+	db          *sql.DB
+	isDuplicate func(error) bool
+}
+
+func (r *sqlUserRepository) Create(ctx context.Context, user *models.User) error {
+	return createUser(ctx, r.db, r.isDuplicate, user)
+}
+
+// createUser inserts an account, on its own or along with its tenant
+func createUser(ctx context.Context, q querier, isDuplicate func(error) bool, user *models.User) error {
+	if user.Role == "" {
+		user.Role = models.AccountMember
+	}
+	err := q.QueryRowContext(ctx, "INSERT INTO users (tenant_id, email, password_hash, timezone, role) VALUES ($1, $2, $3, $4, $5) RETURNING id",
+		user.TenantID, user.Email, user.PasswordHash, user.Timezone, user.Role).
+		Scan(&user.ID)
+	if err != nil && isDuplicate(err) {
+		return ErrDuplicate
+	}
+	return err
+}
+
+func (r *sqlUserRepository) Get(ctx context.Context, id int) (models.User, error) {
+	return r.get(ctx, "id", id)
+}
+
+func (r *sqlUserRepository) GetByEmail(ctx context.Context, email string) (models.User, error) {
+	return r.get(ctx, "email", email)
+}
+
+func (r *sqlUserRepository) get(ctx context.Context, column string, value interface{}) (models.User, error) {
+	args := []interface{}{value}
+	query := "SELECT " + userColumns + " FROM users WHERE " + column + " = $1" + inTenant(ctx, &args)
+	user, err := scanUser(r.db.QueryRowContext(ctx, query, args...))
+	if errors.Is(err, sql.ErrNoRows) {
+		return user, ErrNotFound
+	}
+	return user, err
+}
+
+func (r *sqlUserRepository) List(ctx context.Context) ([]models.User, error) {
+	args := []interface{}{}
+	rows, err := r.db.QueryContext(ctx, "SELECT "+userColumns+" FROM users WHERE TRUE"+inTenant(ctx, &args)+" ORDER BY id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []models.User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+func (r *sqlUserRepository) SetRole(ctx context.Context, id int, role string) error {
+	args := []interface{}{role, id}
+	result, err := r.db.ExecContext(ctx, "UPDATE users SET role = $1 WHERE id = $2"+inTenant(ctx, &args), args...)
+	if err != nil {
+		return err
+	}
+	return expectRow(result)
+}
+
+const userColumns = "id, tenant_id, email, password_hash, timezone, role"
+
+func scanUser(row rowScanner) (models.User, error) {
+	var user models.User
+	err := row.Scan(&user.ID, &user.TenantID, &user.Email, &user.PasswordHash, &user.Timezone, &user.Role)
+	return user, err
+}
+
+func (r *sqlUserRepository) SetTimezone(ctx context.Context, id int, timezone string) error {
+	args := []interface{}{timezone, id}
+	result, err := r.db.ExecContext(ctx, "UPDATE users SET timezone = $1 WHERE id = $2"+inTenant(ctx, &args), args...)
+	if err != nil {
+		return err
+	}
+	return expectRow(result)
+}
+
+// inTenant returns a condition keeping a statement on users to the tenant
+// ctx acts for, and adds its argument to args. Row-level security does so
+// already, unless the database role bypasses it. Contexts acting for every
+// tenant get no condition.
+func inTenant(ctx context.Context, args *[]interface{}) string {
+	id, ok := tenant.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	*args = append(*args, id)
+	return " AND tenant_id = $" + strconv.Itoa(len(*args))
+}
+
+// prefixColumns qualifies every column of a comma-separated list with a table alias
+func prefixColumns(alias, columns string) string {
+	return alias + "." + strings.ReplaceAll(columns, ", ", ", "+alias+".")
+}
+
+// inTx runs fn in a transaction, committing only if it succeeds
+func inTx(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// expectRow maps a write that touched nothing to ErrNotFound
+func expectRow(result sql.Result) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
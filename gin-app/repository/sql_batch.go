@@ -0,0 +1,136 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"gin-app/models"
+)
+
+func (r *sqlTodoRepository) Batch(ctx context.Context, userID int, ops []BatchOp, atomic bool) ([]BatchResult, error) {
+	results := make([]BatchResult, len(ops))
+	if atomic {
+		err := inTx(ctx, r.db, func(tx *sql.Tx) error {
+			for i := 0; i < len(ops); {
+				n := createRun(ops, i)
+				if n == 0 {
+					if err := r.apply(ctx, tx, userID, ops, i, results); err != nil {
+						return &BatchError{Index: i, Err: err}
+					}
+					i++
+					continue
+				}
+				todos := make([]*models.Todo, n)
+				for k := range todos {
+					todo, err := r.prepareCreate(ctx, tx, userID, ops, i+k, results)
+					if err != nil {
+						return &BatchError{Index: i + k, Err: err}
+					}
+					todos[k] = todo
+				}
+				if err := r.insert(ctx, tx, todos); err != nil {
+					return &BatchError{Index: i, Err: err}
+				}
+				i += n
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return results, nil
+	}
+
+	for i := 0; i < len(ops); {
+		n := createRun(ops, i)
+		if n == 0 {
+			results[i].Err = inTx(ctx, r.db, func(tx *sql.Tx) error {
+				return r.apply(ctx, tx, userID, ops, i, results)
+			})
+			i++
+			continue
+		}
+		r.insertRun(ctx, userID, ops, i, n, results)
+		i += n
+	}
+	return results, nil
+}
+
+// insertRun creates a run of todos of a best-effort batch in one
+// transaction, leaving out those that fail their checks. If the insert
+// itself fails, the todos are retried one at a time so that only the
+// offending ones fail.
+func (r *sqlTodoRepository) insertRun(ctx context.Context, userID int, ops []BatchOp, start, n int, results []BatchResult) {
+	var valid []int
+	err := inTx(ctx, r.db, func(tx *sql.Tx) error {
+		valid = nil
+		todos := []*models.Todo{}
+		for i := start; i < start+n; i++ {
+			todo, err := r.prepareCreate(ctx, tx, userID, ops, i, results)
+			results[i].Err = err
+			if err == nil {
+				valid = append(valid, i)
+				todos = append(todos, todo)
+			}
+		}
+		if len(todos) == 0 {
+			return nil
+		}
+		return r.insert(ctx, tx, todos)
+	})
+	if err == nil {
+		return
+	}
+	for _, i := range valid {
+		results[i].Err = r.Create(ctx, &results[i].Todo)
+	}
+}
+
+// prepareCreate resolves and checks the create ops[i] and returns the todo
+// to insert, which lives in its result
+func (r *sqlTodoRepository) prepareCreate(ctx context.Context, tx *sql.Tx, userID int, ops []BatchOp, i int, results []BatchResult) (*models.Todo, error) {
+	userID = ops[i].owner(userID)
+	op, err := resolve(ops[i], i, results)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.checkParent(ctx, tx, userID, 0, op.Todo.ParentID); err != nil {
+		return nil, err
+	}
+	todo := op.Todo
+	todo.UserID = userID
+	if err := r.checkList(ctx, tx, &todo); err != nil {
+		return nil, err
+	}
+	results[i].Todo = todo
+	return &results[i].Todo, nil
+}
+
+// apply runs ops[i], an operation on an existing todo
+func (r *sqlTodoRepository) apply(ctx context.Context, tx *sql.Tx, userID int, ops []BatchOp, i int, results []BatchResult) error {
+	userID = ops[i].owner(userID)
+	op, err := resolve(ops[i], i, results)
+	if err != nil {
+		return err
+	}
+	result := &results[i]
+	if result.Before, err = r.get(ctx, tx, userID, op.Todo.ID); err != nil {
+		return err
+	}
+
+	switch op.Op {
+	case BatchUpdate:
+		result.Todo = op.Todo
+		result.Todo.UserID = userID
+		return r.update(ctx, tx, &result.Todo, op.Options)
+	case BatchDelete:
+		result.Todo, err = r.delete(ctx, tx, userID, op.Todo.ID, op.Options.Version)
+		return err
+	default:
+		if err := r.addBlocker(ctx, tx, userID, op.Todo.ID, op.BlockerID); err != nil {
+			return err
+		}
+		result.Todo, err = r.get(ctx, tx, userID, op.Todo.ID)
+		return err
+	}
+}
@@ -0,0 +1,104 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"gin-app/models"
+)
+
+type sqlHistoryRepository struct {
+	db *sql.DB
+}
+
+const historyColumns = "id, todo_id, user_id, actor_id, operation, version, changes, snapshot, created_at"
+
+func scanHistoryEntry(row rowScanner) (models.HistoryEntry, error) {
+	var entry models.HistoryEntry
+	var changes, snapshot string
+	err := row.Scan(&entry.ID, &entry.TodoID, &entry.UserID, &entry.ActorID, &entry.Operation, &entry.Version, &changes, &snapshot, &entry.CreatedAt)
+	if err != nil {
+		return entry, err
+	}
+	if err := json.Unmarshal([]byte(changes), &entry.Changes); err != nil {
+		return entry, err
+	}
+	return entry, json.Unmarshal([]byte(snapshot), &entry.Snapshot)
+}
+
+func (r *sqlHistoryRepository) Append(ctx context.Context, entry *models.HistoryEntry) error {
+	return appendHistory(ctx, r.db, entry)
+}
+
+// appendHistory adds entry to the history, in the transaction of the change
+// when q is one
+func appendHistory(ctx context.Context, q querier, entry *models.HistoryEntry) error {
+	changes, err := json.Marshal(entry.Changes)
+	if err != nil {
+		return err
+	}
+	snapshot, err := json.Marshal(entry.Snapshot)
+	if err != nil {
+		return err
+	}
+
+	entry.CreatedAt = entry.CreatedAt.UTC().Truncate(time.Microsecond)
+	return q.QueryRowContext(ctx, `INSERT INTO todo_history (todo_id, user_id, actor_id, operation, version, changes, snapshot, created_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id`,
+		entry.TodoID, entry.UserID, entry.ActorID, entry.Operation, entry.Version, string(changes), string(snapshot), entry.CreatedAt).
+		Scan(&entry.ID)
+}
+
+func (r *sqlHistoryRepository) List(ctx context.Context, userID, todoID, beforeID, limit int) ([]models.HistoryEntry, error) {
+	stmt := "SELECT " + historyColumns + " FROM todo_history WHERE todo_id = $1 AND user_id = $2"
+	args := []interface{}{todoID, userID, limit}
+	if beforeID > 0 {
+		stmt += " AND id < $4"
+		args = append(args, beforeID)
+	}
+	entries, err := r.query(ctx, stmt+" ORDER BY id DESC LIMIT $3", args...)
+	if err != nil || len(entries) > 0 || beforeID > 0 {
+		return entries, err
+	}
+
+	// Todos created before history was kept have none
+	var found int
+	err = r.db.QueryRowContext(ctx, "SELECT id FROM todos WHERE id = $1 AND user_id = $2", todoID, userID).Scan(&found)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return entries, err
+}
+
+func (r *sqlHistoryRepository) Version(ctx context.Context, userID, todoID, version int) (models.HistoryEntry, error) {
+	entries, err := r.query(ctx, "SELECT "+historyColumns+" FROM todo_history WHERE todo_id = $1 AND user_id = $2 AND version = $3 ORDER BY id DESC LIMIT 1",
+		todoID, userID, version)
+	if err != nil {
+		return models.HistoryEntry{}, err
+	}
+	if len(entries) == 0 {
+		return models.HistoryEntry{}, ErrNotFound
+	}
+	return entries[0], nil
+}
+
+func (r *sqlHistoryRepository) query(ctx context.Context, stmt string, args ...interface{}) ([]models.HistoryEntry, error) {
+	rows, err := r.db.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []models.HistoryEntry{}
+	for rows.Next() {
+		entry, err := scanHistoryEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
@@ -0,0 +1,253 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"gin-app/models"
+)
+
+type sqlListRepository struct {
+	db          *sql.DB
+	isDuplicate func(error) bool
+}
+
+// listSelect reads lists with the role of the user in $1, who owns them or
+// is a member
+const listSelect = `SELECT l.id, l.owner_id, l.name, CASE WHEN l.owner_id = $1 THEN 'owner' ELSE m.role END, l.created_at
+FROM lists l LEFT JOIN list_members m ON m.list_id = l.id AND m.user_id = $1
+WHERE (l.owner_id = $1 OR m.user_id IS NOT NULL)`
+
+const inviteSelect = `SELECT i.id, i.list_id, l.name, i.email, i.role, i.invited_by, i.created_at
+FROM list_invites i JOIN lists l ON l.id = i.list_id`
+
+func scanList(row rowScanner) (models.List, error) {
+	var list models.List
+	err := row.Scan(&list.ID, &list.OwnerID, &list.Name, &list.Role, &list.CreatedAt)
+	return list, err
+}
+
+func scanInvite(row rowScanner) (models.ListInvite, error) {
+	var invite models.ListInvite
+	err := row.Scan(&invite.ID, &invite.ListID, &invite.ListName, &invite.Email, &invite.Role, &invite.InvitedBy, &invite.CreatedAt)
+	return invite, err
+}
+
+func (r *sqlListRepository) List(ctx context.Context, userID int) ([]models.List, error) {
+	rows, err := r.db.QueryContext(ctx, listSelect+" ORDER BY l.id", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lists := []models.List{}
+	for rows.Next() {
+		list, err := scanList(rows)
+		if err != nil {
+			return nil, err
+		}
+		lists = append(lists, list)
+	}
+	return lists, rows.Err()
+}
+
+func (r *sqlListRepository) Get(ctx context.Context, userID, id int) (models.List, error) {
+	return r.get(ctx, r.db, userID, id)
+}
+
+func (r *sqlListRepository) get(ctx context.Context, q querier, userID, id int) (models.List, error) {
+	list, err := scanList(q.QueryRowContext(ctx, listSelect+" AND l.id = $2", userID, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return list, ErrNotFound
+	}
+	return list, err
+}
+
+func (r *sqlListRepository) Create(ctx context.Context, list *models.List) error {
+	list.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+	list.Role = models.RoleOwner
+	return r.db.QueryRowContext(ctx, "INSERT INTO lists (owner_id, name, created_at) VALUES ($1, $2, $3) RETURNING id",
+		list.OwnerID, list.Name, list.CreatedAt).
+		Scan(&list.ID)
+}
+
+func (r *sqlListRepository) Rename(ctx context.Context, id int, name string) error {
+	result, err := r.db.ExecContext(ctx, "UPDATE lists SET name = $1 WHERE id = $2", name, id)
+	if err != nil {
+		return err
+	}
+	return expectRow(result)
+}
+
+func (r *sqlListRepository) Delete(ctx context.Context, id int) error {
+	return inTx(ctx, r.db, func(tx *sql.Tx) error {
+		// Explicit because the SQLite schema has no foreign key on list_id
+		now := time.Now().UTC().Truncate(time.Microsecond)
+		_, err := tx.ExecContext(ctx, "UPDATE todos SET list_id = NULL, updated_at = $1, version = version + 1 WHERE list_id = $2", now, id)
+		if err != nil {
+			return err
+		}
+		result, err := tx.ExecContext(ctx, "DELETE FROM lists WHERE id = $1", id)
+		if err != nil {
+			return err
+		}
+		return expectRow(result)
+	})
+}
+
+func (r *sqlListRepository) Members(ctx context.Context, id int) ([]models.ListMember, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT u.id, u.email, 'owner', 0 FROM lists l JOIN users u ON u.id = l.owner_id WHERE l.id = $1
+UNION ALL
+SELECT u.id, u.email, m.role, 1 FROM list_members m JOIN users u ON u.id = m.user_id WHERE m.list_id = $1
+ORDER BY 4, 1`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []models.ListMember{}
+	for rows.Next() {
+		var member models.ListMember
+		var rank int
+		if err := rows.Scan(&member.UserID, &member.Email, &member.Role, &rank); err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+	return members, rows.Err()
+}
+
+func (r *sqlListRepository) SetRole(ctx context.Context, id, userID int, role string) error {
+	result, err := r.db.ExecContext(ctx, "UPDATE list_members SET role = $1 WHERE list_id = $2 AND user_id = $3", role, id, userID)
+	if err != nil {
+		return err
+	}
+	return expectRow(result)
+}
+
+func (r *sqlListRepository) RemoveMember(ctx context.Context, id, userID int) error {
+	result, err := r.db.ExecContext(ctx, "DELETE FROM list_members WHERE list_id = $1 AND user_id = $2", id, userID)
+	if err != nil {
+		return err
+	}
+	return expectRow(result)
+}
+
+func (r *sqlListRepository) Invite(ctx context.Context, invite *models.ListInvite) error {
+	return inTx(ctx, r.db, func(tx *sql.Tx) error {
+		var member bool
+		err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM users u JOIN lists l ON l.id = $1 WHERE u.email = $2
+AND (u.id = l.owner_id OR EXISTS (SELECT 1 FROM list_members m WHERE m.list_id = l.id AND m.user_id = u.id)))`,
+			invite.ListID, invite.Email).Scan(&member)
+		if err != nil {
+			return err
+		}
+		if member {
+			return ErrDuplicate
+		}
+
+		var id int
+		err = tx.QueryRowContext(ctx, "INSERT INTO list_invites (list_id, email, role, invited_by, created_at) VALUES ($1, $2, $3, $4, $5) RETURNING id",
+			invite.ListID, invite.Email, invite.Role, invite.InvitedBy, time.Now().UTC().Truncate(time.Microsecond)).
+			Scan(&id)
+		if err != nil && r.isDuplicate(err) {
+			return ErrDuplicate
+		}
+		if err != nil {
+			return err
+		}
+		*invite, err = scanInvite(tx.QueryRowContext(ctx, inviteSelect+" WHERE i.id = $1", id))
+		return err
+	})
+}
+
+func (r *sqlListRepository) Invites(ctx context.Context, id int) ([]models.ListInvite, error) {
+	return r.queryInvites(ctx, inviteSelect+" WHERE i.list_id = $1 ORDER BY i.id", id)
+}
+
+func (r *sqlListRepository) RevokeInvite(ctx context.Context, id, inviteID int) error {
+	result, err := r.db.ExecContext(ctx, "DELETE FROM list_invites WHERE id = $1 AND list_id = $2", inviteID, id)
+	if err != nil {
+		return err
+	}
+	return expectRow(result)
+}
+
+func (r *sqlListRepository) Invitations(ctx context.Context, email string) ([]models.ListInvite, error) {
+	return r.queryInvites(ctx, inviteSelect+" WHERE i.email = $1 ORDER BY i.id", email)
+}
+
+func (r *sqlListRepository) Accept(ctx context.Context, user models.User, inviteID int) (models.List, error) {
+	var list models.List
+	err := inTx(ctx, r.db, func(tx *sql.Tx) error {
+		invite, err := scanInvite(tx.QueryRowContext(ctx, inviteSelect+" WHERE i.id = $1 AND i.email = $2", inviteID, user.Email))
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		// The owner's account is a member already, and accepting a second
+		// invitation changes the role
+		var ownerID int
+		if err := tx.QueryRowContext(ctx, "SELECT owner_id FROM lists WHERE id = $1", invite.ListID).Scan(&ownerID); err != nil {
+			return err
+		}
+		if ownerID != user.ID {
+			_, err = tx.ExecContext(ctx, `INSERT INTO list_members (list_id, user_id, role, created_at) VALUES ($1, $2, $3, $4)
+ON CONFLICT (list_id, user_id) DO UPDATE SET role = excluded.role`,
+				invite.ListID, user.ID, invite.Role, time.Now().UTC().Truncate(time.Microsecond))
+			if err != nil {
+				return err
+			}
+		}
+		if _, err := tx.ExecContext(ctx, "DELETE FROM list_invites WHERE id = $1", inviteID); err != nil {
+			return err
+		}
+		list, err = r.get(ctx, tx, user.ID, invite.ListID)
+		return err
+	})
+	return list, err
+}
+
+func (r *sqlListRepository) Decline(ctx context.Context, email string, inviteID int) error {
+	result, err := r.db.ExecContext(ctx, "DELETE FROM list_invites WHERE id = $1 AND email = $2", inviteID, email)
+	if err != nil {
+		return err
+	}
+	return expectRow(result)
+}
+
+func (r *sqlListRepository) TodoRole(ctx context.Context, userID, todoID int) (int, string, error) {
+	var ownerID int
+	var role string
+	err := r.db.QueryRowContext(ctx, `SELECT t.user_id, CASE WHEN t.user_id = $1 THEN 'owner' ELSE m.role END
+FROM todos t LEFT JOIN list_members m ON m.list_id = t.list_id AND m.user_id = $1
+WHERE t.id = $2 AND (t.user_id = $1 OR m.user_id IS NOT NULL)`, userID, todoID).
+		Scan(&ownerID, &role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, "", ErrNotFound
+	}
+	return ownerID, role, err
+}
+
+func (r *sqlListRepository) queryInvites(ctx context.Context, stmt string, args ...interface{}) ([]models.ListInvite, error) {
+	rows, err := r.db.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invites := []models.ListInvite{}
+	for rows.Next() {
+		invite, err := scanInvite(rows)
+		if err != nil {
+			return nil, err
+		}
+		invites = append(invites, invite)
+	}
+	return invites, rows.Err()
+}
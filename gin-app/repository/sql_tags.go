@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"gin-app/models"
+)
+
+type sqlTagRepository struct {
+	db          *sql.DB
+	isDuplicate func(error) bool
+}
+
+func (r *sqlTagRepository) List(ctx context.Context, userID int) ([]models.Tag, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT t.id, t.name, COUNT(tt.todo_id) FROM tags t
+LEFT JOIN todo_tags tt ON tt.tag_id = t.id
+WHERE t.user_id = $1 GROUP BY t.id, t.name ORDER BY t.name`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []models.Tag{}
+	for rows.Next() {
+		var tag models.Tag
+		if err := rows.Scan(&tag.ID, &tag.Name, &tag.TodoCount); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
+
+func (r *sqlTagRepository) Rename(ctx context.Context, userID, id int, name string) (models.Tag, error) {
+	result, err := r.db.ExecContext(ctx, "UPDATE tags SET name = $1 WHERE id = $2 AND user_id = $3", NormalizeTag(name), id, userID)
+	if err != nil {
+		if r.isDuplicate(err) {
+			return models.Tag{}, ErrDuplicate
+		}
+		return models.Tag{}, err
+	}
+	if err := expectRow(result); err != nil {
+		return models.Tag{}, err
+	}
+	return r.get(ctx, r.db, userID, id)
+}
+
+func (r *sqlTagRepository) Merge(ctx context.Context, userID, sourceID, targetID int) (models.Tag, error) {
+	var tag models.Tag
+	err := inTx(ctx, r.db, func(tx *sql.Tx) error {
+		var owned int
+		err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM tags WHERE user_id = $1 AND id IN ($2, $3)", userID, sourceID, targetID).Scan(&owned)
+		if err != nil {
+			return err
+		}
+		if owned != 2 {
+			return ErrNotFound
+		}
+
+		_, err = tx.ExecContext(ctx, `INSERT INTO todo_tags (todo_id, tag_id)
+SELECT todo_id, $1 FROM todo_tags WHERE tag_id = $2
+ON CONFLICT (todo_id, tag_id) DO NOTHING`, targetID, sourceID)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "DELETE FROM tags WHERE id = $1", sourceID); err != nil {
+			return err
+		}
+
+		tag, err = r.get(ctx, tx, userID, targetID)
+		return err
+	})
+	return tag, err
+}
+
+func (r *sqlTagRepository) get(ctx context.Context, q querier, userID, id int) (models.Tag, error) {
+	var tag models.Tag
+	err := q.QueryRowContext(ctx, `SELECT t.id, t.name, (SELECT COUNT(*) FROM todo_tags tt WHERE tt.tag_id = t.id)
+FROM tags t WHERE t.id = $1 AND t.user_id = $2`, id, userID).Scan(&tag.ID, &tag.Name, &tag.TodoCount)
+	if errors.Is(err, sql.ErrNoRows) {
+		return tag, ErrNotFound
+	}
+	return tag, err
+}
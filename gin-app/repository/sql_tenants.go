@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"gin-app/models"
+	"gin-app/tenant"
+)
+
+type sqlTenantRepository struct {
+	db          *sql.DB
+	isDuplicate func(error) bool
+	// isolated is set where row-level security keeps tenants apart
+	isolated bool
+}
+
+const tenantColumns = "id, name, suspended_at, created_at"
+
+func scanTenant(row rowScanner) (models.Tenant, error) {
+	var tenant models.Tenant
+	var suspendedAt sql.NullTime
+	err := row.Scan(&tenant.ID, &tenant.Name, &suspendedAt, &tenant.CreatedAt)
+	if suspendedAt.Valid {
+		tenant.SuspendedAt = &suspendedAt.Time
+	}
+	return tenant, err
+}
+
+func (r *sqlTenantRepository) List(ctx context.Context) ([]models.Tenant, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT "+tenantColumns+" FROM tenants ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tenants := []models.Tenant{}
+	for rows.Next() {
+		tenant, err := scanTenant(rows)
+		if err != nil {
+			return nil, err
+		}
+		tenants = append(tenants, tenant)
+	}
+	return tenants, rows.Err()
+}
+
+func (r *sqlTenantRepository) Get(ctx context.Context, id int) (models.Tenant, error) {
+	return r.get(ctx, "id", id)
+}
+
+func (r *sqlTenantRepository) GetByName(ctx context.Context, name string) (models.Tenant, error) {
+	return r.get(ctx, "name", name)
+}
+
+func (r *sqlTenantRepository) get(ctx context.Context, column string, value interface{}) (models.Tenant, error) {
+	tenant, err := scanTenant(r.db.QueryRowContext(ctx, "SELECT "+tenantColumns+" FROM tenants WHERE "+column+" = $1", value))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Tenant{}, ErrNotFound
+	}
+	return tenant, err
+}
+
+func (r *sqlTenantRepository) Create(ctx context.Context, t *models.Tenant, admin *models.User) error {
+	if !r.isolated {
+		return ErrTenantsUnsupported
+	}
+	t.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+	return inTx(ctx, r.db, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, "INSERT INTO tenants (name, created_at) VALUES ($1, $2) RETURNING id", t.Name, t.CreatedAt).
+			Scan(&t.ID)
+		if err != nil {
+			if r.isDuplicate(err) {
+				return ErrDuplicate
+			}
+			return err
+		}
+
+		// Row-level security accepts the admin only from a session acting
+		// for the new tenant
+		admin.TenantID = t.ID
+		return createUser(tenant.With(ctx, t.ID), tx, r.isDuplicate, admin)
+	})
+}
+
+func (r *sqlTenantRepository) SetSuspended(ctx context.Context, id int, suspended bool) (models.Tenant, error) {
+	var result sql.Result
+	var err error
+	if suspended {
+		// Suspending again keeps the time of the first suspension
+		result, err = r.db.ExecContext(ctx, "UPDATE tenants SET suspended_at = COALESCE(suspended_at, $1) WHERE id = $2",
+			time.Now().UTC().Truncate(time.Microsecond), id)
+	} else {
+		result, err = r.db.ExecContext(ctx, "UPDATE tenants SET suspended_at = NULL WHERE id = $1", id)
+	}
+	if err != nil {
+		return models.Tenant{}, err
+	}
+	if err := expectRow(result); err != nil {
+		return models.Tenant{}, err
+	}
+	return r.Get(ctx, id)
+}
@@ -0,0 +1,999 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"gin-app/audit"
+	"gin-app/models"
+)
+
+type sqlTodoRepository struct {
+	db *sql.DB
+	// ilike is the case-insensitive LIKE operator of the dialect
+	ilike string
+	// lockUser serialises changes to one user's todo graph, so two concurrent
+	// links cannot together form a cycle that neither would form alone
+	lockUser string
+}
+
+const todoColumns = "id, user_id, title, description, completed, priority, due_at, created_at, updated_at, completed_at, parent_id, recurrence, series_id, occurrence_at, deleted_at, version, list_id"
+
+func scanTodo(row rowScanner) (models.Todo, error) {
+	var todo models.Todo
+	err := row.Scan(&todo.ID, &todo.UserID, &todo.Title, &todo.Description, &todo.Completed,
+		&todo.Priority, &todo.DueAt, &todo.CreatedAt, &todo.UpdatedAt, &todo.CompletedAt, &todo.ParentID,
+		&todo.Recurrence, &todo.SeriesID, &todo.OccurrenceAt, &todo.DeletedAt, &todo.Version, &todo.ListID)
+	return todo, err
+}
+
+// sortColumns maps TodoQuery.Sort to the column compared for keyset paging
+var sortColumns = map[string]string{
+	SortID:        "id",
+	SortTitle:     "title",
+	SortCreatedAt: "created_at",
+}
+
+func (r *sqlTodoRepository) List(ctx context.Context, userID int, query TodoQuery) ([]models.Todo, bool, error) {
+	column, ok := sortColumns[query.Sort]
+	if !ok {
+		column = "id"
+	}
+
+	where := []string{"deleted_at IS NULL"}
+	args := []interface{}{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if !query.AllUsers {
+		where = append(where, "user_id = "+arg(userID))
+	}
+
+	if query.Completed != nil {
+		where = append(where, "completed = "+arg(*query.Completed))
+	}
+	if query.Search != "" {
+		where = append(where, fmt.Sprintf(`title %s %s ESCAPE '\'`, r.ilike, arg("%"+escapeLike(query.Search)+"%")))
+	}
+	if query.Priority != nil {
+		where = append(where, "priority = "+arg(*query.Priority))
+	}
+	if query.DueAfter != nil {
+		where = append(where, "due_at >= "+arg(query.DueAfter.UTC()))
+	}
+	if query.DueBefore != nil {
+		where = append(where, "due_at <= "+arg(query.DueBefore.UTC()))
+	}
+	if query.ListID != nil {
+		where = append(where, "list_id = "+arg(*query.ListID))
+	}
+	if query.Overdue {
+		where = append(where, "completed = "+arg(false), "due_at < "+arg(query.Now.UTC()))
+	}
+	for _, tag := range query.Tags {
+		where = append(where, "EXISTS (SELECT 1 FROM todo_tags tt JOIN tags t ON t.id = tt.tag_id WHERE tt.todo_id = todos.id AND t.name = "+arg(tag)+")")
+	}
+
+	direction, cmp := "ASC", ">"
+	if query.Desc {
+		direction, cmp = "DESC", "<"
+	}
+	if after := query.After; after != nil {
+		switch column {
+		case "id":
+			where = append(where, fmt.Sprintf("id %s %s", cmp, arg(after.ID)))
+		case "title":
+			where = append(where, fmt.Sprintf("(title, id) %s (%s, %s)", cmp, arg(after.Title), arg(after.ID)))
+		case "created_at":
+			where = append(where, fmt.Sprintf("(created_at, id) %s (%s, %s)", cmp, arg(after.CreatedAt), arg(after.ID)))
+		}
+	}
+
+	order := "id " + direction
+	if column != "id" {
+		order = fmt.Sprintf("%s %s, id %s", column, direction, direction)
+	}
+
+	// Fetch one extra row to learn whether another page follows
+	stmt := fmt.Sprintf("SELECT %s FROM todos WHERE %s ORDER BY %s LIMIT %s",
+		todoColumns, strings.Join(where, " AND "), order, arg(query.Limit+1))
+	todos, err := r.queryTodos(ctx, r.db, stmt, args...)
+	if err != nil {
+		return nil, false, err
+	}
+
+	more := len(todos) > query.Limit
+	if more {
+		todos = todos[:query.Limit]
+	}
+	if err := r.loadRelations(ctx, r.db, todos); err != nil {
+		return nil, false, err
+	}
+	return todos, more, nil
+}
+
+func (r *sqlTodoRepository) Get(ctx context.Context, userID, id int) (models.Todo, error) {
+	return r.get(ctx, r.db, userID, id)
+}
+
+func (r *sqlTodoRepository) get(ctx context.Context, q querier, userID, id int) (models.Todo, error) {
+	todo, err := scanTodo(q.QueryRowContext(ctx, "SELECT "+todoColumns+" FROM todos WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL", id, userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return todo, ErrNotFound
+	}
+	if err != nil {
+		return todo, err
+	}
+
+	todos := []models.Todo{todo}
+	err = r.loadRelations(ctx, q, todos)
+	return todos[0], err
+}
+
+func (r *sqlTodoRepository) Create(ctx context.Context, todo *models.Todo) error {
+	return inTx(ctx, r.db, func(tx *sql.Tx) error {
+		if err := r.checkParent(ctx, tx, todo.UserID, 0, todo.ParentID); err != nil {
+			return err
+		}
+		if err := r.checkList(ctx, tx, todo); err != nil {
+			return err
+		}
+		return r.insert(ctx, tx, []*models.Todo{todo})
+	})
+}
+
+// insert adds todos, which the caller has checked, with multi-row
+// statements of up to maxInsertRows each and reads them back
+func (r *sqlTodoRepository) insert(ctx context.Context, tx *sql.Tx, todos []*models.Todo) error {
+	for start := 0; start < len(todos); start += maxInsertRows {
+		if err := r.insertRows(ctx, tx, todos[start:min(start+maxInsertRows, len(todos))]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// insertRows adds todos with one multi-row statement and reads them back
+func (r *sqlTodoRepository) insertRows(ctx context.Context, tx *sql.Tx, todos []*models.Todo) error {
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	args := []interface{}{now}
+	values := make([]string, len(todos))
+	for i, todo := range todos {
+		var completedAt *time.Time
+		if todo.Completed {
+			completedAt = &now
+		}
+		n := len(args)
+		values[i] = fmt.Sprintf("($%d, $%d, $%d, $%d, $%d, $%d, $1, $1, $%d, $%d, $%d, $%d)", n+1, n+2, n+3, n+4, n+5, n+6, n+7, n+8, n+9, n+10)
+		args = append(args, todo.UserID, todo.Title, todo.Description, todo.Completed, todo.Priority, utc(todo.DueAt), completedAt, todo.ParentID, todo.Recurrence, todo.ListID)
+	}
+
+	rows, err := tx.QueryContext(ctx, `INSERT INTO todos (user_id, title, description, completed, priority, due_at, created_at, updated_at, completed_at, parent_id, recurrence, list_id)
+VALUES `+strings.Join(values, ", ")+" RETURNING id", args...)
+	if err != nil {
+		return err
+	}
+	ids := []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	// RETURNING does not promise an order, but the rows of one statement
+	// take their IDs in VALUES order
+	sort.Ints(ids)
+
+	in, idArgs := inList(ids)
+	// A recurring todo starts its own series as the first occurrence
+	_, err = tx.ExecContext(ctx, "UPDATE todos SET series_id = id, occurrence_at = due_at WHERE recurrence <> '' AND id IN "+in, idArgs...)
+	if err != nil {
+		return err
+	}
+	for i, todo := range todos {
+		if err := r.setTags(ctx, tx, todo.UserID, ids[i], todo.Tags); err != nil {
+			return err
+		}
+	}
+
+	saved, err := r.queryTodos(ctx, tx, "SELECT "+todoColumns+" FROM todos WHERE id IN "+in+" ORDER BY id", idArgs...)
+	if err != nil {
+		return err
+	}
+	if err := r.loadRelations(ctx, tx, saved); err != nil {
+		return err
+	}
+	for i, todo := range todos {
+		*todo = saved[i]
+		if err := r.record(ctx, tx, models.HistoryCreate, nil, todo); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *sqlTodoRepository) Update(ctx context.Context, todo *models.Todo, opts UpdateOptions) error {
+	return inTx(ctx, r.db, func(tx *sql.Tx) error {
+		return r.update(ctx, tx, todo, opts)
+	})
+}
+
+func (r *sqlTodoRepository) update(ctx context.Context, tx *sql.Tx, todo *models.Todo, opts UpdateOptions) error {
+	if err := r.checkVersion(ctx, tx, todo.UserID, todo.ID, opts.Version); err != nil {
+		return err
+	}
+	if err := r.checkParent(ctx, tx, todo.UserID, todo.ID, todo.ParentID); err != nil {
+		return err
+	}
+	if err := r.checkParentList(ctx, tx, todo.ID, todo.ParentID); err != nil {
+		return err
+	}
+
+	operation := opts.Operation
+	if operation == "" {
+		operation = models.HistoryUpdate
+	}
+	return r.journal(ctx, tx, operation, []int{todo.ID}, func() error {
+		return r.write(ctx, tx, todo, opts)
+	})
+}
+
+// write stores the update of todo, completing its subtasks first if asked
+func (r *sqlTodoRepository) write(ctx context.Context, tx *sql.Tx, todo *models.Todo, opts UpdateOptions) error {
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	if todo.Completed {
+		if err := r.completeDescendants(ctx, tx, todo.UserID, todo.ID, now, opts.CompleteChildren); err != nil {
+			return err
+		}
+	}
+
+	// completed_at keeps its original value while the todo stays completed
+	row := tx.QueryRowContext(ctx, `UPDATE todos SET title = $1, description = $2, completed = $3, priority = $4, due_at = $5,
+	updated_at = $6, completed_at = CASE WHEN $3 THEN COALESCE(completed_at, $6) ELSE NULL END, parent_id = $7,
+	recurrence = $10, series_id = CASE WHEN series_id IS NULL AND $10 <> '' THEN id ELSE series_id END,
+	occurrence_at = CASE WHEN series_id IS NULL AND $10 <> '' THEN $5 ELSE occurrence_at END,
+	version = version + 1
+WHERE id = $8 AND user_id = $9 AND deleted_at IS NULL AND ($11 = 0 OR version = $11) RETURNING `+todoColumns,
+		todo.Title, todo.Description, todo.Completed, todo.Priority, utc(todo.DueAt), now, todo.ParentID, todo.ID, todo.UserID, todo.Recurrence, opts.Version)
+	err := r.save(ctx, tx, row, todo)
+	if errors.Is(err, ErrNotFound) && opts.Version != 0 {
+		// Changed by a concurrent writer since checkVersion
+		return ErrVersionConflict
+	}
+	return err
+}
+
+func (r *sqlTodoRepository) Delete(ctx context.Context, userID, id, version int) (models.Todo, error) {
+	var todo models.Todo
+	err := inTx(ctx, r.db, func(tx *sql.Tx) error {
+		var err error
+		todo, err = r.delete(ctx, tx, userID, id, version)
+		return err
+	})
+	return todo, err
+}
+
+func (r *sqlTodoRepository) delete(ctx context.Context, tx *sql.Tx, userID, id, version int) (models.Todo, error) {
+	if err := r.checkVersion(ctx, tx, userID, id, version); err != nil {
+		return models.Todo{}, err
+	}
+
+	// Subtasks go to the trash with their parent and share its deleted_at,
+	// which is how Restore finds them again
+	const subtree = `WITH RECURSIVE subtree (id) AS (
+	SELECT id FROM todos WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL AND ($3 = 0 OR version = $3)
+	UNION
+	SELECT t.id FROM todos t JOIN subtree s ON t.parent_id = s.id WHERE t.deleted_at IS NULL
+)
+`
+	ids, err := r.ids(ctx, tx, subtree+"SELECT id FROM subtree", id, userID, version)
+	if err != nil {
+		return models.Todo{}, err
+	}
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	err = r.journal(ctx, tx, models.HistoryDelete, ids, func() error {
+		result, err := tx.ExecContext(ctx, subtree+"UPDATE todos SET deleted_at = $4, version = version + 1 WHERE id IN (SELECT id FROM subtree)", id, userID, version, now)
+		if err != nil {
+			return err
+		}
+		return expectRow(result)
+	})
+	if errors.Is(err, ErrNotFound) && version != 0 {
+		// Changed by a concurrent writer since checkVersion
+		return models.Todo{}, ErrVersionConflict
+	}
+	if err != nil {
+		return models.Todo{}, err
+	}
+
+	todos, err := r.queryTodos(ctx, tx, "SELECT "+todoColumns+" FROM todos WHERE id = $1", id)
+	if err != nil {
+		return models.Todo{}, err
+	}
+	if err := r.loadRelations(ctx, tx, todos); err != nil {
+		return models.Todo{}, err
+	}
+	return todos[0], nil
+}
+
+func (r *sqlTodoRepository) Trash(ctx context.Context, userID int) ([]models.Todo, error) {
+	todos, err := r.queryTodos(ctx, r.db, "SELECT "+todoColumns+" FROM todos WHERE user_id = $1 AND deleted_at IS NOT NULL ORDER BY deleted_at DESC, id DESC", userID)
+	if err != nil {
+		return nil, err
+	}
+	return todos, r.loadRelations(ctx, r.db, todos)
+}
+
+func (r *sqlTodoRepository) GetDeleted(ctx context.Context, userID, id int) (models.Todo, error) {
+	todos, err := r.queryTodos(ctx, r.db, "SELECT "+todoColumns+" FROM todos WHERE id = $1 AND user_id = $2 AND deleted_at IS NOT NULL", id, userID)
+	if err != nil {
+		return models.Todo{}, err
+	}
+	if len(todos) == 0 {
+		return models.Todo{}, ErrNotFound
+	}
+	return todos[0], r.loadRelations(ctx, r.db, todos)
+}
+
+func (r *sqlTodoRepository) Restore(ctx context.Context, userID, id int) (models.Todo, error) {
+	var todo models.Todo
+	err := inTx(ctx, r.db, func(tx *sql.Tx) error {
+		var parentID *int
+		err := tx.QueryRowContext(ctx, "SELECT parent_id FROM todos WHERE id = $1 AND user_id = $2 AND deleted_at IS NOT NULL", id, userID).Scan(&parentID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if parentID != nil {
+			if err := r.owned(ctx, tx, userID, *parentID, ErrParentTrashed); err != nil {
+				return err
+			}
+		}
+
+		// Subtasks deleted on their own earlier stay in the trash
+		const subtree = `WITH RECURSIVE subtree (id) AS (
+	SELECT id FROM todos WHERE id = $1
+	UNION
+	SELECT t.id FROM todos t JOIN subtree s ON t.parent_id = s.id
+	WHERE t.deleted_at = (SELECT deleted_at FROM todos WHERE id = $1)
+)
+`
+		ids, err := r.ids(ctx, tx, subtree+"SELECT id FROM subtree", id)
+		if err != nil {
+			return err
+		}
+		err = r.journal(ctx, tx, models.HistoryRestore, ids, func() error {
+			_, err := tx.ExecContext(ctx, subtree+"UPDATE todos SET deleted_at = NULL, version = version + 1 WHERE id IN (SELECT id FROM subtree)", id)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		todo, err = r.get(ctx, tx, userID, id)
+		return err
+	})
+	return todo, err
+}
+
+func (r *sqlTodoRepository) Purge(ctx context.Context, userID, id int) error {
+	// Subtasks are deleted explicitly because the SQLite schema has no
+	// foreign key on parent_id; dependency links go through ON DELETE CASCADE.
+	// Every subtask of a todo in the trash is in the trash too.
+	const subtree = `WITH RECURSIVE subtree (id) AS (
+	SELECT id FROM todos WHERE id = $1 AND user_id = $2 AND deleted_at IS NOT NULL
+	UNION
+	SELECT t.id FROM todos t JOIN subtree s ON t.parent_id = s.id
+)
+`
+	return inTx(ctx, r.db, func(tx *sql.Tx) error {
+		ids, err := r.ids(ctx, tx, subtree+"SELECT id FROM subtree", id, userID)
+		if err != nil {
+			return err
+		}
+		return r.journal(ctx, tx, models.HistoryPurge, ids, func() error {
+			result, err := tx.ExecContext(ctx, subtree+"DELETE FROM todos WHERE id IN (SELECT id FROM subtree)", id, userID)
+			if err != nil {
+				return err
+			}
+			return expectRow(result)
+		})
+	})
+}
+
+func (r *sqlTodoRepository) EmptyTrash(ctx context.Context, userID int) (int, error) {
+	var n int64
+	err := inTx(ctx, r.db, func(tx *sql.Tx) error {
+		ids, err := r.ids(ctx, tx, "SELECT id FROM todos WHERE user_id = $1 AND deleted_at IS NOT NULL", userID)
+		if err != nil {
+			return err
+		}
+		return r.journal(ctx, tx, models.HistoryPurge, ids, func() error {
+			result, err := tx.ExecContext(ctx, "DELETE FROM todos WHERE user_id = $1 AND deleted_at IS NOT NULL", userID)
+			if err != nil {
+				return err
+			}
+			n, err = result.RowsAffected()
+			return err
+		})
+	})
+	return int(n), err
+}
+
+func (r *sqlTodoRepository) PurgeDeleted(ctx context.Context, before time.Time) (int, error) {
+	// A subtask is never deleted after its parent, so it goes no later than
+	// the parent does
+	result, err := r.db.ExecContext(ctx, "DELETE FROM todos WHERE deleted_at < $1", before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	return int(n), err
+}
+
+func (r *sqlTodoRepository) Subtree(ctx context.Context, userID, id int) ([]models.Todo, error) {
+	todos, err := r.queryTodos(ctx, r.db, `WITH RECURSIVE subtree AS (
+	SELECT `+todoColumns+`, 0 AS depth FROM todos WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL
+	UNION ALL
+	SELECT `+prefixColumns("t", todoColumns)+`, s.depth + 1 FROM todos t JOIN subtree s ON t.parent_id = s.id WHERE t.deleted_at IS NULL
+)
+SELECT `+todoColumns+` FROM subtree ORDER BY depth, id`, id, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(todos) == 0 {
+		return nil, ErrNotFound
+	}
+	return todos, r.loadRelations(ctx, r.db, todos)
+}
+
+func (r *sqlTodoRepository) AddBlocker(ctx context.Context, userID, id, blockerID int) error {
+	return inTx(ctx, r.db, func(tx *sql.Tx) error {
+		return r.addBlocker(ctx, tx, userID, id, blockerID)
+	})
+}
+
+func (r *sqlTodoRepository) addBlocker(ctx context.Context, tx *sql.Tx, userID, id, blockerID int) error {
+	if id == blockerID {
+		return ErrCycle
+	}
+	if err := r.lock(ctx, tx, userID); err != nil {
+		return err
+	}
+	if err := r.owned(ctx, tx, userID, id, ErrNotFound); err != nil {
+		return err
+	}
+	if err := r.owned(ctx, tx, userID, blockerID, ErrInvalidReference); err != nil {
+		return err
+	}
+
+	// Walk what the blocker is itself blocked by; reaching id means the new
+	// link would close a loop
+	var cycle bool
+	err := tx.QueryRowContext(ctx, `WITH RECURSIVE chain (id) AS (
+	SELECT CAST($1 AS INTEGER)
+	UNION
+	SELECT d.blocked_by_id FROM todo_dependencies d JOIN chain c ON d.todo_id = c.id
+)
+SELECT EXISTS (SELECT 1 FROM chain WHERE id = $2)`, blockerID, id).Scan(&cycle)
+	if err != nil {
+		return err
+	}
+	if cycle {
+		return ErrCycle
+	}
+
+	return r.journal(ctx, tx, models.HistoryAddBlocker, []int{id}, func() error {
+		result, err := tx.ExecContext(ctx, "INSERT INTO todo_dependencies (todo_id, blocked_by_id) VALUES ($1, $2) ON CONFLICT (todo_id, blocked_by_id) DO NOTHING", id, blockerID)
+		if err != nil {
+			return err
+		}
+		if n, err := result.RowsAffected(); err != nil || n == 0 {
+			return err
+		}
+		return r.bumpVersion(ctx, tx, id)
+	})
+}
+
+func (r *sqlTodoRepository) RemoveBlocker(ctx context.Context, userID, id, blockerID int) error {
+	return inTx(ctx, r.db, func(tx *sql.Tx) error {
+		return r.journal(ctx, tx, models.HistoryRemoveBlocker, []int{id}, func() error {
+			result, err := tx.ExecContext(ctx, `DELETE FROM todo_dependencies WHERE todo_id = $1 AND blocked_by_id = $2
+AND todo_id IN (SELECT id FROM todos WHERE user_id = $3 AND deleted_at IS NULL)`, id, blockerID, userID)
+			if err != nil {
+				return err
+			}
+			if err := expectRow(result); err != nil {
+				return err
+			}
+			return r.bumpVersion(ctx, tx, id)
+		})
+	})
+}
+
+func (r *sqlTodoRepository) LatestOccurrence(ctx context.Context, userID, seriesID int) (models.Todo, error) {
+	todos, err := r.queryTodos(ctx, r.db, "SELECT "+todoColumns+" FROM todos WHERE series_id = $1 AND user_id = $2 AND deleted_at IS NULL ORDER BY occurrence_at DESC LIMIT 1",
+		seriesID, userID)
+	if err != nil {
+		return models.Todo{}, err
+	}
+	if len(todos) == 0 {
+		return models.Todo{}, ErrNotFound
+	}
+	return todos[0], r.loadRelations(ctx, r.db, todos)
+}
+
+func (r *sqlTodoRepository) LatestOccurrences(ctx context.Context) ([]models.Todo, error) {
+	// A deleted occurrence still holds its slot in the series, so the
+	// scheduler skips rather than recreates it
+	return r.queryTodos(ctx, r.db, `SELECT `+todoColumns+` FROM todos t WHERE recurrence <> '' AND deleted_at IS NULL
+AND occurrence_at = (SELECT MAX(o.occurrence_at) FROM todos o WHERE o.series_id = t.series_id AND o.deleted_at IS NULL)
+ORDER BY id`)
+}
+
+func (r *sqlTodoRepository) CreateOccurrence(ctx context.Context, template models.Todo, at time.Time) (models.Todo, bool, error) {
+	var todo models.Todo
+	created := false
+	err := inTx(ctx, r.db, func(tx *sql.Tx) error {
+		now := time.Now().UTC().Truncate(time.Microsecond)
+		var id int
+		err := tx.QueryRowContext(ctx, `INSERT INTO todos (user_id, title, description, completed, priority, due_at, created_at, updated_at, parent_id, recurrence, series_id, occurrence_at, list_id)
+VALUES ($1, $2, $3, FALSE, $4, $5, $6, $6, $7, $8, $9, $5, $10)
+ON CONFLICT (series_id, occurrence_at) DO NOTHING RETURNING id`,
+			template.UserID, template.Title, template.Description, template.Priority, at.UTC(), now, template.ParentID, template.Recurrence, template.SeriesID, template.ListID).Scan(&id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		created = true
+		_, err = tx.ExecContext(ctx, "INSERT INTO todo_tags (todo_id, tag_id) SELECT $1, tag_id FROM todo_tags WHERE todo_id = $2", id, template.ID)
+		if err != nil {
+			return err
+		}
+		if todo, err = r.get(ctx, tx, template.UserID, id); err != nil {
+			return err
+		}
+		return r.record(ctx, tx, models.HistoryCreate, nil, &todo)
+	})
+	return todo, created, err
+}
+
+func (r *sqlTodoRepository) Move(ctx context.Context, userID, id int, listID *int) (models.Todo, error) {
+	var todo models.Todo
+	err := inTx(ctx, r.db, func(tx *sql.Tx) error {
+		if err := r.lock(ctx, tx, userID); err != nil {
+			return err
+		}
+		current, err := r.get(ctx, tx, userID, id)
+		if err != nil {
+			return err
+		}
+		if current.ParentID != nil {
+			return ErrListMismatch
+		}
+		if listID != nil {
+			if err := r.ownsList(ctx, tx, userID, *listID); err != nil {
+				return err
+			}
+		}
+		if sameList(current.ListID, listID) {
+			todo = current
+			return nil
+		}
+
+		// Subtasks in the trash move too, so that they are restored into
+		// their parent's list
+		const subtree = `WITH RECURSIVE subtree (id) AS (
+	SELECT CAST($1 AS INTEGER)
+	UNION
+	SELECT t.id FROM todos t JOIN subtree s ON t.parent_id = s.id
+)
+`
+		ids, err := r.ids(ctx, tx, subtree+"SELECT id FROM subtree", id)
+		if err != nil {
+			return err
+		}
+		now := time.Now().UTC().Truncate(time.Microsecond)
+		err = r.journal(ctx, tx, models.HistoryMove, ids, func() error {
+			_, err := tx.ExecContext(ctx, subtree+"UPDATE todos SET list_id = $2, updated_at = $3, version = version + 1 WHERE id IN (SELECT id FROM subtree)", id, listID, now)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		todo, err = r.get(ctx, tx, userID, id)
+		return err
+	})
+	return todo, err
+}
+
+// checkList places a new todo: a subtask goes in its parent's list, which
+// todo.ListID must match when it is set, and the list must be the user's
+func (r *sqlTodoRepository) checkList(ctx context.Context, tx *sql.Tx, todo *models.Todo) error {
+	if todo.ParentID != nil {
+		var parentList *int
+		if err := tx.QueryRowContext(ctx, "SELECT list_id FROM todos WHERE id = $1", *todo.ParentID).Scan(&parentList); err != nil {
+			return err
+		}
+		if todo.ListID == nil {
+			todo.ListID = parentList
+		} else if !sameList(todo.ListID, parentList) {
+			return ErrListMismatch
+		}
+	}
+	if todo.ListID == nil {
+		return nil
+	}
+	return r.ownsList(ctx, tx, todo.UserID, *todo.ListID)
+}
+
+// checkParentList verifies that a todo being moved under parentID is in
+// the same list as its new parent
+func (r *sqlTodoRepository) checkParentList(ctx context.Context, tx *sql.Tx, id int, parentID *int) error {
+	if parentID == nil {
+		return nil
+	}
+	var list, parentList *int
+	err := tx.QueryRowContext(ctx, "SELECT (SELECT list_id FROM todos WHERE id = $1), (SELECT list_id FROM todos WHERE id = $2)", id, *parentID).
+		Scan(&list, &parentList)
+	if err != nil {
+		return err
+	}
+	if !sameList(list, parentList) {
+		return ErrListMismatch
+	}
+	return nil
+}
+
+// ownsList returns ErrInvalidList unless listID is one of the user's lists
+func (r *sqlTodoRepository) ownsList(ctx context.Context, q querier, userID, listID int) error {
+	var found int
+	err := q.QueryRowContext(ctx, "SELECT id FROM lists WHERE id = $1 AND owner_id = $2", listID, userID).Scan(&found)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrInvalidList
+	}
+	return err
+}
+
+// checkParent verifies that parentID names one of the user's todos and that
+// it is neither id itself nor one of id's descendants
+func (r *sqlTodoRepository) checkParent(ctx context.Context, tx *sql.Tx, userID, id int, parentID *int) error {
+	if parentID == nil {
+		return nil
+	}
+	if *parentID == id {
+		return ErrCycle
+	}
+	if err := r.lock(ctx, tx, userID); err != nil {
+		return err
+	}
+	if err := r.owned(ctx, tx, userID, *parentID, ErrInvalidReference); err != nil {
+		return err
+	}
+	if id == 0 {
+		return nil
+	}
+
+	var cycle bool
+	err := tx.QueryRowContext(ctx, `WITH RECURSIVE descendants (id) AS (
+	SELECT id FROM todos WHERE parent_id = $1
+	UNION
+	SELECT t.id FROM todos t JOIN descendants d ON t.parent_id = d.id
+)
+SELECT EXISTS (SELECT 1 FROM descendants WHERE id = $2)`, id, *parentID).Scan(&cycle)
+	if err != nil {
+		return err
+	}
+	if cycle {
+		return ErrCycle
+	}
+	return nil
+}
+
+// completeDescendants completes the open subtasks of id at any depth, or
+// reports ErrOpenChildren when cascade is false and some are open
+func (r *sqlTodoRepository) completeDescendants(ctx context.Context, tx *sql.Tx, userID, id int, now time.Time, cascade bool) error {
+	const descendants = `WITH RECURSIVE descendants (id) AS (
+	SELECT id FROM todos WHERE parent_id = $1 AND user_id = $2 AND deleted_at IS NULL
+	UNION
+	SELECT t.id FROM todos t JOIN descendants d ON t.parent_id = d.id WHERE t.deleted_at IS NULL
+)
+`
+	open, err := r.ids(ctx, tx, descendants+"SELECT id FROM todos WHERE id IN (SELECT id FROM descendants) AND NOT completed", id, userID)
+	if err != nil {
+		return err
+	}
+	if len(open) > 0 && !cascade {
+		return ErrOpenChildren
+	}
+
+	return r.journal(ctx, tx, models.HistoryUpdate, open, func() error {
+		_, err := tx.ExecContext(ctx, descendants+`UPDATE todos SET completed = TRUE, completed_at = $3, updated_at = $3, version = version + 1
+WHERE id IN (SELECT id FROM descendants) AND NOT completed`, id, userID, now)
+		return err
+	})
+}
+
+// checkVersion returns ErrVersionConflict unless the todo is at version, or
+// ErrNotFound when it does not exist. A zero version matches any.
+func (r *sqlTodoRepository) checkVersion(ctx context.Context, q querier, userID, id, version int) error {
+	if version == 0 {
+		return nil
+	}
+	var current int
+	err := q.QueryRowContext(ctx, "SELECT version FROM todos WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL", id, userID).Scan(&current)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if current != version {
+		return ErrVersionConflict
+	}
+	return nil
+}
+
+// journal runs write, which changes the todos ids, and records the change
+// to each of them in its history as operation, in the same transaction
+func (r *sqlTodoRepository) journal(ctx context.Context, tx *sql.Tx, operation string, ids []int, write func() error) error {
+	if _, ok := audit.Actor(ctx); !ok {
+		return write()
+	}
+	before, err := r.byID(ctx, tx, ids)
+	if err != nil {
+		return err
+	}
+	if err := write(); err != nil {
+		return err
+	}
+	after, err := r.byID(ctx, tx, ids)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		b, bok := before[id]
+		a, aok := after[id]
+		switch {
+		case bok && aok:
+			err = r.record(ctx, tx, operation, &b, &a)
+		case bok:
+			err = r.record(ctx, tx, operation, &b, nil)
+		case aok:
+			err = r.record(ctx, tx, operation, nil, &a)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// record appends a change to a todo to its history in tx, and queues the
+// events announcing it for webhooks
+func (r *sqlTodoRepository) record(ctx context.Context, tx *sql.Tx, operation string, before, after *models.Todo) error {
+	entry, ok, err := historyEntry(ctx, operation, before, after)
+	if !ok {
+		return err
+	}
+	if err := appendHistory(ctx, tx, &entry); err != nil {
+		return err
+	}
+	for _, event := range todoEvents(operation, before, after) {
+		if err := enqueue(ctx, tx, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// byID returns the todos ids, in or out of the trash, by ID
+func (r *sqlTodoRepository) byID(ctx context.Context, q querier, ids []int) (map[int]models.Todo, error) {
+	byID := map[int]models.Todo{}
+	for start := 0; start < len(ids); start += maxInListIDs {
+		in, args := inList(ids[start:min(start+maxInListIDs, len(ids))])
+		todos, err := r.queryTodos(ctx, q, "SELECT "+todoColumns+" FROM todos WHERE id IN "+in, args...)
+		if err != nil {
+			return nil, err
+		}
+		if err := r.loadRelations(ctx, q, todos); err != nil {
+			return nil, err
+		}
+		for _, todo := range todos {
+			byID[todo.ID] = todo
+		}
+	}
+	return byID, nil
+}
+
+// ids returns the IDs a query selects
+func (r *sqlTodoRepository) ids(ctx context.Context, q querier, query string, args ...interface{}) ([]int, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// inList returns an IN list of placeholders for ids, and its arguments
+func inList(ids []int) (string, []interface{}) {
+	placeholders := make([]string, len(ids))
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+		args[i] = id
+	}
+	return "(" + strings.Join(placeholders, ", ") + ")", args
+}
+
+// bumpVersion marks a todo as changed when only its links were written
+func (r *sqlTodoRepository) bumpVersion(ctx context.Context, tx *sql.Tx, id int) error {
+	_, err := tx.ExecContext(ctx, "UPDATE todos SET version = version + 1 WHERE id = $1", id)
+	return err
+}
+
+// owned returns missing unless id is one of the user's todos outside the trash
+func (r *sqlTodoRepository) owned(ctx context.Context, q querier, userID, id int, missing error) error {
+	var found int
+	err := q.QueryRowContext(ctx, "SELECT id FROM todos WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL", id, userID).Scan(&found)
+	if errors.Is(err, sql.ErrNoRows) {
+		return missing
+	}
+	return err
+}
+
+// lock takes the per-user lock on dialects that need one
+func (r *sqlTodoRepository) lock(ctx context.Context, tx *sql.Tx, userID int) error {
+	if r.lockUser == "" {
+		return nil
+	}
+	_, err := tx.ExecContext(ctx, r.lockUser, userID)
+	return err
+}
+
+// save scans the row written by an UPDATE ... RETURNING into todo, replaces
+// the todo's tag links with todo.Tags and loads its relations
+func (r *sqlTodoRepository) save(ctx context.Context, tx *sql.Tx, row *sql.Row, todo *models.Todo) error {
+	saved, err := scanTodo(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if err := r.setTags(ctx, tx, saved.UserID, saved.ID, todo.Tags); err != nil {
+		return err
+	}
+
+	todos := []models.Todo{saved}
+	if err := r.loadRelations(ctx, tx, todos); err != nil {
+		return err
+	}
+	*todo = todos[0]
+	return nil
+}
+
+// setTags replaces a todo's tag links with the named tags, creating missing ones
+func (r *sqlTodoRepository) setTags(ctx context.Context, tx *sql.Tx, userID, todoID int, names []string) error {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM todo_tags WHERE todo_id = $1", todoID); err != nil {
+		return err
+	}
+	for _, name := range normalizeTags(names) {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO tags (user_id, name) VALUES ($1, $2) ON CONFLICT (user_id, name) DO NOTHING", userID, name); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, "INSERT INTO todo_tags (todo_id, tag_id) SELECT $1, id FROM tags WHERE user_id = $2 AND name = $3",
+			todoID, userID, name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *sqlTodoRepository) queryTodos(ctx context.Context, q querier, stmt string, args ...interface{}) ([]models.Todo, error) {
+	rows, err := q.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	todos := []models.Todo{}
+	for rows.Next() {
+		todo, err := scanTodo(rows)
+		if err != nil {
+			return nil, err
+		}
+		todos = append(todos, todo)
+	}
+	return todos, rows.Err()
+}
+
+// loadRelations fills in the tags and blockers of todos, one query each
+// per maxInListIDs todos
+func (r *sqlTodoRepository) loadRelations(ctx context.Context, q querier, todos []models.Todo) error {
+	for start := 0; start < len(todos); start += maxInListIDs {
+		if err := r.loadRelationsOf(ctx, q, todos[start:min(start+maxInListIDs, len(todos))]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *sqlTodoRepository) loadRelationsOf(ctx context.Context, q querier, todos []models.Todo) error {
+
+	byID := map[int]*models.Todo{}
+	placeholders := make([]string, len(todos))
+	args := make([]interface{}, len(todos))
+	for i := range todos {
+		todos[i].Tags = []string{}
+		todos[i].BlockedBy = []int{}
+		byID[todos[i].ID] = &todos[i]
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+		args[i] = todos[i].ID
+	}
+	in := "(" + strings.Join(placeholders, ", ") + ")"
+
+	rows, err := q.QueryContext(ctx, "SELECT tt.todo_id, t.name FROM todo_tags tt JOIN tags t ON t.id = tt.tag_id WHERE tt.todo_id IN "+in+" ORDER BY t.name", args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var todoID int
+		var name string
+		if err := rows.Scan(&todoID, &name); err != nil {
+			return err
+		}
+		byID[todoID].Tags = append(byID[todoID].Tags, name)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	rows, err = q.QueryContext(ctx, `SELECT d.todo_id, d.blocked_by_id, b.completed FROM todo_dependencies d
+JOIN todos b ON b.id = d.blocked_by_id WHERE d.todo_id IN `+in+" AND b.deleted_at IS NULL ORDER BY d.blocked_by_id", args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var todoID, blockerID int
+		var done bool
+		if err := rows.Scan(&todoID, &blockerID, &done); err != nil {
+			return err
+		}
+		todo := byID[todoID]
+		todo.BlockedBy = append(todo.BlockedBy, blockerID)
+		todo.Blocked = todo.Blocked || !done
+	}
+	return rows.Err()
+}
@@ -0,0 +1,206 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gin-app/models"
+)
+
+type sqlWebhookRepository struct {
+	db *sql.DB
+}
+
+const (
+	webhookColumns  = "id, user_id, url, events, active, created_at"
+	deliveryColumns = "id, webhook_id, event, payload, status, attempts, next_attempt_at, last_status_code, last_error, created_at, updated_at"
+)
+
+func scanWebhook(row rowScanner) (models.Webhook, error) {
+	var webhook models.Webhook
+	var events string
+	err := row.Scan(&webhook.ID, &webhook.UserID, &webhook.URL, &events, &webhook.Active, &webhook.CreatedAt)
+	webhook.Events = strings.Split(events, ",")
+	return webhook, err
+}
+
+func scanDelivery(row rowScanner, extra ...interface{}) (models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+	var payload string
+	dest := []interface{}{&delivery.ID, &delivery.WebhookID, &delivery.Event, &payload, &delivery.Status, &delivery.Attempts,
+		&delivery.NextAttemptAt, &delivery.LastStatusCode, &delivery.LastError, &delivery.CreatedAt, &delivery.UpdatedAt}
+	err := row.Scan(append(dest, extra...)...)
+	delivery.Payload = []byte(payload)
+	return delivery, err
+}
+
+func (r *sqlWebhookRepository) List(ctx context.Context, userID int) ([]models.Webhook, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT "+webhookColumns+" FROM webhooks WHERE user_id = $1 ORDER BY id", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := []models.Webhook{}
+	for rows.Next() {
+		webhook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	return webhooks, rows.Err()
+}
+
+func (r *sqlWebhookRepository) Get(ctx context.Context, userID, id int) (models.Webhook, error) {
+	webhook, err := scanWebhook(r.db.QueryRowContext(ctx, "SELECT "+webhookColumns+" FROM webhooks WHERE id = $1 AND user_id = $2", id, userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return webhook, ErrNotFound
+	}
+	return webhook, err
+}
+
+func (r *sqlWebhookRepository) Create(ctx context.Context, webhook *models.Webhook) error {
+	webhook.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+	return r.db.QueryRowContext(ctx, "INSERT INTO webhooks (user_id, url, events, secret, active, created_at) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id",
+		webhook.UserID, webhook.URL, strings.Join(webhook.Events, ","), webhook.Secret, webhook.Active, webhook.CreatedAt).
+		Scan(&webhook.ID)
+}
+
+func (r *sqlWebhookRepository) Update(ctx context.Context, webhook *models.Webhook) error {
+	saved, err := scanWebhook(r.db.QueryRowContext(ctx, `UPDATE webhooks SET url = $1, events = $2, active = $3,
+	secret = CASE WHEN $4 = '' THEN secret ELSE $4 END
+WHERE id = $5 AND user_id = $6 RETURNING `+webhookColumns,
+		webhook.URL, strings.Join(webhook.Events, ","), webhook.Active, webhook.Secret, webhook.ID, webhook.UserID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	*webhook = saved
+	return nil
+}
+
+func (r *sqlWebhookRepository) Delete(ctx context.Context, userID, id int) error {
+	result, err := r.db.ExecContext(ctx, "DELETE FROM webhooks WHERE id = $1 AND user_id = $2", id, userID)
+	if err != nil {
+		return err
+	}
+	return expectRow(result)
+}
+
+func (r *sqlWebhookRepository) Deliveries(ctx context.Context, userID, webhookID, beforeID, limit int) ([]models.WebhookDelivery, error) {
+	if _, err := r.Get(ctx, userID, webhookID); err != nil {
+		return nil, err
+	}
+
+	stmt := "SELECT " + deliveryColumns + " FROM webhook_deliveries WHERE webhook_id = $1"
+	args := []interface{}{webhookID, limit}
+	if beforeID > 0 {
+		stmt += " AND id < $3"
+		args = append(args, beforeID)
+	}
+	rows, err := r.db.QueryContext(ctx, stmt+" ORDER BY id DESC LIMIT $2", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []models.WebhookDelivery{}
+	for rows.Next() {
+		delivery, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+func (r *sqlWebhookRepository) Redeliver(ctx context.Context, userID, webhookID, deliveryID int) error {
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	result, err := r.db.ExecContext(ctx, `UPDATE webhook_deliveries SET status = $1, attempts = 0, next_attempt_at = $2, updated_at = $2
+WHERE id = $3 AND webhook_id = $4 AND webhook_id IN (SELECT id FROM webhooks WHERE user_id = $5)`,
+		models.DeliveryPending, now, deliveryID, webhookID, userID)
+	if err != nil {
+		return err
+	}
+	return expectRow(result)
+}
+
+func (r *sqlWebhookRepository) ClaimDue(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]models.WebhookDelivery, error) {
+	now = now.UTC()
+	// Moving next_attempt_at forward is the claim. The outer conditions are
+	// repeated so a row claimed concurrently is re-checked and skipped.
+	// Deliveries of inactive webhooks wait until they are activated again.
+	rows, err := r.db.QueryContext(ctx, `UPDATE webhook_deliveries SET next_attempt_at = $1
+WHERE status = $2 AND next_attempt_at <= $3 AND id IN (
+	SELECT id FROM webhook_deliveries WHERE status = $2 AND next_attempt_at <= $3
+	AND webhook_id IN (SELECT id FROM webhooks WHERE active)
+	ORDER BY next_attempt_at, id LIMIT $4
+)
+RETURNING id`, now.Add(lease), models.DeliveryPending, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var placeholders []string
+	var args []interface{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		args = append(args, id)
+		placeholders = append(placeholders, fmt.Sprintf("$%d", len(args)))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	deliveries := []models.WebhookDelivery{}
+	if len(args) == 0 {
+		return deliveries, nil
+	}
+
+	rows, err = r.db.QueryContext(ctx, "SELECT "+prefixColumns("d", deliveryColumns)+`, w.url, w.secret FROM webhook_deliveries d
+JOIN webhooks w ON w.id = d.webhook_id WHERE d.id IN (`+strings.Join(placeholders, ", ")+") ORDER BY d.next_attempt_at, d.id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var url, secret string
+		delivery, err := scanDelivery(rows, &url, &secret)
+		if err != nil {
+			return nil, err
+		}
+		delivery.URL, delivery.Secret = url, secret
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+func (r *sqlWebhookRepository) RecordAttempt(ctx context.Context, delivery models.WebhookDelivery) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE webhook_deliveries SET status = $1, attempts = $2, next_attempt_at = $3,
+	last_status_code = $4, last_error = $5, updated_at = $6
+WHERE id = $7`,
+		delivery.Status, delivery.Attempts, utc(delivery.NextAttemptAt), delivery.LastStatusCode, delivery.LastError,
+		time.Now().UTC().Truncate(time.Microsecond), delivery.ID)
+	return err
+}
+
+// subscribed reports whether a webhook listening to events receives event
+func subscribed(events []string, event string) bool {
+	for _, e := range events {
+		if e == "*" || e == event {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,27 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// NewSQLite returns a Store backed by an open SQLite database
+func NewSQLite(db *sql.DB) *Store {
+	return &Store{
+		Todos:    &sqlTodoRepository{db: db, ilike: "LIKE"},
+		Tags:     &sqlTagRepository{db: db, isDuplicate: isSQLiteUniqueViolation},
+		Users:    &sqlUserRepository{db: db, isDuplicate: isSQLiteUniqueViolation},
+		Webhooks: &sqlWebhookRepository{db: db},
+		History:  &sqlHistoryRepository{db: db},
+		Lists:    &sqlListRepository{db: db, isDuplicate: isSQLiteUniqueViolation},
+		Tenants:  &sqlTenantRepository{db: db, isDuplicate: isSQLiteUniqueViolation},
+	}
+}
+
+func isSQLiteUniqueViolation(err error) bool {
+	var sqliteErr *sqlite.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE
+}
@@ -0,0 +1,78 @@
+package routes
+
+import "gin-app/authz"
+
+// policy names the permission of every route, public ones included, so
+// that each new route needs a decision
+var policy = authz.Policy{
+	"GET /":               authz.Public,
+	"GET /openapi.json":   authz.Public,
+	"GET /docs":           authz.Public,
+	"GET /metrics":        authz.Public,
+	"GET /healthz":        authz.Public,
+	"GET /readyz":         authz.Public,
+	"POST /auth/register": authz.Public,
+	"POST /auth/login":    authz.Public,
+
+	"GET /users/me": authz.ReadAccount,
+	"PUT /users/me": authz.WriteAccount,
+
+	"GET /todos":                             authz.ReadTodos,
+	"POST /todos":                            authz.WriteTodos,
+	"GET /todos/export":                      authz.ReadTodos,
+	"POST /todos/import":                     authz.WriteTodos,
+	"GET /todos/:id":                         authz.ReadTodos,
+	"PUT /todos/:id":                         authz.WriteTodos,
+	"DELETE /todos/:id":                      authz.WriteTodos,
+	"GET /todos/:id/subtree":                 authz.ReadTodos,
+	"POST /todos/:id/blockers":               authz.WriteTodos,
+	"DELETE /todos/:id/blockers/:blocker_id": authz.WriteTodos,
+	"POST /todos/:id/restore":                authz.WriteTodos,
+	"GET /todos/:id/history":                 authz.ReadTodos,
+	"POST /todos/:id/revert":                 authz.WriteTodos,
+	"POST /todos/:id/move":                   authz.WriteTodos,
+	"POST /todos:method":                     authz.WriteTodos,
+	"GET /todos/stream":                      authz.ReadTodos,
+	"GET /trash":                             authz.ReadTodos,
+	"DELETE /trash":                          authz.WriteTodos,
+	"DELETE /trash/:id":                      authz.WriteTodos,
+
+	"GET /lists":                           authz.ReadLists,
+	"POST /lists":                          authz.WriteLists,
+	"GET /lists/:id":                       authz.ReadLists,
+	"PUT /lists/:id":                       authz.WriteLists,
+	"DELETE /lists/:id":                    authz.WriteLists,
+	"GET /lists/:id/members":               authz.ReadLists,
+	"PUT /lists/:id/members/:user_id":      authz.WriteLists,
+	"DELETE /lists/:id/members/:user_id":   authz.WriteLists,
+	"GET /lists/:id/invites":               authz.ReadLists,
+	"POST /lists/:id/invites":              authz.WriteLists,
+	"DELETE /lists/:id/invites/:invite_id": authz.WriteLists,
+	"GET /invites":                         authz.ReadLists,
+	"POST /invites/:id/accept":             authz.WriteLists,
+	"POST /invites/:id/decline":            authz.WriteLists,
+
+	"GET /tags":            authz.ReadTags,
+	"PUT /tags/:id":        authz.WriteTags,
+	"POST /tags/:id/merge": authz.WriteTags,
+
+	"GET /webhooks":                authz.ReadWebhooks,
+	"POST /webhooks":               authz.WriteWebhooks,
+	"GET /webhooks/:id":            authz.ReadWebhooks,
+	"PUT /webhooks/:id":            authz.WriteWebhooks,
+	"DELETE /webhooks/:id":         authz.WriteWebhooks,
+	"GET /webhooks/:id/deliveries": authz.ReadWebhooks,
+	"POST /webhooks/:id/deliveries/:delivery_id/redeliver": authz.WriteWebhooks,
+
+	"GET /admin/users":     authz.ManageUsers,
+	"POST /admin/users":    authz.ManageUsers,
+	"GET /admin/users/:id": authz.ManageUsers,
+	"PUT /admin/users/:id": authz.ManageUsers,
+	"GET /admin/todos":     authz.ReadAllTodos,
+
+	"GET /tenants":              authz.ManageTenants,
+	"POST /tenants":             authz.ManageTenants,
+	"GET /tenants/:id":          authz.ManageTenants,
+	"POST /tenants/:id/suspend": authz.ManageTenants,
+	"POST /tenants/:id/resume":  authz.ManageTenants,
+}
@@ -1,21 +1,69 @@
 package routes
 
 import (
+	"net/http"
+	"strings"
+
+	"gin-app/config"
 	"gin-app/controllers"
 	"gin-app/database"
+	"gin-app/events"
+	"gin-app/idempotency"
+	"gin-app/metrics"
+	"gin-app/middleware"
+	"gin-app/openapi"
+	"gin-app/ratelimit"
+	"gin-app/recurrence"
+	"gin-app/repository"
+	"gin-app/stream"
 
+	"github.com/getkin/kin-openapi/openapi3"
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 )
 
-// SetupRouter initializes the Gin router and defines routes
-func SetupRouter() *gin.Engine {
-	r := gin.Default()
+// SetupRouter initializes the Gin router and defines routes. Every route
+// must have an operation in doc, which validates its requests. API routes
+// are rate limited by group, with buckets kept in limits, and the responses
+// to their POSTs with an Idempotency-Key are kept in keys. Every request is
+// counted in m, and traced unless it is a scrape or a probe.
+func SetupRouter(cfg config.Config, store *repository.Store, scheduler *recurrence.Scheduler, bus *events.Bus, hub *stream.Hub, doc *openapi3.T, limits ratelimit.Store, keys idempotency.Store, m *metrics.Metrics) *gin.Engine {
+	r := gin.New()
+	r.Use(
+		otelgin.Middleware(cfg.Tracing.ServiceName, otelgin.WithGinFilter(func(c *gin.Context) bool {
+			return !untraced[c.FullPath()]
+		})),
+		middleware.RequestID(),
+		middleware.RequestLogger(),
+		m.Middleware(),
+		middleware.Recovery(),
+	)
+	// The proxies were checked with the configuration
+	_ = r.SetTrustedProxies(cfg.Server.Proxies())
 
-	// Initialize database connection
-	DB := database.GetDB()
+	// Initialize controllers with the selected store
+	authController := controllers.AuthController(store.Users, store.Tenants, cfg.Auth)
+	userController := controllers.UserController(store.Users)
+	adminController := controllers.AdminController(store.Users)
+	tenantController := controllers.TenantController(store.Tenants)
+	todoController := controllers.TodoController(store.Todos, store.History, store.Lists, cfg.CursorKey(), scheduler, bus, cfg.Server.RequireIfMatch)
+	tagController := controllers.TagController(store.Tags)
+	listController := controllers.ListController(store.Lists, store.Users)
+	webhookController := controllers.WebhookController(store.Webhooks, cfg.Webhooks.AllowPrivate)
+	healthController := controllers.HealthController(database.GetDB(), database.GetDialect())
+	streamController := controllers.StreamController(hub, cfg.Stream.Heartbeat)
 
-	// Initialize TodoController with the database connection
-	todoController := controllers.TodoController(DB)
+	// Requests are counted against their group's limit first, then
+	// authenticated, then authorized, then validated, and only then
+	// replayed or run once per Idempotency-Key
+	auth := middleware.AuthMiddleware(cfg.Auth, store.Tenants, store.Users)
+	operator := middleware.OperatorAuth(cfg.Auth)
+	authorize := middleware.Authorize(policy)
+	validate := openapi.Validator(doc)
+	idempotent := middleware.Idempotency(keys, cfg.Server.RequestTimeout, cfg.Server.IdempotencyTTL)
+	limitAuth := middleware.RateLimit(cfg.Auth, limits, "auth", cfg.RateLimit.Auth)
+	limitTodos := middleware.RateLimit(cfg.Auth, limits, "todos", cfg.RateLimit.Todos)
+	limitDefault := middleware.RateLimit(cfg.Auth, limits, "default", cfg.RateLimit.Default)
 
 	// Define routes
 	r.GET("/", func(c *gin.Context) {
@@ -24,11 +72,132 @@ func SetupRouter() *gin.Engine {
 		})
 	})
 
-	// To-Do routes
-	r.GET("/todos", todoController.GetTodos)
-	r.POST("/todos", todoController.CreateTodo)
-	r.PUT("/todos/:id", todoController.UpdateTodo)
-	r.DELETE("/todos/:id", todoController.DeleteTodo)
+	// The API description and its reference page
+	r.GET("/openapi.json", openapi.Spec(doc))
+	r.GET("/docs", openapi.Docs(doc))
+
+	// Metrics for Prometheus to scrape
+	r.GET("/metrics", m.Handler())
+
+	// Liveness and readiness probes
+	r.GET("/healthz", healthController.Live)
+	r.GET("/readyz", healthController.Ready)
+
+	// Auth routes
+	authRoutes := r.Group("/auth", limitAuth, validate)
+	authRoutes.POST("/register", authController.Register)
+	authRoutes.POST("/login", authController.Login)
+
+	// Account routes
+	users := r.Group("/users", limitDefault, auth, authorize, validate)
+	users.GET("/me", userController.GetMe)
+	users.PUT("/me", userController.UpdateMe)
+
+	// To-Do routes, scoped to the authenticated user and the lists shared with them
+	todos := r.Group("/todos", limitTodos, auth, authorize, validate, idempotent)
+	todos.GET("", todoController.GetTodos)
+	todos.POST("", todoController.CreateTodo)
+	todos.GET("/export", todoController.ExportTodos)
+	todos.POST("/import", todoController.ImportTodos)
+	todos.GET("/:id", todoController.GetTodo)
+	todos.PUT("/:id", todoController.UpdateTodo)
+	todos.DELETE("/:id", todoController.DeleteTodo)
+	todos.GET("/:id/subtree", todoController.GetSubtree)
+	todos.POST("/:id/blockers", todoController.AddBlocker)
+	todos.DELETE("/:id/blockers/:blocker_id", todoController.RemoveBlocker)
+	todos.POST("/:id/restore", todoController.RestoreTodo)
+	todos.GET("/:id/history", todoController.GetHistory)
+	todos.POST("/:id/revert", todoController.RevertTodo)
+	todos.POST("/:id/move", todoController.MoveTodo)
+
+	// Custom methods on the collection, such as POST /todos:batch
+	r.POST("/todos:method", limitTodos, auth, authorize, validate, idempotent, customMethods(map[string]gin.HandlerFunc{
+		"batch": todoController.BatchTodos,
+	}))
+
+	// Deleted todos, until they are restored or purged
+	trash := r.Group("/trash", limitTodos, auth, authorize, validate)
+	trash.GET("", todoController.GetTrash)
+	trash.DELETE("", todoController.EmptyTrash)
+	trash.DELETE("/:id", todoController.PurgeTodo)
+
+	// Live change stream; browsers may pass the token as ?access_token=
+	r.GET("/todos/stream", middleware.TokenFromQuery(), limitDefault, auth, authorize, validate, streamController.Stream)
+
+	// Lists, their members and the invitations to join them
+	lists := r.Group("/lists", limitDefault, auth, authorize, validate, idempotent)
+	lists.GET("", listController.GetLists)
+	lists.POST("", listController.CreateList)
+	lists.GET("/:id", listController.GetList)
+	lists.PUT("/:id", listController.RenameList)
+	lists.DELETE("/:id", listController.DeleteList)
+	lists.GET("/:id/members", listController.GetMembers)
+	lists.PUT("/:id/members/:user_id", listController.SetMemberRole)
+	lists.DELETE("/:id/members/:user_id", listController.RemoveMember)
+	lists.GET("/:id/invites", listController.GetInvites)
+	lists.POST("/:id/invites", listController.CreateInvite)
+	lists.DELETE("/:id/invites/:invite_id", listController.RevokeInvite)
+
+	// Invitations addressed to the authenticated user
+	invites := r.Group("/invites", limitDefault, auth, authorize, validate, idempotent)
+	invites.GET("", listController.GetInvitations)
+	invites.POST("/:id/accept", listController.AcceptInvite)
+	invites.POST("/:id/decline", listController.DeclineInvite)
+
+	// Tag routes
+	tags := r.Group("/tags", limitDefault, auth, authorize, validate, idempotent)
+	tags.GET("", tagController.GetTags)
+	tags.PUT("/:id", tagController.RenameTag)
+	tags.POST("/:id/merge", tagController.MergeTags)
+
+	// Webhook subscriptions and their delivery logs
+	webhooks := r.Group("/webhooks", limitDefault, auth, authorize, validate, idempotent)
+	webhooks.GET("", webhookController.GetWebhooks)
+	webhooks.POST("", webhookController.CreateWebhook)
+	webhooks.GET("/:id", webhookController.GetWebhook)
+	webhooks.PUT("/:id", webhookController.UpdateWebhook)
+	webhooks.DELETE("/:id", webhookController.DeleteWebhook)
+	webhooks.GET("/:id/deliveries", webhookController.GetDeliveries)
+	webhooks.POST("/:id/deliveries/:delivery_id/redeliver", webhookController.RedeliverDelivery)
+
+	// Account management and every account's todos, for the admins of a
+	// tenant
+	admin := r.Group("/admin", limitDefault, auth, authorize, validate)
+	admin.GET("/users", adminController.GetUsers)
+	admin.POST("/users", adminController.CreateUser)
+	admin.GET("/users/:id", adminController.GetUser)
+	admin.PUT("/users/:id", adminController.SetUserRole)
+	admin.GET("/todos", todoController.GetAllTodos)
+
+	// Tenants, for operators holding the operator token
+	tenants := r.Group("/tenants", limitDefault, operator, authorize, validate)
+	tenants.GET("", tenantController.GetTenants)
+	tenants.POST("", tenantController.CreateTenant)
+	tenants.GET("/:id", tenantController.GetTenant)
+	tenants.POST("/:id/suspend", tenantController.SuspendTenant)
+	tenants.POST("/:id/resume", tenantController.ResumeTenant)
 
 	return r
 }
+
+// untraced are the routes of scrapes and probes, which would only add noise
+// to traces
+var untraced = map[string]bool{
+	"/metrics": true,
+	"/healthz": true,
+	"/readyz":  true,
+}
+
+// customMethods routes custom methods such as POST /todos:batch. Gin paths
+// cannot contain a literal colon, so the method is matched as a parameter,
+// whose value keeps the colon.
+func customMethods(methods map[string]gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		handler, ok := methods[strings.TrimPrefix(c.Param("method"), ":")]
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Unknown method"})
+			return
+		}
+		handler(c)
+	}
+}
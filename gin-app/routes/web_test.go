@@ -0,0 +1,114 @@
+package routes
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"gin-app/config"
+	"gin-app/events"
+	"gin-app/idempotency"
+	"gin-app/metrics"
+	"gin-app/openapi"
+	"gin-app/ratelimit"
+	"gin-app/recurrence"
+	"gin-app/repository"
+	"gin-app/stream"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/gin-gonic/gin"
+)
+
+// routeParam matches the parameters of a gin route, with the slash before
+// those that make up a whole segment
+var routeParam = regexp.MustCompile(`(/?)[:*](\w+)`)
+
+// TestRoutesAreDocumented fails when a route has no operation in the OpenAPI
+// document, or an operation has no route
+func TestRoutesAreDocumented(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	doc, err := openapi.Load()
+	if err != nil {
+		t.Fatalf("loading the OpenAPI document: %v", err)
+	}
+
+	r := testRouter(doc)
+
+	operations := map[string]bool{}
+	for path, item := range doc.Paths.Map() {
+		for method := range item.Operations() {
+			operations[method+" "+path] = false
+		}
+	}
+
+	for _, route := range r.Routes() {
+		match := regexp.MustCompile("^" + route.Method + " " + routePattern(route.Path) + "$")
+
+		documented := false
+		for operation := range operations {
+			if match.MatchString(operation) {
+				operations[operation], documented = true, true
+			}
+		}
+		if !documented {
+			t.Errorf("%s %s has no operation in openapi/openapi.yaml", route.Method, route.Path)
+		}
+	}
+
+	for operation, routed := range operations {
+		if !routed {
+			t.Errorf("%s is documented but not routed", operation)
+		}
+	}
+}
+
+// TestRoutesHavePolicy fails when a route has no entry in the authorization
+// policy, or an entry has no route
+func TestRoutesHavePolicy(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	doc, err := openapi.Load()
+	if err != nil {
+		t.Fatalf("loading the OpenAPI document: %v", err)
+	}
+
+	routed := map[string]bool{}
+	for _, route := range testRouter(doc).Routes() {
+		key := route.Method + " " + route.Path
+		routed[key] = true
+		if _, ok := policy[key]; !ok {
+			t.Errorf("%s has no permission in routes/policy.go", key)
+		}
+	}
+	for key := range policy {
+		if !routed[key] {
+			t.Errorf("%s has a permission but no route", key)
+		}
+	}
+}
+
+func testRouter(doc *openapi3.T) *gin.Engine {
+	cfg := config.Default()
+	cfg.Auth.JWTSecret = strings.Repeat("k", 32)
+	store := repository.NewMemory()
+	bus := events.NewBus()
+	return SetupRouter(cfg, store, recurrence.NewScheduler(store, bus, cfg.Scheduler), bus, stream.NewHub(cfg.Stream.ReplaySize, cfg.Stream.ReplayWindow), doc, ratelimit.NewMemoryStore(), idempotency.NewMemoryStore(), metrics.New())
+}
+
+// routePattern matches the document paths of a gin route. Whole-segment
+// parameters are templates in the document, and the others, such as the
+// custom method of /todos:method, are filled in.
+func routePattern(route string) string {
+	var b strings.Builder
+	last := 0
+	for _, m := range routeParam.FindAllStringSubmatchIndex(route, -1) {
+		b.WriteString(regexp.QuoteMeta(route[last:m[0]]))
+		if m[3] > m[2] {
+			b.WriteString(`/\{` + route[m[4]:m[5]] + `\}`)
+		} else {
+			b.WriteString(`:[^/]+`)
+		}
+		last = m[1]
+	}
+	b.WriteString(regexp.QuoteMeta(route[last:]))
+	return b.String()
+}
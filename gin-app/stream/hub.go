@@ -0,0 +1,193 @@
+// Package stream pushes todo events to connected clients. Every user has a
+// bounded replay buffer of recent events so that a client reconnecting with
+// Last-Event-ID receives what it missed. A user's buffer is dropped once
+// nobody is subscribed and its newest event is older than the replay window.
+package stream
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gin-app/events"
+)
+
+// subscriptionBuffer is how many messages a subscriber may fall behind
+// before it is disconnected and has to resume from the replay buffer
+const subscriptionBuffer = 64
+
+// Message is an event together with its stream ID
+type Message struct {
+	ID string `json:"id"`
+	events.Event
+}
+
+// Hub fans messages out to the subscriptions of their user
+type Hub struct {
+	replaySize   int
+	replayWindow time.Duration
+	instance     string
+	sequence     atomic.Uint64
+
+	mu        sync.Mutex
+	users     map[int]*userStream
+	nextEvict time.Time
+	closed    bool
+}
+
+type userStream struct {
+	replay []Message // oldest first, at most replaySize
+	subs   map[*Subscription]struct{}
+}
+
+// idle reports whether the stream has no subscribers and nothing newer than
+// since to replay
+func (s *userStream) idle(since time.Time) bool {
+	return len(s.subs) == 0 && (len(s.replay) == 0 || s.replay[len(s.replay)-1].OccurredAt.Before(since))
+}
+
+// Subscription receives a user's messages on C until it is closed, either by
+// Close or by the hub when the subscriber falls too far behind or the hub
+// is closed
+type Subscription struct {
+	C <-chan Message
+
+	c      chan Message
+	hub    *Hub
+	userID int
+	closed bool // guarded by hub.mu
+}
+
+func NewHub(replaySize int, replayWindow time.Duration) *Hub {
+	instance := make([]byte, 4)
+	rand.Read(instance)
+	return &Hub{replaySize: replaySize, replayWindow: replayWindow, instance: hex.EncodeToString(instance), users: map[int]*userStream{}}
+}
+
+// Message assigns event an ID that is unique across instances
+func (h *Hub) Message(event events.Event) Message {
+	return Message{ID: h.instance + "-" + strconv.FormatUint(h.sequence.Add(1), 10), Event: event}
+}
+
+// Handle delivers event to this instance's subscribers. It is an
+// events.Handler for single-instance deployments; see PostgresFanout for
+// several instances.
+func (h *Hub) Handle(ctx context.Context, event events.Event) error {
+	h.Deliver(h.Message(event))
+	return nil
+}
+
+// Deliver records msg in its user's replay buffer and sends it to the user's
+// subscriptions
+func (h *Hub) Deliver(msg Message) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if now := time.Now(); !now.Before(h.nextEvict) {
+		h.evict(now)
+		h.nextEvict = now.Add(h.replayWindow)
+	}
+	stream := h.stream(msg.UserID)
+	stream.replay = append(stream.replay, msg)
+	if len(stream.replay) > h.replaySize {
+		stream.replay = append(stream.replay[:0:0], stream.replay[len(stream.replay)-h.replaySize:]...)
+	}
+
+	for sub := range stream.subs {
+		select {
+		case sub.c <- msg:
+		default:
+			h.close(sub)
+		}
+	}
+}
+
+// Subscribe starts receiving the user's messages. With a lastEventID it also
+// returns the buffered messages that followed it; reset reports that the ID
+// is no longer buffered, so the client must reload its state.
+func (h *Hub) Subscribe(userID int, lastEventID string) (sub *Subscription, replay []Message, reset bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	c := make(chan Message, subscriptionBuffer)
+	sub = &Subscription{C: c, c: c, hub: h, userID: userID}
+	stream := h.stream(userID)
+	stream.subs[sub] = struct{}{}
+	if h.closed {
+		h.close(sub)
+	}
+
+	if lastEventID == "" {
+		return sub, nil, false
+	}
+	for i, msg := range stream.replay {
+		if msg.ID == lastEventID {
+			return sub, append([]Message{}, stream.replay[i+1:]...), false
+		}
+	}
+	return sub, nil, true
+}
+
+// Close stops the subscription. It is safe to call more than once.
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	s.hub.close(s)
+}
+
+// Close ends every subscription, now and to come, so that open streams
+// return while the server shuts down
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	for _, stream := range h.users {
+		for sub := range stream.subs {
+			h.close(sub)
+		}
+	}
+}
+
+// Closed reports whether the hub has been closed
+func (h *Hub) Closed() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.closed
+}
+
+// close removes sub and closes its channel. Callers hold h.mu.
+func (h *Hub) close(sub *Subscription) {
+	if sub.closed {
+		return
+	}
+	sub.closed = true
+	delete(h.users[sub.userID].subs, sub)
+	close(sub.c)
+}
+
+// evict drops the streams that have been idle for the replay window, so that
+// the hub does not keep a buffer for every user it ever saw. A client
+// resuming from a dropped buffer is told to reload. Callers hold h.mu.
+func (h *Hub) evict(now time.Time) {
+	since := now.Add(-h.replayWindow)
+	for userID, stream := range h.users {
+		if stream.idle(since) {
+			delete(h.users, userID)
+		}
+	}
+}
+
+// stream returns the user's stream, creating it if needed. Callers hold h.mu.
+func (h *Hub) stream(userID int) *userStream {
+	stream, ok := h.users[userID]
+	if !ok {
+		stream = &userStream{subs: map[*Subscription]struct{}{}}
+		h.users[userID] = stream
+	}
+	return stream
+}
@@ -0,0 +1,65 @@
+package stream
+
+import (
+	"testing"
+	"time"
+
+	"gin-app/events"
+	"gin-app/models"
+)
+
+// message returns a message for the user whose event occurred age ago
+func message(h *Hub, userID int, age time.Duration) Message {
+	event := events.New(events.TodoUpdated, models.Todo{ID: 1, UserID: userID})
+	event.OccurredAt = event.OccurredAt.Add(-age)
+	return h.Message(event)
+}
+
+func TestIdleStreamsEvicted(t *testing.T) {
+	h := NewHub(8, time.Minute)
+	old := message(h, 1, 2*time.Minute)
+	h.Deliver(old)
+	h.Deliver(message(h, 2, 0))
+	sub, _, _ := h.Subscribe(3, "")
+	h.Deliver(message(h, 3, 2*time.Minute))
+
+	h.mu.Lock()
+	h.evict(time.Now())
+	_, kept1 := h.users[1]
+	_, kept2 := h.users[2]
+	_, kept3 := h.users[3]
+	h.mu.Unlock()
+	if kept1 || !kept2 || !kept3 {
+		t.Fatalf("kept users 1 %v, 2 %v, 3 %v; want only 2 and 3, which is subscribed", kept1, kept2, kept3)
+	}
+
+	sub.Close()
+	h.mu.Lock()
+	h.evict(time.Now())
+	_, kept3 = h.users[3]
+	h.mu.Unlock()
+	if kept3 {
+		t.Error("user 3 kept after unsubscribing")
+	}
+
+	resumed, replay, reset := h.Subscribe(1, old.ID)
+	defer resumed.Close()
+	if !reset || len(replay) != 0 {
+		t.Errorf("resuming from an evicted buffer: reset %v, %d messages", reset, len(replay))
+	}
+}
+
+func TestDeliverEvicts(t *testing.T) {
+	h := NewHub(8, time.Minute)
+	h.Deliver(message(h, 1, 2*time.Minute))
+	// The first delivery evicted before adding its message; the next one
+	// waits for the window
+	h.nextEvict = time.Now()
+	h.Deliver(message(h, 2, 0))
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.users[1]; ok || len(h.users) != 1 {
+		t.Errorf("got %d streams, want only user 2's", len(h.users))
+	}
+}
@@ -0,0 +1,90 @@
+package stream
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"gin-app/events"
+	"gin-app/models"
+
+	"github.com/lib/pq"
+)
+
+// Channel is the Postgres notification channel that carries stream messages
+const Channel = "todo_events"
+
+// maxPayload keeps notifications under Postgres' 8000 byte payload limit
+const maxPayload = 7900
+
+// PostgresFanout shares messages between instances through LISTEN/NOTIFY.
+// Every instance, including the publishing one, delivers a message to its hub
+// when the notification arrives, so all replay buffers hold the same IDs.
+type PostgresFanout struct {
+	Hub *Hub
+	DB  *sql.DB
+	DSN string
+}
+
+func NewPostgresFanout(hub *Hub, db *sql.DB, dsn string) *PostgresFanout {
+	return &PostgresFanout{Hub: hub, DB: db, DSN: dsn}
+}
+
+// Handle notifies every instance of event. It is an events.Handler.
+func (f *PostgresFanout) Handle(ctx context.Context, event events.Event) error {
+	msg := f.Hub.Message(event)
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	if len(payload) > maxPayload {
+		// Too large to notify: send the todo's identity only, which clients
+		// can use to fetch it
+		msg.Todo = models.Todo{ID: event.Todo.ID, UserID: event.Todo.UserID}
+		if payload, err = json.Marshal(msg); err != nil {
+			return err
+		}
+	}
+
+	_, err = f.DB.ExecContext(ctx, "SELECT pg_notify($1, $2)", Channel, string(payload))
+	return err
+}
+
+// Run listens for notifications and delivers them to the hub until ctx is
+// cancelled. Messages sent while the connection is being re-established are
+// lost; clients resuming past them get a reset.
+func (f *PostgresFanout) Run(ctx context.Context) {
+	listener := pq.NewListener(f.DSN, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			slog.Error("Error listening for stream notifications", "error", err)
+		}
+	})
+	defer listener.Close()
+
+	if err := listener.Listen(Channel); err != nil {
+		slog.Error("Error listening for stream notifications", "channel", Channel, "error", err)
+		return
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case n := <-listener.Notify:
+			// nil follows a reconnect
+			if n == nil {
+				continue
+			}
+			var msg Message
+			if err := json.Unmarshal([]byte(n.Extra), &msg); err != nil {
+				slog.Error("Error decoding stream notification", "error", err)
+				continue
+			}
+			f.Hub.Deliver(msg)
+		case <-time.After(time.Minute):
+			go listener.Ping()
+		}
+	}
+}
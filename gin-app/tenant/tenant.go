@@ -0,0 +1,54 @@
+// Package tenant carries the tenant that work is done for in its context.
+// Postgres sessions are scoped to it, and row-level security keeps them to
+// that tenant's rows unless their role bypasses it.
+package tenant
+
+import (
+	"context"
+	"strconv"
+)
+
+// Default is the tenant of the data that predates tenants, and the only one
+// of the SQLite and memory stores
+const Default = 1
+
+type contextKey struct{}
+
+// scope is a tenant ID, or every tenant
+type scope struct {
+	id  int
+	all bool
+}
+
+// With returns a context acting for tenant id
+func With(ctx context.Context, id int) context.Context {
+	return context.WithValue(ctx, contextKey{}, scope{id: id})
+}
+
+// All returns a context acting for every tenant, as background workers and
+// migrations do. Row-level security shows such a context no rows, so it is
+// only of use on the connections of a role that bypasses it.
+func All(ctx context.Context) context.Context {
+	return context.WithValue(ctx, contextKey{}, scope{all: true})
+}
+
+// FromContext returns the tenant ctx acts for, and false when it acts for
+// none or for all of them
+func FromContext(ctx context.Context) (int, bool) {
+	s, ok := ctx.Value(contextKey{}).(scope)
+	return s.id, ok && !s.all
+}
+
+// Setting returns the value of the app.tenant_id session setting for ctx:
+// a tenant ID, or "all" or empty, which no row matches
+func Setting(ctx context.Context) string {
+	s, ok := ctx.Value(contextKey{}).(scope)
+	switch {
+	case !ok:
+		return ""
+	case s.all:
+		return "all"
+	default:
+		return strconv.Itoa(s.id)
+	}
+}
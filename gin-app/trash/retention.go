@@ -0,0 +1,55 @@
+// Package trash empties the todo trash once deleted todos are older than the
+// retention period.
+package trash
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"gin-app/config"
+	"gin-app/repository"
+)
+
+// Retention periodically purges todos that have been in the trash longer
+// than Period
+type Retention struct {
+	Todos    repository.TodoRepository
+	Period   time.Duration
+	Interval time.Duration
+}
+
+func NewRetention(todos repository.TodoRepository, cfg config.TrashConfig) *Retention {
+	return &Retention{Todos: todos, Period: cfg.Retention, Interval: cfg.PurgeInterval}
+}
+
+// Run purges expired todos every Interval until ctx is cancelled. A zero
+// Period keeps deleted todos until they are purged by hand.
+func (r *Retention) Run(ctx context.Context) {
+	if r.Period == 0 {
+		return
+	}
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := r.PurgeExpired(ctx); err != nil && ctx.Err() == nil {
+			slog.Error("Error purging the trash", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// PurgeExpired permanently removes todos deleted more than Period ago and
+// returns how many it removed
+func (r *Retention) PurgeExpired(ctx context.Context) (int, error) {
+	n, err := r.Todos.PurgeDeleted(ctx, time.Now().Add(-r.Period))
+	if n > 0 {
+		slog.Info("Purged todos from the trash", "count", n)
+	}
+	return n, err
+}
@@ -0,0 +1,175 @@
+// Package webhooks delivers todo events to subscribed HTTP endpoints. Events
+// are queued in the store with the change they announce, so deliveries
+// survive restarts, and are then sent in the background with exponential
+// backoff until they succeed or become dead letters.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"gin-app/config"
+	"gin-app/events"
+	"gin-app/models"
+	"gin-app/repository"
+)
+
+// batchSize caps the deliveries claimed in one pass
+const batchSize = 50
+
+// maxErrorLength caps the error text kept in the delivery log
+const maxErrorLength = 500
+
+// Dispatcher delivers the events queued for webhooks
+type Dispatcher struct {
+	Webhooks       repository.WebhookRepository
+	Client         *http.Client
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	PollInterval   time.Duration
+
+	wake chan struct{}
+}
+
+// NewDispatcher returns a dispatcher whose deliveries only reach public
+// addresses, unless cfg allows private ones
+func NewDispatcher(webhooks repository.WebhookRepository, cfg config.WebhookConfig) *Dispatcher {
+	return &Dispatcher{
+		Webhooks: webhooks,
+		Client: &http.Client{
+			Timeout:   cfg.Timeout,
+			Transport: newTransport(cfg.Timeout, cfg.AllowPrivate),
+			// A redirect is answered like any other non-2xx status
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+		MaxAttempts:    cfg.MaxAttempts,
+		InitialBackoff: cfg.InitialBackoff,
+		MaxBackoff:     cfg.MaxBackoff,
+		PollInterval:   cfg.PollInterval,
+		wake:           make(chan struct{}, 1),
+	}
+}
+
+// Handle wakes the dispatcher to deliver event, which the change it
+// announces queued. It is an events.Handler.
+func (d *Dispatcher) Handle(ctx context.Context, event events.Event) error {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Run delivers due deliveries every PollInterval, and as soon as an event is
+// queued, until ctx is cancelled
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := d.DeliverDue(ctx); err != nil && ctx.Err() == nil {
+			slog.Error("Error delivering webhooks", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		}
+	}
+}
+
+// DeliverDue makes one attempt at every delivery that is due and returns how
+// many it attempted
+func (d *Dispatcher) DeliverDue(ctx context.Context) (int, error) {
+	// The lease outlasts an attempt, so no other dispatcher picks the
+	// delivery up while it is in flight
+	lease := 2*d.Client.Timeout + d.PollInterval
+	deliveries, err := d.Webhooks.ClaimDue(ctx, time.Now(), lease, batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	var wg sync.WaitGroup
+	for _, delivery := range deliveries {
+		wg.Add(1)
+		go func(delivery models.WebhookDelivery) {
+			defer wg.Done()
+			d.attempt(ctx, &delivery)
+			if err := d.Webhooks.RecordAttempt(ctx, delivery); err != nil {
+				slog.Error("Error recording webhook delivery", "delivery_id", delivery.ID, "error", err)
+			}
+		}(delivery)
+	}
+	wg.Wait()
+	return len(deliveries), nil
+}
+
+// attempt POSTs the delivery once and updates it with the outcome
+func (d *Dispatcher) attempt(ctx context.Context, delivery *models.WebhookDelivery) {
+	delivery.Attempts++
+	delivery.LastStatusCode, delivery.LastError = nil, ""
+
+	err := d.post(ctx, delivery)
+	if err == nil {
+		delivery.Status, delivery.NextAttemptAt = models.DeliveryDelivered, nil
+		return
+	}
+
+	delivery.LastError = err.Error()
+	if len(delivery.LastError) > maxErrorLength {
+		delivery.LastError = delivery.LastError[:maxErrorLength]
+	}
+	if delivery.Attempts >= d.MaxAttempts {
+		delivery.Status, delivery.NextAttemptAt = models.DeliveryDead, nil
+		return
+	}
+	next := time.Now().Add(d.Backoff(delivery.Attempts))
+	delivery.NextAttemptAt = &next
+}
+
+func (d *Dispatcher) post(ctx context.Context, delivery *models.WebhookDelivery) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "gin-app-webhooks/1")
+	req.Header.Set(EventHeader, delivery.Event)
+	req.Header.Set(DeliveryHeader, strconv.Itoa(delivery.ID))
+	req.Header.Set(SignatureHeader, Sign(delivery.Secret, time.Now(), delivery.Payload))
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	delivery.LastStatusCode = &resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// Backoff returns the delay after the given failed attempt: InitialBackoff
+// doubled for every earlier failure, capped at MaxBackoff
+func (d *Dispatcher) Backoff(attempt int) time.Duration {
+	delay := d.InitialBackoff
+	for i := 1; i < attempt && delay < d.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > d.MaxBackoff {
+		delay = d.MaxBackoff
+	}
+	return delay
+}
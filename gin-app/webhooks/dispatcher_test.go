@@ -0,0 +1,198 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gin-app/audit"
+	"gin-app/config"
+	"gin-app/events"
+	"gin-app/models"
+	"gin-app/repository"
+)
+
+// receiver records the deliveries it gets and answers them with status
+type receiver struct {
+	mu       sync.Mutex
+	status   int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.requests = append(rc.requests, r)
+	rc.bodies = append(rc.bodies, body)
+	w.WriteHeader(rc.status)
+}
+
+// newTestDispatcher subscribes a webhook at a test server to every event.
+// The server is on loopback, so the dispatcher's client is replaced by one
+// that may reach it.
+func newTestDispatcher(t *testing.T, rc *receiver) (*Dispatcher, *repository.Store, models.Webhook) {
+	server := httptest.NewServer(rc)
+	t.Cleanup(server.Close)
+
+	store := repository.NewMemory()
+	webhook := models.Webhook{UserID: 1, URL: server.URL + "/hook", Events: []string{"*"}, Secret: "s3cret", Active: true}
+	if err := store.Webhooks.Create(context.Background(), &webhook); err != nil {
+		t.Fatal(err)
+	}
+
+	d := NewDispatcher(store.Webhooks, config.WebhookConfig{
+		Timeout:        time.Second,
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     time.Millisecond,
+		PollInterval:   time.Second,
+	})
+	d.Client = server.Client()
+	return d, store, webhook
+}
+
+// deliverAll creates a todo, which queues its creation, and delivers until
+// nothing is due
+func deliverAll(t *testing.T, d *Dispatcher, store *repository.Store) {
+	ctx := audit.WithActor(context.Background(), 1)
+	if err := store.Todos.Create(ctx, &models.Todo{UserID: 1, Title: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		n, err := d.DeliverDue(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n == 0 {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func deliveries(t *testing.T, webhooks repository.WebhookRepository, webhook models.Webhook) []models.WebhookDelivery {
+	list, err := webhooks.Deliveries(context.Background(), webhook.UserID, webhook.ID, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 {
+		t.Fatalf("got %d deliveries, want 1", len(list))
+	}
+	return list
+}
+
+func TestDeliverySigned(t *testing.T) {
+	rc := &receiver{status: http.StatusNoContent}
+	d, store, webhook := newTestDispatcher(t, rc)
+	deliverAll(t, d, store)
+
+	if len(rc.requests) != 1 {
+		t.Fatalf("got %d requests, want 1", len(rc.requests))
+	}
+	r := rc.requests[0]
+	if r.Header.Get(EventHeader) != events.TodoCreated {
+		t.Errorf("event header %q", r.Header.Get(EventHeader))
+	}
+	if err := Verify(webhook.Secret, r.Header.Get(SignatureHeader), rc.bodies[0], time.Now(), time.Minute); err != nil {
+		t.Errorf("signature: %v", err)
+	}
+	if err := Verify("other", r.Header.Get(SignatureHeader), rc.bodies[0], time.Now(), time.Minute); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("signature verified with the wrong secret: %v", err)
+	}
+
+	delivery := deliveries(t, store.Webhooks, webhook)[0]
+	if delivery.Status != models.DeliveryDelivered || delivery.Attempts != 1 || *delivery.LastStatusCode != http.StatusNoContent {
+		t.Errorf("delivery %+v", delivery)
+	}
+	if r.Header.Get(DeliveryHeader) != "1" {
+		t.Errorf("delivery header %q", r.Header.Get(DeliveryHeader))
+	}
+}
+
+func TestDeliveryRetriedUntilDead(t *testing.T) {
+	rc := &receiver{status: http.StatusBadGateway}
+	d, store, webhook := newTestDispatcher(t, rc)
+	deliverAll(t, d, store)
+
+	if len(rc.requests) != d.MaxAttempts {
+		t.Errorf("got %d requests, want %d", len(rc.requests), d.MaxAttempts)
+	}
+	delivery := deliveries(t, store.Webhooks, webhook)[0]
+	if delivery.Status != models.DeliveryDead || delivery.Attempts != d.MaxAttempts || delivery.NextAttemptAt != nil {
+		t.Errorf("delivery %+v", delivery)
+	}
+	if *delivery.LastStatusCode != http.StatusBadGateway || !strings.Contains(delivery.LastError, "502") {
+		t.Errorf("delivery log: %d %q", *delivery.LastStatusCode, delivery.LastError)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	d := &Dispatcher{InitialBackoff: time.Second, MaxBackoff: 10 * time.Second}
+	for attempt, want := range map[int]time.Duration{
+		1: time.Second,
+		2: 2 * time.Second,
+		3: 4 * time.Second,
+		4: 8 * time.Second,
+		5: 10 * time.Second,
+		9: 10 * time.Second,
+	} {
+		if got := d.Backoff(attempt); got != want {
+			t.Errorf("Backoff(%d) = %v, want %v", attempt, got, want)
+		}
+	}
+}
+
+func TestPrivateAddressRefused(t *testing.T) {
+	rc := &receiver{status: http.StatusOK}
+	d, store, webhook := newTestDispatcher(t, rc)
+	// The dispatcher's own client, which only reaches public addresses
+	d.Client = NewDispatcher(store.Webhooks, config.WebhookConfig{Timeout: time.Second}).Client
+	d.MaxAttempts = 1
+	deliverAll(t, d, store)
+
+	if len(rc.requests) != 0 {
+		t.Fatalf("a delivery reached %s", webhook.URL)
+	}
+	delivery := deliveries(t, store.Webhooks, webhook)[0]
+	if delivery.Status != models.DeliveryDead || !strings.Contains(delivery.LastError, ErrForbiddenAddress.Error()) {
+		t.Errorf("delivery %+v", delivery)
+	}
+}
+
+func TestCheckURL(t *testing.T) {
+	for rawURL, want := range map[string]bool{
+		"https://example.com/hook":          true,
+		"http://93.184.215.14:8080/":        true,
+		"ftp://example.com/":                false,
+		"/relative":                         false,
+		"http://localhost:8080/":            false,
+		"http://api.localhost/":             false,
+		"http://127.0.0.1/":                 false,
+		"http://10.1.2.3/":                  false,
+		"http://172.16.0.1/":                false,
+		"http://192.168.1.1/":               false,
+		"http://169.254.169.254/latest/":    false,
+		"http://100.64.0.1/":                false,
+		"http://0.0.0.0/":                   false,
+		"http://[::1]/":                     false,
+		"http://[fe80::1]/":                 false,
+		"http://[fd00::1]/":                 false,
+		"http://[::ffff:169.254.169.254]/":  false,
+		"http://[2606:4700:4700::1111]/dns": true,
+	} {
+		if err := CheckURL(rawURL, false); (err == nil) != want {
+			t.Errorf("CheckURL(%q) = %v, want ok %v", rawURL, err, want)
+		}
+	}
+	if err := CheckURL("http://127.0.0.1/", true); err != nil {
+		t.Errorf("private address refused although allowed: %v", err)
+	}
+}